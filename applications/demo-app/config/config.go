@@ -0,0 +1,299 @@
+// Package config is the typed configuration of the demo-app server. Load
+// builds it from, in increasing precedence, the defaults, an optional YAML
+// file (mounted from a ConfigMap), the environment and the command line, and
+// validates the result so that a bad value fails at startup rather than on
+// the first request that needs it.
+//
+// Every setting has a YAML key and an environment variable, named in the
+// struct tags; the most common ones also have a flag. The environment
+// variables are the ones the app has always read, including the standard
+// OTEL_* variables, so existing Helm values keep working. OTEL_SERVICE_NAME
+// and OTEL_RESOURCE_ATTRIBUTES are not settings here: the OTel SDK reads them
+// itself when the server builds its resource.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// Config is the effective configuration of the server
+type Config struct {
+	Server    Server    `json:"server"`
+	App       App       `json:"app"`
+	Log       Log       `json:"log"`
+	Tracing   Tracing   `json:"tracing"`
+	Readiness Readiness `json:"readiness"`
+	OpenAPI   OpenAPI   `json:"openapi"`
+	Faults    Faults    `json:"faults"`
+	Shutdown  Shutdown  `json:"shutdown"`
+	Debug     Debug     `json:"debug"`
+}
+
+// Server configures the HTTP server
+type Server struct {
+	ListenAddr   string   `json:"listen_addr" env:"LISTEN_ADDR" flag:"listen-addr" usage:"address to listen on"`
+	ReadTimeout  Duration `json:"read_timeout" env:"SERVER_READ_TIMEOUT" flag:"read-timeout" usage:"maximum duration for reading a request"`
+	WriteTimeout Duration `json:"write_timeout" env:"SERVER_WRITE_TIMEOUT" flag:"write-timeout" usage:"maximum duration for writing a response"`
+	IdleTimeout  Duration `json:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" flag:"idle-timeout" usage:"how long keep-alive connections stay idle"`
+}
+
+// App describes the running instance
+type App struct {
+	// Version is reported when the binary carries no build information
+	Version     string `json:"version" env:"APP_VERSION"`
+	Environment string `json:"environment" env:"ENVIRONMENT" flag:"environment" usage:"environment name added to traces"`
+}
+
+// Log configures the process-wide slog logger
+type Log struct {
+	// Format is json or logfmt
+	Format string `json:"format" env:"LOG_FORMAT" flag:"log-format" usage:"log format, json or logfmt"`
+	// Level is debug, info, warn or error
+	Level string `json:"level" env:"LOG_LEVEL" flag:"log-level" usage:"minimum log level"`
+}
+
+// Tracing configures the OpenTelemetry SDK through the standard variables
+type Tracing struct {
+	// Exporter is otlp, console or none
+	Exporter string `json:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	// Sampler is one of the OTEL_TRACES_SAMPLER names, SamplerArg the ratio
+	// of the *traceidratio samplers
+	Sampler    string  `json:"sampler" env:"OTEL_TRACES_SAMPLER"`
+	SamplerArg float64 `json:"sampler_arg" env:"OTEL_TRACES_SAMPLER_ARG"`
+	// Propagators are tracecontext, baggage, b3, b3multi or none
+	Propagators []string `json:"propagators" env:"OTEL_PROPAGATORS"`
+	OTLP        OTLP     `json:"otlp"`
+}
+
+// OTLP configures the span exporter
+type OTLP struct {
+	// Endpoint is host:port or a URL. When unset it is the lab collector on
+	// the protocol's default port, 4317 for grpc or 4318 for http/protobuf.
+	Endpoint string `json:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"otlp-endpoint" usage:"OTLP collector endpoint (default the lab collector on port 4317, or 4318 for http/protobuf)"`
+	// Protocol is grpc or http/protobuf; the traces-specific variable takes
+	// precedence as in the SDK specification
+	Protocol string `json:"protocol" env:"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL,OTEL_EXPORTER_OTLP_PROTOCOL"`
+	// Insecure disables TLS; when unset it is true unless TLS files are set
+	// or the endpoint is https
+	Insecure *bool `json:"insecure,omitempty" env:"OTEL_EXPORTER_OTLP_INSECURE"`
+	// Headers are comma-separated key=value pairs sent with every export,
+	// such as a collector token
+	Headers           Secret `json:"headers,omitempty" env:"OTEL_EXPORTER_OTLP_HEADERS"`
+	Certificate       string `json:"certificate,omitempty" env:"OTEL_EXPORTER_OTLP_CERTIFICATE"`
+	ClientCertificate string `json:"client_certificate,omitempty" env:"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE"`
+	ClientKey         string `json:"client_key,omitempty" env:"OTEL_EXPORTER_OTLP_CLIENT_KEY"`
+	// TLSDir is a mounted cert-manager Secret: ca.crt, tls.crt and tls.key
+	// are picked up from it
+	TLSDir string `json:"tls_dir,omitempty" env:"OTEL_EXPORTER_OTLP_TLS_DIR"`
+}
+
+// Readiness configures the dependency checks behind /ready
+type Readiness struct {
+	// TCPChecks and HTTPChecks are name=host:port and name=url pairs
+	TCPChecks  []string `json:"tcp_checks" env:"READINESS_TCP_CHECKS"`
+	HTTPChecks []string `json:"http_checks" env:"READINESS_HTTP_CHECKS"`
+	// OptionalChecks are reported but never fail readiness
+	OptionalChecks []string `json:"optional_checks" env:"READINESS_OPTIONAL_CHECKS"`
+	CheckTimeout   Duration `json:"check_timeout" env:"READINESS_CHECK_TIMEOUT"`
+	// OTLPCheck is critical, optional or off
+	OTLPCheck string `json:"otlp_check" env:"READINESS_OTLP_CHECK"`
+}
+
+// OpenAPI configures validation against the embedded openapi.yaml
+type OpenAPI struct {
+	// Validation is request, debug or off
+	Validation          string `json:"validation" env:"OPENAPI_VALIDATION"`
+	MaxRequestBodyBytes int64  `json:"max_request_body_bytes" env:"MAX_REQUEST_BODY_BYTES"`
+}
+
+// Faults configures app-level fault injection
+type Faults struct {
+	// Enabled allows the X-Fault-Inject header and /admin/faults
+	Enabled bool `json:"enabled" env:"FAULT_INJECTION"`
+	// Rules are semicolon-separated route=spec rules
+	Rules         string   `json:"rules,omitempty" env:"FAULT_RULES"`
+	ReadinessFlap Duration `json:"readiness_flap,omitempty" env:"FAULT_READINESS_FLAP"`
+}
+
+// Shutdown times the shutdown sequence; the three together must fit in the
+// pod's terminationGracePeriodSeconds
+type Shutdown struct {
+	PreStopDelay Duration `json:"pre_stop_delay" env:"SHUTDOWN_PRE_STOP_DELAY"`
+	DrainTimeout Duration `json:"drain_timeout" env:"SHUTDOWN_DRAIN_TIMEOUT"`
+	FlushTimeout Duration `json:"flush_timeout" env:"SHUTDOWN_FLUSH_TIMEOUT"`
+}
+
+// Debug enables endpoints for troubleshooting
+type Debug struct {
+	// ConfigEndpoint serves the redacted effective configuration at
+	// /debug/config
+	ConfigEndpoint bool `json:"config_endpoint" env:"DEBUG_CONFIG_ENDPOINT"`
+}
+
+// collectorHost is the lab OTel collector, the default OTLP endpoint
+const collectorHost = "otel-collector.observability.svc.cluster.local"
+
+// Default returns the configuration used for anything not set
+func Default() *Config {
+	c := defaults()
+	c.complete()
+	return c
+}
+
+// defaults is Default before the settings derived from others are filled in
+func defaults() *Config {
+	return &Config{
+		Server: Server{
+			ListenAddr:   ":8080",
+			ReadTimeout:  Duration(15 * time.Second),
+			WriteTimeout: Duration(15 * time.Second),
+			IdleTimeout:  Duration(60 * time.Second),
+		},
+		Log: Log{Format: "json", Level: "info"},
+		Tracing: Tracing{
+			Exporter:    "otlp",
+			Sampler:     "parentbased_always_on",
+			SamplerArg:  1,
+			Propagators: []string{"tracecontext", "baggage"},
+			OTLP:        OTLP{Protocol: "grpc"},
+		},
+		Readiness: Readiness{
+			CheckTimeout: Duration(2 * time.Second),
+			OTLPCheck:    "optional",
+		},
+		OpenAPI: OpenAPI{Validation: "request", MaxRequestBodyBytes: 1 << 20},
+		Shutdown: Shutdown{
+			PreStopDelay: Duration(5 * time.Second),
+			DrainTimeout: Duration(15 * time.Second),
+			FlushTimeout: Duration(5 * time.Second),
+		},
+	}
+}
+
+// complete fills in the defaults that depend on other settings, once every
+// source has been applied
+func (c *Config) complete() {
+	if c.Tracing.OTLP.Endpoint == "" {
+		port := "4317"
+		if strings.EqualFold(c.Tracing.OTLP.Protocol, "http/protobuf") {
+			port = "4318"
+		}
+		c.Tracing.OTLP.Endpoint = net.JoinHostPort(collectorHost, port)
+	}
+}
+
+// Validate reports every invalid setting, each prefixed with its YAML key
+// and environment variable
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(key, env string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", key, env, err))
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddr); err != nil {
+		check("server.listen_addr", "LISTEN_ADDR", err)
+	}
+	check("server.read_timeout", "SERVER_READ_TIMEOUT", positive(c.Server.ReadTimeout))
+	check("server.write_timeout", "SERVER_WRITE_TIMEOUT", positive(c.Server.WriteTimeout))
+	check("server.idle_timeout", "SERVER_IDLE_TIMEOUT", positive(c.Server.IdleTimeout))
+
+	check("log.format", "LOG_FORMAT", oneOf(strings.ToLower(c.Log.Format), "json", "logfmt", "text"))
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		check("log.level", "LOG_LEVEL", err)
+	}
+
+	check("tracing.exporter", "OTEL_TRACES_EXPORTER", oneOf(strings.ToLower(c.Tracing.Exporter), "otlp", "console", "stdout", "none"))
+	check("tracing.sampler", "OTEL_TRACES_SAMPLER", oneOf(strings.ToLower(c.Tracing.Sampler),
+		"always_on", "always_off", "traceidratio",
+		"parentbased_always_on", "parentbased_always_off", "parentbased_traceidratio"))
+	if c.Tracing.SamplerArg < 0 || c.Tracing.SamplerArg > 1 {
+		check("tracing.sampler_arg", "OTEL_TRACES_SAMPLER_ARG", fmt.Errorf("%g is not a ratio between 0 and 1", c.Tracing.SamplerArg))
+	}
+	for _, p := range c.Tracing.Propagators {
+		check("tracing.propagators", "OTEL_PROPAGATORS", oneOf(strings.ToLower(p), "tracecontext", "baggage", "b3", "b3multi", "none"))
+	}
+	if strings.EqualFold(c.Tracing.Exporter, "otlp") && c.Tracing.OTLP.Endpoint == "" {
+		check("tracing.otlp.endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", errors.New("required by the otlp exporter"))
+	}
+	check("tracing.otlp.protocol", "OTEL_EXPORTER_OTLP_PROTOCOL", oneOf(c.Tracing.OTLP.Protocol, "grpc", "http/protobuf"))
+	if _, err := c.Tracing.OTLP.HeaderMap(); err != nil {
+		check("tracing.otlp.headers", "OTEL_EXPORTER_OTLP_HEADERS", err)
+	}
+
+	check("readiness.tcp_checks", "READINESS_TCP_CHECKS", namedTargets(c.Readiness.TCPChecks))
+	check("readiness.http_checks", "READINESS_HTTP_CHECKS", namedTargets(c.Readiness.HTTPChecks))
+	check("readiness.check_timeout", "READINESS_CHECK_TIMEOUT", positive(c.Readiness.CheckTimeout))
+	check("readiness.otlp_check", "READINESS_OTLP_CHECK", oneOf(c.Readiness.OTLPCheck, "critical", "optional", "off"))
+
+	check("openapi.validation", "OPENAPI_VALIDATION", oneOf(c.OpenAPI.Validation, "request", "debug", "off"))
+	if c.OpenAPI.MaxRequestBodyBytes <= 0 {
+		check("openapi.max_request_body_bytes", "MAX_REQUEST_BODY_BYTES", errors.New("must be positive"))
+	}
+
+	check("faults.readiness_flap", "FAULT_READINESS_FLAP", nonNegative(c.Faults.ReadinessFlap))
+
+	check("shutdown.pre_stop_delay", "SHUTDOWN_PRE_STOP_DELAY", nonNegative(c.Shutdown.PreStopDelay))
+	check("shutdown.drain_timeout", "SHUTDOWN_DRAIN_TIMEOUT", nonNegative(c.Shutdown.DrainTimeout))
+	check("shutdown.flush_timeout", "SHUTDOWN_FLUSH_TIMEOUT", nonNegative(c.Shutdown.FlushTimeout))
+
+	return errors.Join(errs...)
+}
+
+// HeaderMap parses Headers, comma-separated key=value pairs as in
+// OTEL_EXPORTER_OTLP_HEADERS
+func (o OTLP) HeaderMap() (map[string]string, error) {
+	headers := map[string]string{}
+	for _, item := range strings.Split(o.Headers.Value(), ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			// Never echo the item, it is likely to hold a token
+			return nil, errors.New("expected comma-separated key=value pairs")
+		}
+		headers[k] = strings.TrimSpace(v)
+	}
+	return headers, nil
+}
+
+func oneOf(value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not one of %s", value, strings.Join(allowed, ", "))
+}
+
+func positive(d Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s is not positive", d)
+	}
+	return nil
+}
+
+func nonNegative(d Duration) error {
+	if d < 0 {
+		return fmt.Errorf("%s is negative", d)
+	}
+	return nil
+}
+
+func namedTargets(items []string) error {
+	for _, item := range items {
+		name, target, ok := strings.Cut(item, "=")
+		if !ok || name == "" || target == "" {
+			return fmt.Errorf("expected name=target, got %q", item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// env is a lookupEnv over a fixed set of variables
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestDefault(t *testing.T) {
+	cfg, err := Load(nil, env(nil), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+
+	assert.Equal(t, ":8080", cfg.Server.ListenAddr)
+	assert.Equal(t, Duration(15*time.Second), cfg.Server.ReadTimeout)
+	assert.Equal(t, Duration(15*time.Second), cfg.Server.WriteTimeout)
+	assert.Equal(t, Duration(60*time.Second), cfg.Server.IdleTimeout)
+	assert.Equal(t, "otel-collector.observability.svc.cluster.local:4317", cfg.Tracing.OTLP.Endpoint)
+	assert.False(t, cfg.Faults.Enabled)
+	assert.False(t, cfg.Debug.ConfigEndpoint)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  listen_addr: ":9000"
+  read_timeout: 5s
+log:
+  level: debug
+tracing:
+  propagators: [tracecontext, b3multi]
+faults:
+  enabled: true
+  rules: "/api/v1/hello=latency=200ms"
+`)
+	cfg, err := Load(
+		[]string{"-config", path, "-listen-addr", ":9100"},
+		env(map[string]string{"LOG_LEVEL": "warn", "SERVER_READ_TIMEOUT": ""}),
+		io.Discard,
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, ":9100", cfg.Server.ListenAddr, "flag over file")
+	assert.Equal(t, "warn", cfg.Log.Level, "environment over file")
+	assert.Equal(t, Duration(5*time.Second), cfg.Server.ReadTimeout, "empty variables are unset")
+	assert.Equal(t, Duration(15*time.Second), cfg.Server.WriteTimeout, "default")
+	assert.Equal(t, []string{"tracecontext", "b3multi"}, cfg.Tracing.Propagators)
+	assert.True(t, cfg.Faults.Enabled)
+	assert.Equal(t, "/api/v1/hello=latency=200ms", cfg.Faults.Rules)
+}
+
+func TestLoadFileFromEnv(t *testing.T) {
+	path := writeFile(t, "debug:\n  config_endpoint: true\n")
+	cfg, err := Load(nil, env(map[string]string{FileEnv: path}), io.Discard)
+	require.NoError(t, err)
+	assert.True(t, cfg.Debug.ConfigEndpoint)
+
+	_, err = Load(nil, env(map[string]string{FileEnv: filepath.Join(t.TempDir(), "missing.yaml")}), io.Discard)
+	assert.ErrorContains(t, err, "reading config file")
+
+	_, err = Load(nil, env(map[string]string{FileEnv: writeFile(t, "server:\n  listen_adr: \":9000\"\n")}), io.Discard)
+	assert.ErrorContains(t, err, "listen_adr", "unknown keys are errors")
+}
+
+func TestLoadEnv(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{
+		"FAULT_INJECTION":                    "on",
+		"FAULT_READINESS_FLAP":               "30s",
+		"OTEL_PROPAGATORS":                   " tracecontext, ,baggage,b3 ",
+		"OTEL_TRACES_SAMPLER_ARG":            "0.1",
+		"OTEL_EXPORTER_OTLP_INSECURE":        "false",
+		"OTEL_EXPORTER_OTLP_PROTOCOL":        "grpc",
+		"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "http/protobuf",
+		"MAX_REQUEST_BODY_BYTES":             "16",
+		"READINESS_TCP_CHECKS":               "db=postgres:5432,cache=redis:6379",
+	}), io.Discard)
+	require.NoError(t, err)
+
+	assert.True(t, cfg.Faults.Enabled)
+	assert.Equal(t, Duration(30*time.Second), cfg.Faults.ReadinessFlap)
+	assert.Equal(t, []string{"tracecontext", "baggage", "b3"}, cfg.Tracing.Propagators)
+	assert.Equal(t, 0.1, cfg.Tracing.SamplerArg)
+	require.NotNil(t, cfg.Tracing.OTLP.Insecure)
+	assert.False(t, *cfg.Tracing.OTLP.Insecure)
+	assert.Equal(t, "http/protobuf", cfg.Tracing.OTLP.Protocol, "traces-specific variable first")
+	assert.Equal(t, int64(16), cfg.OpenAPI.MaxRequestBodyBytes)
+	assert.Equal(t, []string{"db=postgres:5432", "cache=redis:6379"}, cfg.Readiness.TCPChecks)
+
+	for key, value := range map[string]string{
+		"FAULT_INJECTION":         "yes",
+		"SERVER_IDLE_TIMEOUT":     "soon",
+		"MAX_REQUEST_BODY_BYTES":  "1MiB",
+		"OTEL_TRACES_SAMPLER_ARG": "half",
+	} {
+		_, err := Load(nil, env(map[string]string{key: value}), io.Discard)
+		assert.ErrorContains(t, err, key, value)
+	}
+}
+
+func TestLoadOTLPEndpoint(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf"}), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "otel-collector.observability.svc.cluster.local:4318", cfg.Tracing.OTLP.Endpoint, "the default port follows the protocol")
+
+	cfg, err = Load([]string{"-otlp-endpoint", "collector:4317"}, env(map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf"}), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "collector:4317", cfg.Tracing.OTLP.Endpoint, "a set endpoint is kept")
+}
+
+func TestLoadFlags(t *testing.T) {
+	var usage bytes.Buffer
+	_, err := Load([]string{"-h"}, env(nil), &usage)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.Contains(t, usage.String(), "-listen-addr")
+	assert.Contains(t, usage.String(), "env LISTEN_ADDR, default :8080")
+
+	_, err = Load([]string{"-read-timeout", "fast"}, env(nil), io.Discard)
+	assert.ErrorContains(t, err, "-read-timeout")
+
+	_, err = Load([]string{"extra"}, env(nil), io.Discard)
+	assert.ErrorContains(t, err, "unexpected arguments")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.ListenAddr = "8080"
+	cfg.Server.WriteTimeout = 0
+	cfg.Log.Level = "verbose"
+	cfg.Tracing.SamplerArg = 2
+	cfg.Tracing.Propagators = []string{"jaeger"}
+	cfg.Tracing.OTLP.Protocol = "http/json"
+	cfg.Tracing.OTLP.Headers = "token"
+	cfg.Readiness.HTTPChecks = []string{"http://api"}
+	cfg.OpenAPI.Validation = "strict"
+	cfg.Shutdown.DrainTimeout = Duration(-time.Second)
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, key := range []string{
+		"server.listen_addr (LISTEN_ADDR)",
+		"server.write_timeout (SERVER_WRITE_TIMEOUT)",
+		"log.level (LOG_LEVEL)",
+		"tracing.sampler_arg (OTEL_TRACES_SAMPLER_ARG)",
+		"tracing.propagators (OTEL_PROPAGATORS)",
+		"tracing.otlp.protocol (OTEL_EXPORTER_OTLP_PROTOCOL)",
+		"tracing.otlp.headers (OTEL_EXPORTER_OTLP_HEADERS)",
+		"readiness.http_checks (READINESS_HTTP_CHECKS)",
+		"openapi.validation (OPENAPI_VALIDATION)",
+		"shutdown.drain_timeout (SHUTDOWN_DRAIN_TIMEOUT)",
+	} {
+		assert.ErrorContains(t, err, key)
+	}
+	assert.NotContains(t, err.Error(), "token", "secrets are not echoed")
+
+	cfg = Default()
+	cfg.Tracing.Exporter = "Console"
+	cfg.Log.Format = "LOGFMT"
+	assert.NoError(t, cfg.Validate(), "names are case-insensitive where the SDK's are")
+}
+
+func TestSecretRedacted(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "authorization=Bearer s3cr3t, x-tenant = lab"}), io.Discard)
+	require.NoError(t, err)
+
+	headers, err := cfg.Tracing.OTLP.HeaderMap()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer s3cr3t", "x-tenant": "lab"}, headers)
+
+	body, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "s3cr3t")
+	assert.Contains(t, string(body), `"headers":"[REDACTED]"`)
+	assert.Contains(t, string(body), `"read_timeout":"15s"`)
+
+	for name, h := range map[string]func(w io.Writer) slog.Handler{
+		"json":   func(w io.Writer) slog.Handler { return slog.NewJSONHandler(w, nil) },
+		"logfmt": func(w io.Writer) slog.Handler { return slog.NewTextHandler(w, nil) },
+	} {
+		var out bytes.Buffer
+		slog.New(h(&out)).Info("Effective configuration", "config", cfg)
+		assert.NotContains(t, out.String(), "s3cr3t", name)
+		assert.Contains(t, out.String(), "[REDACTED]", name)
+		assert.Contains(t, out.String(), "15s", name)
+	}
+
+	assert.NotContains(t, fmt.Sprintf("%v %+v", cfg.Tracing.OTLP, *cfg), "s3cr3t")
+	assert.Empty(t, Secret("").String(), "an unset secret prints empty")
+}
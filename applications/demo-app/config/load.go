@@ -0,0 +1,197 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/invopop/yaml"
+)
+
+// FileEnv names the YAML file when the -config flag is not given
+const FileEnv = "CONFIG_FILE"
+
+// Load builds the configuration from, in increasing precedence, Default, the
+// YAML file named by -config or CONFIG_FILE, the environment and the flags
+// in args, and validates it. Unknown YAML keys are errors, so a typo in a
+// ConfigMap does not go unnoticed. Flag errors and -h print to output.
+func Load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (*Config, error) {
+	cfg := defaults()
+	fields := settings(reflect.ValueOf(cfg).Elem())
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(output)
+	file := fs.String("config", "", "YAML configuration file (env "+FileEnv+")")
+	flags := map[string]string{}
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		name := f.flag
+		usage := fmt.Sprintf("%s (env %s)", f.usage, f.env[0])
+		if def := f.format(); def != "" {
+			usage = fmt.Sprintf("%s (env %s, default %s)", f.usage, f.env[0], def)
+		}
+		fs.Func(name, usage, func(s string) error {
+			flags[name] = s
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	path := *file
+	if path == "" {
+		path, _ = lookupEnv(FileEnv)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		strict := func(d *json.Decoder) *json.Decoder {
+			d.DisallowUnknownFields()
+			return d
+		}
+		if err := yaml.Unmarshal(data, cfg, strict); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	for _, f := range fields {
+		for _, env := range f.env {
+			if v, ok := lookupEnv(env); ok && v != "" {
+				if err := f.set(v); err != nil {
+					return nil, fmt.Errorf("%s: %w", env, err)
+				}
+				break
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := flags[f.flag]; ok {
+			if err := f.set(v); err != nil {
+				return nil, fmt.Errorf("-%s: %w", f.flag, err)
+			}
+		}
+	}
+
+	cfg.complete()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// setting is one leaf field of Config and where it can be set from
+type setting struct {
+	value reflect.Value
+	env   []string
+	flag  string
+	usage string
+}
+
+func settings(v reflect.Value) []setting {
+	var fields []setting
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf, f := t.Field(i), v.Field(i)
+		env := sf.Tag.Get("env")
+		if env == "" {
+			if f.Kind() == reflect.Struct {
+				fields = append(fields, settings(f)...)
+			}
+			continue
+		}
+		fields = append(fields, setting{
+			value: f,
+			env:   strings.Split(env, ","),
+			flag:  sf.Tag.Get("flag"),
+			usage: sf.Tag.Get("usage"),
+		})
+	}
+	return fields
+}
+
+// set parses s the way the environment variable has always been read
+func (f setting) set(s string) error {
+	v := f.value
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := parseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Pointer:
+		b, err := parseBool(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(&b))
+	case reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		panic("config: unsupported field type " + v.Type().String())
+	}
+	return nil
+}
+
+// format prints the field's current value for the flag usage
+func (f setting) format() string {
+	if s, ok := f.value.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// parseBool accepts on and off besides the strconv forms, as
+// FAULT_INJECTION always has
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%q is not on, off, true or false", s)
+	}
+	return b, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a string such as "15s" in YAML,
+// JSON and the environment
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// redacted replaces a Secret wherever it is printed
+const redacted = "[REDACTED]"
+
+// Secret is a setting that must not be logged or served. It prints and
+// marshals as [REDACTED] when set; Value returns what it holds.
+type Secret string
+
+func (s Secret) Value() string { return string(s) }
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Secret) UnmarshalText(text []byte) error {
+	*s = Secret(text)
+	return nil
+}
+
+// LogValue groups the settings by section, with durations and secrets in
+// their printed form, so the JSON and logfmt handlers both log the
+// effective configuration without secrets
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(logAttrs(reflect.ValueOf(c).Elem())...)
+}
+
+func logAttrs(v reflect.Value) []slog.Attr {
+	var attrs []slog.Attr
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		f := v.Field(i)
+		switch {
+		case f.Kind() == reflect.Struct:
+			attrs = append(attrs, slog.Attr{Key: name, Value: slog.GroupValue(logAttrs(f)...)})
+		case f.Kind() == reflect.Pointer:
+			if !f.IsNil() {
+				attrs = append(attrs, slog.Any(name, f.Elem().Interface()))
+			}
+		case f.Type().Implements(stringerType):
+			attrs = append(attrs, slog.String(name, f.Interface().(interface{ String() string }).String()))
+		default:
+			attrs = append(attrs, slog.Any(name, f.Interface()))
+		}
+	}
+	return attrs
+}
+
+var stringerType = reflect.TypeOf((*interface{ String() string })(nil)).Elem()
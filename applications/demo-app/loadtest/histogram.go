@@ -0,0 +1,155 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// subBucketBits sets the precision of Histogram: values are kept exactly
+// below 2^subBucketBits microseconds and within 1/2^(subBucketBits-1),
+// three significant digits, above
+const subBucketBits = 11
+
+const (
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram records latencies in microseconds in log-linear buckets, as
+// HdrHistogram does with three significant digits: memory grows with the
+// logarithm of the largest value, not with the number of samples, and any
+// percentile is read back within 0.1%. It is not safe for concurrent use.
+type Histogram struct {
+	counts   []int64
+	total    int64
+	min, max int64
+	sum      float64
+}
+
+// NewHistogram returns an empty histogram
+func NewHistogram() *Histogram {
+	return &Histogram{min: math.MaxInt64}
+}
+
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	top := v >> shift
+	return subBucketCount + (shift-1)*subBucketHalf + int(top-subBucketHalf)
+}
+
+// highestEquivalent is the largest value that falls into bucket i
+func highestEquivalent(i int) int64 {
+	if i < subBucketCount {
+		return int64(i)
+	}
+	k := i - subBucketCount
+	shift := k/subBucketHalf + 1
+	top := int64(k%subBucketHalf + subBucketHalf)
+	return top<<shift + 1<<shift - 1
+}
+
+// Record adds one latency, rounded down to the microsecond
+func (h *Histogram) Record(d time.Duration) {
+	v := max(int64(d/time.Microsecond), 0)
+	i := bucketIndex(v)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += float64(v)
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+}
+
+// Merge adds the samples of other
+func (h *Histogram) Merge(other *Histogram) {
+	if other.total == 0 {
+		return
+	}
+	if len(other.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]int64, len(other.counts)-len(h.counts))...)
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.sum += other.sum
+	h.min = min(h.min, other.min)
+	h.max = max(h.max, other.max)
+}
+
+// Count is the number of samples
+func (h *Histogram) Count() int64 { return h.total }
+
+// Min is the smallest sample, 0 when empty
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max is the largest sample
+func (h *Histogram) Max() time.Duration { return time.Duration(h.max) * time.Microsecond }
+
+// Mean is the average sample, 0 when empty
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/float64(h.total)) * time.Microsecond
+}
+
+// Percentile returns the value below which p percent of the samples fall,
+// for p between 0 and 100, or 0 when empty
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.total)))
+	rank = min(max(rank, 1), h.total)
+
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := min(max(highestEquivalent(i), h.min), h.max)
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+// distributionPercentiles are the rows of WriteDistribution
+var distributionPercentiles = []float64{50, 75, 90, 95, 99, 99.9, 99.99, 100}
+
+// WriteDistribution writes the percentile distribution in the layout of
+// HdrHistogram's outputPercentileDistribution, in milliseconds
+func (h *Histogram) WriteDistribution(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%12s %12s %10s %14s\n", "Value(ms)", "Percentile", "TotalCount", "1/(1-Percentile)")
+	for _, p := range distributionPercentiles {
+		v := h.Percentile(p)
+		count := int64(math.Ceil(p / 100 * float64(h.total)))
+		inverse := "inf"
+		if p < 100 {
+			inverse = fmt.Sprintf("%.2f", 1/(1-p/100))
+		}
+		fmt.Fprintf(&b, "%12.3f %12.6f %10d %14s\n", millis(v), p/100, count, inverse)
+	}
+	fmt.Fprintf(&b, "#[Mean = %.3f, Max = %.3f, Total count = %d]\n", millis(h.Mean()), millis(h.Max()), h.total)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
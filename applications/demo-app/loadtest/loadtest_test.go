@@ -0,0 +1,287 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	p, err := ParseStages("2s:10, 4s:10, 2s:0")
+	require.NoError(t, err)
+	assert.Equal(t, Profile{{2 * time.Second, 10}, {4 * time.Second, 10}, {2 * time.Second, 0}}, p)
+	assert.Equal(t, 8*time.Second, p.Duration())
+	assert.Equal(t, 10, p.Max())
+
+	assert.InDelta(t, 5, p.TargetAt(time.Second), 1e-9, "ramps linearly from 0")
+	assert.InDelta(t, 10, p.TargetAt(3*time.Second), 1e-9)
+	assert.InDelta(t, 5, p.TargetAt(7*time.Second), 1e-9)
+	assert.InDelta(t, 0, p.TargetAt(time.Minute), 1e-9, "the last target holds after the end")
+
+	assert.InDelta(t, 10, p.area(2*time.Second), 1e-9, "half of 2s at 10/s")
+	assert.InDelta(t, 60, p.area(8*time.Second), 1e-9)
+
+	for _, bad := range []string{"", "10", "2s:-1", "soon:10", "2s:ten"} {
+		_, err := ParseStages(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram()
+	assert.Zero(t, h.Percentile(99))
+	assert.Zero(t, h.Min())
+
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, int64(10000), h.Count())
+	assert.Equal(t, time.Millisecond, h.Min())
+	assert.Equal(t, 10*time.Second, h.Max())
+	assert.InEpsilon(t, 5000.5, millis(h.Mean()), 1e-6)
+
+	// Three significant digits
+	for p, want := range map[float64]float64{50: 5000, 90: 9000, 99: 9900, 99.9: 9990, 100: 10000} {
+		assert.InEpsilon(t, want, millis(h.Percentile(p)), 1e-3, "p(%v)", p)
+	}
+
+	small := NewHistogram()
+	small.Record(1500 * time.Microsecond)
+	assert.Equal(t, 1500*time.Microsecond, small.Percentile(50), "exact below 2048µs")
+
+	merged := NewHistogram()
+	merged.Merge(small)
+	merged.Merge(h)
+	assert.Equal(t, int64(10001), merged.Count())
+	assert.Equal(t, 1*time.Millisecond, merged.Min())
+
+	var b strings.Builder
+	require.NoError(t, h.WriteDistribution(&b))
+	assert.Contains(t, b.String(), "Value(ms)")
+	assert.Contains(t, b.String(), "Total count = 10000")
+}
+
+func TestBucketsRoundTrip(t *testing.T) {
+	for _, v := range []int64{0, 1, 2047, 2048, 2049, 4095, 4096, 1 << 20, 1<<40 + 12345} {
+		i := bucketIndex(v)
+		upper := highestEquivalent(i)
+		assert.GreaterOrEqual(t, upper, v, "value %d", v)
+		assert.Equal(t, i, bucketIndex(upper), "value %d", v)
+		assert.LessOrEqual(t, float64(upper-v), float64(v)/subBucketHalf, "value %d", v)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	health := newScenarioStats("health", map[string]string{"scenario": "health", "tier": "probe"})
+	api := newScenarioStats("api", map[string]string{"scenario": "api"})
+	for i := 1; i <= 100; i++ {
+		health.record(time.Duration(i)*time.Millisecond, nil)
+		var err error
+		if i <= 2 {
+			err = errors.New("status 500")
+		}
+		api.record(time.Duration(10*i)*time.Millisecond, err)
+	}
+	api.Dropped = 5
+	report := &Report{Duration: 10 * time.Second, Scenarios: []*ScenarioStats{api, health}}
+
+	thresholds, err := ParseThresholds(map[string][]string{
+		"http_req_duration":                  {"p(95)<500", "p(99) < 1000", "avg<=300", "max<1000", "med>10", "min>=1"},
+		"http_req_duration{scenario:health}": {"p(95)<50"},
+		"http_req_duration{tier:probe}":      {"p(95)<100"},
+		"http_req_failed":                    {"rate<0.01"},
+		"http_req_failed{scenario:health}":   {"rate==0"},
+		"http_reqs":                          {"count>=200", "rate>100"},
+		"dropped_iterations":                 {"count<1"},
+		"http_req_duration{scenario:search}": {"p(95)<500"},
+	})
+	require.NoError(t, err)
+
+	results := map[string]ThresholdResult{}
+	for _, th := range thresholds {
+		results[th.String()] = th.Evaluate(report)
+	}
+	passed := func(key string) bool {
+		res, ok := results[key]
+		require.True(t, ok, "no threshold %s", key)
+		return res.Passed
+	}
+
+	assert.False(t, passed("http_req_duration: p(95)<500"), "p(95) of both is 905ms")
+	assert.True(t, passed("http_req_duration: p(99) < 1000"))
+	assert.True(t, passed("http_req_duration: avg<=300"))
+	assert.False(t, passed("http_req_duration{scenario:health}: p(95)<50"))
+	assert.InEpsilon(t, 95, results["http_req_duration{scenario:health}: p(95)<50"].Actual, 1e-3)
+	assert.True(t, passed("http_req_duration{tier:probe}: p(95)<100"), "any tag selects")
+	assert.False(t, passed("http_req_failed: rate<0.01"), "2 of 200 failed")
+	assert.InDelta(t, 0.01, results["http_req_failed: rate<0.01"].Actual, 1e-9)
+	assert.True(t, passed("http_req_failed{scenario:health}: rate==0"))
+	assert.True(t, passed("http_reqs: count>=200"))
+	assert.False(t, passed("http_reqs: rate>100"), "20 requests per second")
+	assert.False(t, passed("dropped_iterations: count<1"))
+	assert.False(t, passed("http_req_duration{scenario:search}: p(95)<500"), "no matching requests fails")
+
+	for key, exprs := range map[string][]string{
+		"http_req_waiting":   {"p(95)<500"},
+		"http_req_failed":    {"p(95)<1"},
+		"http_req_duration":  {"p(95)"},
+		"http_reqs{broken}":  {"count>1"},
+		"dropped_iterations": {"p(101)<1"},
+	} {
+		_, err := ParseThresholds(map[string][]string{key: exprs})
+		assert.Error(t, err, key)
+	}
+}
+
+// server answers /fast at once, /slow after delay and /fail with 500
+func server(t *testing.T, delay time.Duration) (*httptest.Server, *atomic.Int64) {
+	var inFlight, peak atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(delay)
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &peak
+}
+
+func TestClosedModel(t *testing.T) {
+	srv, peak := server(t, 20*time.Millisecond)
+
+	report, err := Test{
+		Model: Closed{Stages: Profile{{200 * time.Millisecond, 4}, {300 * time.Millisecond, 4}}},
+		Scenarios: []Scenario{
+			{Name: "fast", Weight: 3, Request: Get(srv.URL + "/fast"), Tags: map[string]string{"kind": "probe"},
+				Check: func(resp *http.Response, body []byte) error {
+					if !strings.Contains(string(body), `"ok"`) {
+						return errors.New("no status")
+					}
+					return nil
+				}},
+			{Name: "slow", Request: Get(srv.URL+"/slow", "X-Request-Id", "load"), Think: 10 * time.Millisecond},
+		},
+		Thresholds: map[string][]string{
+			"http_req_duration{scenario:slow}": {"p(50)>=20"},
+			"http_req_failed":                  {"rate==0"},
+		},
+	}.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "closed", report.Model)
+	require.Len(t, report.Scenarios, 2)
+	assert.Equal(t, "fast", report.Scenarios[0].Name, "sorted by name")
+	assert.Equal(t, map[string]string{"scenario": "fast", "kind": "probe"}, report.Scenarios[0].Tags)
+	assert.Greater(t, report.Scenarios[0].Requests, report.Scenarios[1].Requests, "weighted 3:1")
+	assert.LessOrEqual(t, peak.Load(), int64(4), "never more requests than virtual users")
+	assert.True(t, report.Passed(), report.Failures())
+}
+
+func TestOpenModel(t *testing.T) {
+	srv, _ := server(t, 200*time.Millisecond)
+
+	// 100 iterations a second for half a second against a 200ms endpoint
+	// needs about 20 in flight; 5 are allowed
+	report, err := Test{
+		Model:     Open{Stages: Profile{{0, 100}, {500 * time.Millisecond, 100}}, MaxInFlight: 5},
+		Scenarios: []Scenario{{Name: "slow", Request: Get(srv.URL + "/slow")}},
+		Thresholds: map[string][]string{
+			"dropped_iterations": {"count<1"},
+		},
+	}.Run(context.Background())
+	require.NoError(t, err)
+
+	s := report.Scenarios[0]
+	assert.Equal(t, "open", report.Model)
+	assert.InDelta(t, 50, s.Requests+s.Dropped, 2, "arrivals follow the rate, not the responses")
+	assert.Positive(t, s.Dropped)
+	assert.False(t, report.Passed())
+	require.Len(t, report.Failures(), 1)
+	assert.Contains(t, report.Failures()[0], "dropped_iterations: count<1")
+}
+
+func TestFailuresAndReports(t *testing.T) {
+	srv, _ := server(t, 0)
+
+	report, err := Test{
+		Model:      Open{Stages: Profile{{200 * time.Millisecond, 50}}},
+		Scenarios:  []Scenario{{Name: "fail", Request: Get(srv.URL + "/fail")}},
+		Thresholds: map[string][]string{"http_req_failed": {"rate<0.01"}},
+	}.Run(context.Background())
+	require.NoError(t, err)
+
+	s := report.Scenarios[0]
+	require.Positive(t, s.Requests)
+	assert.Equal(t, s.Requests, s.Failed)
+	assert.Equal(t, map[string]int64{"status 500": s.Failed}, s.Errors)
+
+	var text strings.Builder
+	require.NoError(t, report.WriteText(&text))
+	assert.Contains(t, text.String(), "open model")
+	assert.Contains(t, text.String(), "× status 500")
+	assert.Contains(t, text.String(), "✗ http_req_failed: rate<0.01 (actual 100.00%)")
+
+	var doc struct {
+		Passed    bool `json:"passed"`
+		Scenarios []struct {
+			Name     string `json:"name"`
+			Requests int64  `json:"requests"`
+		} `json:"scenarios"`
+	}
+	var js strings.Builder
+	require.NoError(t, report.WriteJSON(&js))
+	require.NoError(t, json.Unmarshal([]byte(js.String()), &doc))
+	assert.False(t, doc.Passed)
+	require.Len(t, doc.Scenarios, 2)
+	assert.Equal(t, "all", doc.Scenarios[1].Name)
+	assert.Equal(t, s.Requests, doc.Scenarios[1].Requests)
+}
+
+func TestGracefulStop(t *testing.T) {
+	srv, _ := server(t, time.Second)
+
+	start := time.Now()
+	report, err := Test{
+		Model:        Closed{Stages: Profile{{50 * time.Millisecond, 2}}},
+		Scenarios:    []Scenario{{Name: "slow", Request: Get(srv.URL + "/slow")}},
+		GracefulStop: 100 * time.Millisecond,
+	}.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Less(t, time.Since(start), 900*time.Millisecond, "requests are canceled after the graceful stop")
+	assert.Zero(t, report.Scenarios[0].Requests, "interrupted iterations are not recorded")
+}
+
+func TestInvalidTests(t *testing.T) {
+	get := Get("http://localhost")
+	for name, test := range map[string]Test{
+		"NoModel":      {Scenarios: []Scenario{{Name: "a", Request: get}}},
+		"NoStages":     {Model: Closed{}, Scenarios: []Scenario{{Name: "a", Request: get}}},
+		"NoScenarios":  {Model: Closed{Stages: Profile{{time.Second, 1}}}},
+		"NoRequest":    {Model: Closed{Stages: Profile{{time.Second, 1}}}, Scenarios: []Scenario{{Name: "a"}}},
+		"Duplicate":    {Model: Closed{Stages: Profile{{time.Second, 1}}}, Scenarios: []Scenario{{Name: "a", Request: get}, {Name: "a", Request: get}}},
+		"BadThreshold": {Model: Closed{Stages: Profile{{time.Second, 1}}}, Scenarios: []Scenario{{Name: "a", Request: get}}, Thresholds: map[string][]string{"http_req_duration": {"p95<1"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := test.Run(context.Background())
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxErrorKinds bounds the distinct error messages kept per scenario
+const maxErrorKinds = 20
+
+// ScenarioStats are the results of one scenario
+type ScenarioStats struct {
+	Name string
+	// Tags are the scenario's tags, including scenario=Name
+	Tags     map[string]string
+	Requests int64
+	Failed   int64
+	Dropped  int64
+	Latency  *Histogram
+	// Errors counts the failures by message
+	Errors map[string]int64
+}
+
+func newScenarioStats(name string, tags map[string]string) *ScenarioStats {
+	return &ScenarioStats{Name: name, Tags: tags, Latency: NewHistogram(), Errors: map[string]int64{}}
+}
+
+func (s *ScenarioStats) record(d time.Duration, err error) {
+	s.Requests++
+	s.Latency.Record(d)
+	if err == nil {
+		return
+	}
+	s.Failed++
+	msg := err.Error()
+	if _, ok := s.Errors[msg]; ok || len(s.Errors) < maxErrorKinds {
+		s.Errors[msg]++
+	}
+}
+
+func (s *ScenarioStats) merge(other *ScenarioStats) {
+	s.Requests += other.Requests
+	s.Failed += other.Failed
+	s.Dropped += other.Dropped
+	s.Latency.Merge(other.Latency)
+	for msg, n := range other.Errors {
+		s.Errors[msg] += n
+	}
+}
+
+// Report is the outcome of a load test
+type Report struct {
+	// Model is "closed" or "open"
+	Model    string
+	Duration time.Duration
+	// Scenarios are sorted by name
+	Scenarios  []*ScenarioStats
+	Thresholds []ThresholdResult
+}
+
+// Select merges the scenarios whose tags include all of tags
+func (r *Report) Select(tags map[string]string) *ScenarioStats {
+	merged := newScenarioStats(formatSeries("all", tags), tags)
+	for _, s := range r.Scenarios {
+		match := true
+		for name, value := range tags {
+			match = match && s.Tags[name] == value
+		}
+		if match {
+			merged.merge(s)
+		}
+	}
+	return merged
+}
+
+// Passed reports whether every threshold held
+func (r *Report) Passed() bool {
+	for _, t := range r.Thresholds {
+		if !t.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Failures lists the thresholds that did not hold
+func (r *Report) Failures() []string {
+	var out []string
+	for _, t := range r.Thresholds {
+		if !t.Passed {
+			out = append(out, fmt.Sprintf("%s (actual %s)", t, t.formatActual()))
+		}
+	}
+	return out
+}
+
+func (t ThresholdResult) formatActual() string {
+	if t.Metric == MetricFailed {
+		return fmt.Sprintf("%.2f%%", 100*t.Actual)
+	}
+	return fmt.Sprintf("%.3f", t.Actual)
+}
+
+// WriteText writes a summary in the spirit of k6's end-of-test output: one
+// latency row per scenario and overall, then the thresholds
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s model, %s\n\n", r.Model, r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "%-12s %8s %8s %9s %9s %9s %9s %9s %9s %8s\n",
+		"scenario", "reqs", "req/s", "avg", "med", "p(90)", "p(95)", "p(99)", "max", "failed")
+
+	rows := append([]*ScenarioStats(nil), r.Scenarios...)
+	rows = append(rows, r.Select(nil))
+	for _, s := range rows {
+		rate := 0.0
+		if r.Duration > 0 {
+			rate = float64(s.Requests) / r.Duration.Seconds()
+		}
+		failed := 0.0
+		if s.Requests > 0 {
+			failed = 100 * float64(s.Failed) / float64(s.Requests)
+		}
+		h := s.Latency
+		fmt.Fprintf(&b, "%-12s %8d %8.1f %9s %9s %9s %9s %9s %9s %7.2f%%\n",
+			s.Name, s.Requests, rate, ms(h.Mean()), ms(h.Percentile(50)), ms(h.Percentile(90)),
+			ms(h.Percentile(95)), ms(h.Percentile(99)), ms(h.Max()), failed)
+	}
+
+	for _, s := range r.Scenarios {
+		if s.Dropped > 0 {
+			fmt.Fprintf(&b, "\n%s: %d dropped iterations", s.Name, s.Dropped)
+		}
+		for _, msg := range sortedKeys(s.Errors) {
+			fmt.Fprintf(&b, "\n%s: %d× %s", s.Name, s.Errors[msg], msg)
+		}
+	}
+
+	if len(r.Thresholds) > 0 {
+		b.WriteString("\n\nthresholds:\n")
+		for _, t := range r.Thresholds {
+			mark := "✓"
+			if !t.Passed {
+				mark = "✗"
+			}
+			fmt.Fprintf(&b, "  %s %s (actual %s)\n", mark, t, t.formatActual())
+		}
+	} else {
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", millis(d))
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteJSON writes the report with latency percentiles in milliseconds,
+// for comparing runs across commits
+func (r *Report) WriteJSON(w io.Writer) error {
+	type jsonLatency struct {
+		Avg, Min, Med, P90, P95, P99, Max float64
+	}
+	type jsonScenario struct {
+		Name     string            `json:"name"`
+		Tags     map[string]string `json:"tags"`
+		Requests int64             `json:"requests"`
+		Failed   int64             `json:"failed"`
+		Dropped  int64             `json:"dropped"`
+		Latency  jsonLatency       `json:"latencyMs"`
+		Errors   map[string]int64  `json:"errors,omitempty"`
+	}
+	type jsonThreshold struct {
+		Series string  `json:"series"`
+		Expr   string  `json:"expr"`
+		Actual float64 `json:"actual"`
+		Passed bool    `json:"passed"`
+	}
+	doc := struct {
+		Model      string          `json:"model"`
+		Seconds    float64         `json:"seconds"`
+		Passed     bool            `json:"passed"`
+		Scenarios  []jsonScenario  `json:"scenarios"`
+		Thresholds []jsonThreshold `json:"thresholds"`
+	}{Model: r.Model, Seconds: r.Duration.Seconds(), Passed: r.Passed(), Thresholds: []jsonThreshold{}}
+
+	for _, s := range append(append([]*ScenarioStats(nil), r.Scenarios...), r.Select(nil)) {
+		h := s.Latency
+		doc.Scenarios = append(doc.Scenarios, jsonScenario{
+			Name: s.Name, Tags: maps.Clone(s.Tags), Requests: s.Requests, Failed: s.Failed, Dropped: s.Dropped, Errors: s.Errors,
+			Latency: jsonLatency{
+				Avg: millis(h.Mean()), Min: millis(h.Min()), Med: millis(h.Percentile(50)),
+				P90: millis(h.Percentile(90)), P95: millis(h.Percentile(95)), P99: millis(h.Percentile(99)), Max: millis(h.Max()),
+			},
+		})
+	}
+	for _, t := range r.Thresholds {
+		doc.Thresholds = append(doc.Thresholds, jsonThreshold{
+			Series: formatSeries(t.Metric, t.Tags), Expr: t.Expr, Actual: t.Actual, Passed: t.Passed,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,395 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultGracefulStop is how long iterations in progress may finish
+	// after the last stage, as k6's gracefulStop
+	DefaultGracefulStop = 30 * time.Second
+	// DefaultRequestTimeout matches k6's default request timeout
+	DefaultRequestTimeout = 60 * time.Second
+	// DefaultMaxInFlight caps the concurrent iterations of the open model
+	DefaultMaxInFlight = 100
+
+	// controlInterval is how often the closed model adjusts the number of
+	// virtual users and the open model starts the iterations that are due
+	controlInterval = 5 * time.Millisecond
+)
+
+// Scenario is one kind of iteration, picked by weight. Each iteration
+// sends one request; its latency and outcome are recorded under the
+// scenario's tags.
+type Scenario struct {
+	Name string
+	// Weight is the scenario's share of iterations; 0 counts as 1
+	Weight int
+	// Tags are added to the scenario's results, next to scenario=Name
+	Tags map[string]string
+	// Request builds the request of one iteration
+	Request func(ctx context.Context) (*http.Request, error)
+	// Check validates a response; by default any status below 400 passes
+	Check func(resp *http.Response, body []byte) error
+	// Think is the pause after each iteration in the closed model, as a
+	// k6 sleep(); the open model ignores it
+	Think time.Duration
+}
+
+// Get returns a Request function for a GET of url with the given headers
+// as name, value pairs
+func Get(url string, header ...string) func(ctx context.Context) (*http.Request, error) {
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return req, nil
+	}
+}
+
+// Model decides when iterations run: Closed or Open
+type Model interface {
+	name() string
+	profile() Profile
+	run(ctx context.Context, r *runner)
+}
+
+// Closed runs virtual users that each start their next iteration when the
+// previous one and its think time end, as k6's ramping-vus executor. The
+// stage targets are numbers of virtual users. When the server slows down,
+// so does the offered load.
+type Closed struct {
+	Stages Profile
+}
+
+// Open starts iterations at the rate of the stages, in iterations per
+// second, whether earlier ones have finished or not, as k6's
+// ramping-arrival-rate executor. Iterations that would exceed MaxInFlight
+// are dropped and counted. The offered load does not back off when the
+// server slows down, which exposes queueing that Closed hides.
+type Open struct {
+	Stages Profile
+	// MaxInFlight caps the concurrent iterations, DefaultMaxInFlight if 0
+	MaxInFlight int
+}
+
+// Test is a load test
+type Test struct {
+	Model     Model
+	Scenarios []Scenario
+	// Thresholds are checked at the end, keyed as in k6, such as
+	// "http_req_duration{scenario:health}": {"p(95)<100"}
+	Thresholds map[string][]string
+	// Client sends the requests; by default one with a connection pool
+	// sized for the test and DefaultRequestTimeout
+	Client *http.Client
+	// GracefulStop is DefaultGracefulStop if 0
+	GracefulStop time.Duration
+}
+
+// Run runs the test until its last stage ends, or ctx is done, and returns
+// the report with the thresholds evaluated. It fails only when the test is
+// invalid; failed thresholds are in the report.
+func (t Test) Run(ctx context.Context) (*Report, error) {
+	if t.Model == nil {
+		return nil, errors.New("no model")
+	}
+	if len(t.Model.profile()) == 0 {
+		return nil, errors.New("no stages")
+	}
+	if len(t.Scenarios) == 0 {
+		return nil, errors.New("no scenarios")
+	}
+	thresholds, err := ParseThresholds(t.Thresholds)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &runner{test: t, client: t.Client, stopping: make(chan struct{})}
+	if r.client == nil {
+		r.client = newClient(t.Model)
+	}
+	names := map[string]bool{}
+	for _, s := range t.Scenarios {
+		if s.Name == "" || s.Request == nil {
+			return nil, errors.New("scenarios need a name and a request")
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("scenario %s is defined twice", s.Name)
+		}
+		names[s.Name] = true
+
+		tags := maps.Clone(s.Tags)
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		tags["scenario"] = s.Name
+		r.stats = append(r.stats, newScenarioStats(s.Name, tags))
+		r.totalWeight += weight(s)
+	}
+
+	grace := t.GracefulStop
+	if grace == 0 {
+		grace = DefaultGracefulStop
+	}
+	var cancel context.CancelFunc
+	r.iterCtx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	t.Model.run(ctx, r)
+	close(r.stopping)
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(grace):
+		cancel()
+		<-done
+	}
+
+	report := &Report{Model: t.Model.name(), Duration: time.Since(start), Scenarios: r.stats}
+	sort.Slice(report.Scenarios, func(i, j int) bool { return report.Scenarios[i].Name < report.Scenarios[j].Name })
+	for _, th := range thresholds {
+		report.Thresholds = append(report.Thresholds, th.Evaluate(report))
+	}
+	return report, nil
+}
+
+func weight(s Scenario) int {
+	return max(s.Weight, 1)
+}
+
+// newClient returns a client whose pool keeps a connection per concurrent
+// iteration, so the test measures the server rather than connection setup
+func newClient(m Model) *http.Client {
+	conns := DefaultMaxInFlight
+	switch m := m.(type) {
+	case Closed:
+		conns = m.Stages.Max()
+	case Open:
+		conns = m.maxInFlight()
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = max(conns, transport.MaxIdleConns)
+	transport.MaxIdleConnsPerHost = max(conns, 1)
+	return &http.Client{Transport: transport, Timeout: DefaultRequestTimeout}
+}
+
+// runner runs the iterations of a test and records their results
+type runner struct {
+	test        Test
+	client      *http.Client
+	totalWeight int
+
+	// iterCtx is the context of the requests, canceled when the graceful
+	// stop runs out
+	iterCtx context.Context
+	// stopping is closed when the last stage ends
+	stopping chan struct{}
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	stats []*ScenarioStats
+}
+
+// pick returns the index of a scenario, at random by weight
+func (r *runner) pick() int {
+	n := rand.IntN(r.totalWeight)
+	for i, s := range r.test.Scenarios {
+		if n -= weight(s); n < 0 {
+			return i
+		}
+	}
+	return len(r.test.Scenarios) - 1
+}
+
+// iterate runs one iteration of scenario i. Iterations interrupted by the
+// end of the graceful stop are not recorded.
+func (r *runner) iterate(i int) {
+	s := r.test.Scenarios[i]
+	req, err := s.Request(r.iterCtx)
+	if err != nil {
+		r.record(i, 0, fmt.Errorf("building request: %w", err), false)
+		return
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err == nil {
+		var body []byte
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			err = check(s, resp, body)
+		}
+	}
+	elapsed := time.Since(start)
+
+	if err != nil && r.iterCtx.Err() != nil {
+		return
+	}
+	r.record(i, elapsed, err, true)
+}
+
+func check(s Scenario, resp *http.Response, body []byte) error {
+	if s.Check != nil {
+		return s.Check(resp, body)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (r *runner) record(i int, elapsed time.Duration, err error, sent bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stats[i]
+	if sent {
+		s.record(elapsed, err)
+		return
+	}
+	s.Requests++
+	s.Failed++
+	s.Errors[err.Error()]++
+}
+
+func (r *runner) drop(i int) {
+	r.mu.Lock()
+	r.stats[i].Dropped++
+	r.mu.Unlock()
+}
+
+// sleep waits for d, or until the test stops
+func (r *runner) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.stopping:
+	case <-r.iterCtx.Done():
+	}
+}
+
+func (Closed) name() string       { return "closed" }
+func (c Closed) profile() Profile { return c.Stages }
+
+func (c Closed) run(ctx context.Context, r *runner) {
+	var (
+		active  atomic.Int64
+		mu      sync.Mutex
+		running []bool
+	)
+	vu := func(i int) {
+		defer r.wg.Done()
+		defer func() {
+			mu.Lock()
+			running[i] = false
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil && int64(i) < active.Load() {
+			s := r.pick()
+			r.iterate(s)
+			r.sleep(r.test.Scenarios[s].Think)
+		}
+	}
+
+	ticker := time.NewTicker(controlInterval)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= c.Stages.Duration() || ctx.Err() != nil {
+			break
+		}
+
+		target := int(math.Round(c.Stages.TargetAt(elapsed)))
+		active.Store(int64(target))
+		mu.Lock()
+		for len(running) < target {
+			running = append(running, false)
+		}
+		for i := range target {
+			if !running[i] {
+				running[i] = true
+				r.wg.Add(1)
+				go vu(i)
+			}
+		}
+		mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	// Virtual users finish the iteration in progress and stop
+	active.Store(0)
+}
+
+func (Open) name() string       { return "open" }
+func (o Open) profile() Profile { return o.Stages }
+
+func (o Open) maxInFlight() int {
+	if o.MaxInFlight > 0 {
+		return o.MaxInFlight
+	}
+	return DefaultMaxInFlight
+}
+
+func (o Open) run(ctx context.Context, r *runner) {
+	slots := make(chan struct{}, o.maxInFlight())
+	ticker := time.NewTicker(controlInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	started := 0
+	for {
+		elapsed := min(time.Since(start), o.Stages.Duration())
+		for due := int(math.Floor(o.Stages.area(elapsed))); started < due; started++ {
+			i := r.pick()
+			select {
+			case slots <- struct{}{}:
+				r.wg.Add(1)
+				go func() {
+					defer r.wg.Done()
+					r.iterate(i)
+					<-slots
+				}()
+			default:
+				r.drop(i)
+			}
+		}
+		if elapsed >= o.Stages.Duration() || ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
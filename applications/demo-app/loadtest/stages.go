@@ -0,0 +1,104 @@
+// Package loadtest generates HTTP load in the style of k6: staged ramp
+// profiles, closed (virtual user) and open (arrival rate) models, weighted
+// scenarios with tags, HDR latency histograms and k6 threshold expressions
+// such as "p(95)<500". It runs inside `go test`, against an httptest server
+// or a deployed instance.
+package loadtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stage ramps the target linearly from the previous stage's target, or 0,
+// to Target over Duration, like an entry of k6 options.stages. The target
+// is a number of virtual users in the closed model and iterations per
+// second in the open one.
+type Stage struct {
+	Duration time.Duration
+	Target   int
+}
+
+// Profile is a sequence of stages
+type Profile []Stage
+
+// ParseStages parses a comma-separated profile such as "30s:10,1m:10,10s:0",
+// each entry a duration and a target
+func ParseStages(s string) (Profile, error) {
+	var p Profile
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		duration, target, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("stage %q: want duration:target", entry)
+		}
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", entry, err)
+		}
+		n, err := strconv.Atoi(target)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("stage %q: target must be a non-negative integer", entry)
+		}
+		p = append(p, Stage{Duration: d, Target: n})
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("no stages in %q", s)
+	}
+	return p, nil
+}
+
+// Duration is the total length of the profile
+func (p Profile) Duration() time.Duration {
+	var total time.Duration
+	for _, s := range p {
+		total += s.Duration
+	}
+	return total
+}
+
+// Max is the highest target of the profile
+func (p Profile) Max() int {
+	highest := 0
+	for _, s := range p {
+		highest = max(highest, s.Target)
+	}
+	return highest
+}
+
+// TargetAt is the target elapsed into the profile, and the last stage's
+// target once it has ended
+func (p Profile) TargetAt(elapsed time.Duration) float64 {
+	from := 0.0
+	for _, s := range p {
+		to := float64(s.Target)
+		if elapsed < s.Duration {
+			return from + (to-from)*float64(elapsed)/float64(s.Duration)
+		}
+		elapsed -= s.Duration
+		from = to
+	}
+	return from
+}
+
+// area is the integral of the target over the first elapsed of the
+// profile: the number of iterations the open model has started by then
+func (p Profile) area(elapsed time.Duration) float64 {
+	total, from := 0.0, 0.0
+	for _, s := range p {
+		to := float64(s.Target)
+		if elapsed < s.Duration {
+			at := from + (to-from)*float64(elapsed)/float64(s.Duration)
+			return total + (from+at)/2*elapsed.Seconds()
+		}
+		total += (from + to) / 2 * s.Duration.Seconds()
+		elapsed -= s.Duration
+		from = to
+	}
+	return total
+}
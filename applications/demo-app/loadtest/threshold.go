@@ -0,0 +1,219 @@
+package loadtest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metrics that thresholds can refer to, named as in k6
+const (
+	// MetricDuration is the request latency in milliseconds: avg, min,
+	// med, max and p(N)
+	MetricDuration = "http_req_duration"
+	// MetricFailed is the share of failed requests: rate
+	MetricFailed = "http_req_failed"
+	// MetricRequests is the number of requests: count, and rate per second
+	MetricRequests = "http_reqs"
+	// MetricDropped is the number of iterations the open model could not
+	// start because MaxInFlight were running: count, and rate per second
+	MetricDropped = "dropped_iterations"
+)
+
+// aggregations lists the aggregations each metric supports; "p" is p(N)
+var aggregations = map[string][]string{
+	MetricDuration: {"avg", "min", "med", "max", "p"},
+	MetricFailed:   {"rate"},
+	MetricRequests: {"count", "rate"},
+	MetricDropped:  {"count", "rate"},
+}
+
+// Threshold is one k6 threshold expression, such as p(95)<500 on
+// http_req_duration{scenario:health}
+type Threshold struct {
+	Metric string
+	// Tags select the scenarios the threshold applies to; all when empty
+	Tags map[string]string
+	Expr string
+
+	aggregation string
+	percentile  float64
+	op          string
+	value       float64
+}
+
+func (t Threshold) String() string {
+	return formatSeries(t.Metric, t.Tags) + ": " + t.Expr
+}
+
+var (
+	thresholdExpr = regexp.MustCompile(`^\s*(avg|min|med|max|count|rate|p\(\s*([0-9.]+)\s*\))\s*(<=|>=|==|!=|<|>)\s*(-?[0-9.]+)\s*$`)
+	seriesKey     = regexp.MustCompile(`^([a-z_]+)(?:\{([^}]*)\})?$`)
+)
+
+// ParseThresholds parses thresholds written as in k6 options.thresholds:
+// keys are a metric with an optional {tag:value,...} filter, values the
+// expressions that must hold for it
+func ParseThresholds(thresholds map[string][]string) ([]Threshold, error) {
+	keys := make([]string, 0, len(thresholds))
+	for key := range thresholds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out []Threshold
+	for _, key := range keys {
+		metric, tags, err := parseSeries(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, expr := range thresholds[key] {
+			t, err := parseThreshold(metric, tags, expr)
+			if err != nil {
+				return nil, fmt.Errorf("threshold %s %q: %w", key, expr, err)
+			}
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func parseSeries(key string) (string, map[string]string, error) {
+	m := seriesKey.FindStringSubmatch(strings.TrimSpace(key))
+	if m == nil {
+		return "", nil, fmt.Errorf("threshold %q: want metric or metric{tag:value}", key)
+	}
+	if _, ok := aggregations[m[1]]; !ok {
+		return "", nil, fmt.Errorf("threshold %q: unknown metric %s", key, m[1])
+	}
+
+	tags := map[string]string{}
+	for _, pair := range strings.Split(m[2], ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			return "", nil, fmt.Errorf("threshold %q: tag %q: want name:value", key, pair)
+		}
+		tags[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return m[1], tags, nil
+}
+
+func parseThreshold(metric string, tags map[string]string, expr string) (Threshold, error) {
+	m := thresholdExpr.FindStringSubmatch(expr)
+	if m == nil {
+		return Threshold{}, fmt.Errorf("want aggregation, operator and number, as in p(95)<500")
+	}
+	t := Threshold{Metric: metric, Tags: tags, Expr: strings.TrimSpace(expr), aggregation: m[1], op: m[3]}
+
+	if m[2] != "" {
+		t.aggregation = "p"
+		p, err := strconv.ParseFloat(m[2], 64)
+		if err != nil || p < 0 || p > 100 {
+			return Threshold{}, fmt.Errorf("percentile %s is not between 0 and 100", m[2])
+		}
+		t.percentile = p
+	}
+	supported := false
+	for _, agg := range aggregations[metric] {
+		supported = supported || agg == t.aggregation
+	}
+	if !supported {
+		return Threshold{}, fmt.Errorf("%s does not support %s", metric, t.aggregation)
+	}
+
+	value, err := strconv.ParseFloat(m[4], 64)
+	if err != nil {
+		return Threshold{}, err
+	}
+	t.value = value
+	return t, nil
+}
+
+// ThresholdResult is a threshold evaluated against a report
+type ThresholdResult struct {
+	Threshold
+	// Actual is the aggregated value, in milliseconds for durations
+	Actual float64
+	Passed bool
+}
+
+// Evaluate computes the threshold's aggregation over the matching
+// scenarios of r. Duration and failure thresholds fail when no request
+// matches their tags, so a misspelt tag cannot pass silently.
+func (t Threshold) Evaluate(r *Report) ThresholdResult {
+	s := r.Select(t.Tags)
+	res := ThresholdResult{Threshold: t}
+
+	switch t.Metric {
+	case MetricDuration:
+		if s.Latency.Count() == 0 {
+			return res
+		}
+		switch t.aggregation {
+		case "avg":
+			res.Actual = millis(s.Latency.Mean())
+		case "min":
+			res.Actual = millis(s.Latency.Min())
+		case "med":
+			res.Actual = millis(s.Latency.Percentile(50))
+		case "max":
+			res.Actual = millis(s.Latency.Max())
+		case "p":
+			res.Actual = millis(s.Latency.Percentile(t.percentile))
+		}
+	case MetricFailed:
+		if s.Requests == 0 {
+			return res
+		}
+		res.Actual = float64(s.Failed) / float64(s.Requests)
+	case MetricRequests, MetricDropped:
+		count := s.Requests
+		if t.Metric == MetricDropped {
+			count = s.Dropped
+		}
+		res.Actual = float64(count)
+		if t.aggregation == "rate" && r.Duration > 0 {
+			res.Actual /= r.Duration.Seconds()
+		}
+	}
+
+	res.Passed = compare(res.Actual, t.op, t.value)
+	return res
+}
+
+func compare(a float64, op string, b float64) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	default:
+		return false
+	}
+}
+
+// formatSeries writes a metric and tags as in k6, metric{name:value}
+func formatSeries(metric string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return metric
+	}
+	pairs := make([]string, 0, len(tags))
+	for name, value := range tags {
+		pairs = append(pairs, name+":"+value)
+	}
+	sort.Strings(pairs)
+	return metric + "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,10 @@
+// Package demoapp holds assets shared by the demo-app binary and its tests.
+package demoapp
+
+import _ "embed"
+
+// OpenAPISpec is the API contract in openapi.yaml, embedded so the server
+// can validate traffic against the exact spec it was built with
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Build metadata, injected at link time:
+//
+//	go build -ldflags "-X main.Version=1.2.3 -X main.Commit=abc123 -X main.BuildDate=2024-01-01T00:00:00Z"
+//
+// Empty values are filled from runtime/debug.ReadBuildInfo where possible.
+var (
+	Version   string
+	Commit    string
+	BuildDate string
+)
+
+// BuildInfo describes the binary that is actually running
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+var buildInfoMetric = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "Build information of the running binary, always 1",
+	},
+	[]string{"version", "commit", "build_date", "go_version"},
+)
+
+func init() {
+	registry.MustRegister(buildInfoMetric)
+}
+
+// recordBuildInfo sets build_info once the configuration is loaded, as the
+// version may come from it
+func recordBuildInfo() {
+	info := getBuildInfo()
+	buildInfoMetric.WithLabelValues(info.Version, info.Commit, info.BuildDate, info.GoVersion).Set(1)
+}
+
+var (
+	buildInfoOnce sync.Once
+	buildInfo     BuildInfo
+)
+
+// getBuildInfo resolves build metadata once. Link-time values win; otherwise
+// the VCS stamp embedded by the Go toolchain is used, then app.version from
+// the configuration (APP_VERSION) for the version, then "unknown".
+func getBuildInfo() BuildInfo {
+	buildInfoOnce.Do(func() {
+		buildInfo = BuildInfo{
+			Version:   Version,
+			Commit:    Commit,
+			BuildDate: BuildDate,
+			GoVersion: runtime.Version(),
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		}
+
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			// vcs.modified only describes the VCS revision, not an injected commit
+			commitFromVCS := buildInfo.Commit == ""
+			for _, s := range bi.Settings {
+				switch s.Key {
+				case "vcs.revision":
+					if buildInfo.Commit == "" {
+						buildInfo.Commit = s.Value
+					}
+				case "vcs.time":
+					if buildInfo.BuildDate == "" {
+						buildInfo.BuildDate = s.Value
+					}
+				case "vcs.modified":
+					buildInfo.Modified = commitFromVCS && s.Value == "true"
+				}
+			}
+			if buildInfo.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+				buildInfo.Version = bi.Main.Version
+			}
+		}
+
+		if buildInfo.Version == "" {
+			buildInfo.Version = appConfig.App.Version
+		}
+		if buildInfo.Version == "" {
+			buildInfo.Version = "unknown"
+		}
+		if buildInfo.Commit == "" {
+			buildInfo.Commit = "unknown"
+		}
+		if buildInfo.BuildDate == "" {
+			buildInfo.BuildDate = "unknown"
+		}
+	})
+	return buildInfo
+}
+
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, getBuildInfo())
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+// command is a demo-app subcommand; it returns the process exit code
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order they are shown in usage.
+// The first entry is the default when no subcommand is given.
+var commands = []command{
+	{"serve", "Run the HTTP server (default)", serve},
+	{"health", "Probe /health of the local instance and exit 0 or 1", probeCommand("health", "/health")},
+	{"ready", "Probe /ready of the local instance and exit 0 or 1", probeCommand("ready", "/ready")},
+	{"version", "Print build information", versionCommand},
+}
+
+// run dispatches args to a subcommand and returns the exit code
+func run(args []string) int {
+	if len(args) == 0 {
+		return commands[0].run(args)
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "-h", "--help":
+		usage(os.Stdout)
+		return 0
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage(os.Stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: app [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// probeCommand returns a subcommand that performs a GET against path on the
+// running instance over loopback. It is used by the Dockerfile HEALTHCHECK,
+// which cannot shell out to curl because the image is built FROM scratch.
+// Without -addr it dials the listen address of the configuration serve
+// reads: the file given with -config or CONFIG_FILE, and the environment.
+func probeCommand(name, path string) func(args []string) int {
+	return func(args []string) int {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		file := fs.String("config", "", "YAML configuration file of the instance (env "+config.FileEnv+")")
+		addr := fs.String("addr", "", "address of the instance to probe (default: the listen address of its configuration)")
+		timeout := fs.Duration("timeout", 2*time.Second, "probe timeout")
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			return 2
+		}
+		if *addr == "" {
+			*addr = loopbackAddr(envConfig(*file).Server.ListenAddr)
+		}
+
+		if err := probe(*addr, path, *timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 1
+		}
+		return 0
+	}
+}
+
+// probe performs a single GET against http://addr/path and succeeds only on 200 OK
+func probe(addr, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+path, nil)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		// Never pick up HTTP_PROXY from the container environment for a loopback probe
+		Transport: &http.Transport{Proxy: nil, DisableKeepAlives: true},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	return nil
+}
+
+// loopbackAddr rewrites a listen address such as ":8080" or "0.0.0.0:8080"
+// into the loopback address a local probe should dial
+func loopbackAddr(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// envConfig loads the configuration serve would start with from file, or
+// CONFIG_FILE when file is empty, and the environment, so that the probes
+// dial the address it listens on. An invalid configuration falls back to
+// the defaults; serve is the one to report it.
+func envConfig(file string) *config.Config {
+	var args []string
+	if file != "" {
+		args = []string{"-config", file}
+	}
+	cfg, err := config.Load(args, os.LookupEnv, io.Discard)
+	if err != nil {
+		return config.Default()
+	}
+	return cfg
+}
+
+func versionCommand(args []string) int {
+	appConfig = envConfig("")
+	info := getBuildInfo()
+	dirty := ""
+	if info.Modified {
+		dirty = "-dirty"
+	}
+	fmt.Printf("demo-app %s\n", info.Version)
+	fmt.Printf("  commit:     %s%s\n", info.Commit, dirty)
+	fmt.Printf("  build date: %s\n", info.BuildDate)
+	fmt.Printf("  go:         %s %s\n", info.GoVersion, info.Platform)
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeCommandReadsConfigFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("server:\n  listen_addr: \":"+port+"\"\n"), 0o600))
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("LISTEN_ADDR", "")
+
+	health := probeCommand("health", "/health")
+	assert.Equal(t, 0, health([]string{"-config", file, "-timeout", "1s"}), "the probe dials the listen address of -config")
+
+	t.Setenv("CONFIG_FILE", file)
+	assert.Equal(t, 0, health([]string{"-timeout", "1s"}), "and of CONFIG_FILE")
+	assert.Equal(t, 1, probeCommand("ready", "/ready")([]string{"-timeout", "1s"}))
+}
+
+func TestHelpExitsZero(t *testing.T) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	defer devNull.Close()
+	stderr := os.Stderr
+	os.Stderr = devNull
+	t.Cleanup(func() { os.Stderr = stderr })
+
+	for _, args := range [][]string{{"-h"}, {"serve", "-h"}, {"health", "-h"}} {
+		assert.Equal(t, 0, run(args), "%v", args)
+	}
+}
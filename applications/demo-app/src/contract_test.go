@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+func TestMain(m *testing.M) {
+	// Keep per-request access logs out of the test output
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// contractCase produces one documented response of one operation
+type contractCase struct {
+	method      string
+	target      string
+	contentType string
+	body        string
+
+	// validatedOnly marks responses produced by the OpenAPI validator,
+	// which are not returned when OPENAPI_VALIDATION=off
+	validatedOnly bool
+
+	// setup prepares the environment or appConfig before the router is built
+	setup func(t *testing.T)
+}
+
+// contractCases is keyed by "<operationId> <status>". Every response
+// documented in openapi.yaml must have an entry, so documenting a new
+// response or operation without a way to exercise it fails the suite.
+var contractCases = map[string]contractCase{
+	"getHome 200":    {method: http.MethodGet, target: "/"},
+	"getHealth 200":  {method: http.MethodGet, target: "/health"},
+	"getReady 200":   {method: http.MethodGet, target: "/ready", setup: withReadinessChecks(nil)},
+	"getReady 503":   {method: http.MethodGet, target: "/ready", setup: withReadinessChecks(errors.New("connection refused"))},
+	"getVersion 200": {method: http.MethodGet, target: "/version"},
+	"getHello 200":   {method: http.MethodGet, target: "/api/v1/hello?name=Lab"},
+	"getMetrics 200": {method: http.MethodGet, target: "/metrics"},
+	"postEcho 200": {
+		method:      http.MethodPost,
+		target:      "/api/v1/echo",
+		contentType: "application/json",
+		body:        `{"message":"hello","nested":{"count":1}}`,
+	},
+	"postEcho 400": {
+		method:      http.MethodPost,
+		target:      "/api/v1/echo",
+		contentType: "application/json",
+		body:        `{"message":`,
+	},
+	"postEcho 405":  {method: http.MethodGet, target: "/api/v1/echo"},
+	"getFaults 200": {method: http.MethodGet, target: "/admin/faults", setup: withFaultInjection},
+	"getFaults 404": {method: http.MethodGet, target: "/admin/faults"},
+	"putFaults 200": {
+		method:      http.MethodPut,
+		target:      "/admin/faults",
+		contentType: "application/json",
+		body:        `{"rules":{"/api/v1/hello":{"latency":"10ms","error_percent":5}},"readiness_flap":"30s"}`,
+		setup:       withFaultInjection,
+	},
+	"putFaults 400": {
+		method:      http.MethodPut,
+		target:      "/admin/faults",
+		contentType: "application/json",
+		body:        `{"rules":{"/api/v1/hello":{"latency":"soon"}}}`,
+		setup:       withFaultInjection,
+	},
+	"putFaults 404": {
+		method:      http.MethodPut,
+		target:      "/admin/faults",
+		contentType: "application/json",
+		body:        `{"rules":{}}`,
+	},
+	"deleteFaults 200": {method: http.MethodDelete, target: "/admin/faults", setup: withFaultInjection},
+	"deleteFaults 404": {method: http.MethodDelete, target: "/admin/faults"},
+	"getConfig 200": {
+		method: http.MethodGet,
+		target: "/debug/config",
+		setup: func(t *testing.T) {
+			appConfig.Debug.ConfigEndpoint = true
+		},
+	},
+	"getConfig 404": {method: http.MethodGet, target: "/debug/config"},
+	"postEcho 413": {
+		method:        http.MethodPost,
+		target:        "/api/v1/echo",
+		contentType:   "application/json",
+		body:          `{"message":"longer than the sixteen byte limit"}`,
+		validatedOnly: true,
+		setup: func(t *testing.T) {
+			appConfig.OpenAPI.MaxRequestBodyBytes = 16
+		},
+	},
+}
+
+// TestContract calls every documented operation through the full handler
+// chain and checks the status code, content type and body against the spec,
+// with and without the OpenAPI validation middleware in front.
+func TestContract(t *testing.T) {
+	doc, err := loadSpec(context.Background())
+	require.NoError(t, err)
+
+	for _, mode := range []string{validationOff, validationRequest, validationDebug} {
+		t.Run(mode, func(t *testing.T) {
+			walkOperations(doc, func(path, method string, op *openapi3.Operation) {
+				for _, status := range documentedStatuses(op) {
+					key := op.OperationID + " " + strconv.Itoa(status)
+					t.Run(key, func(t *testing.T) {
+						tc, ok := contractCases[key]
+						require.Truef(t, ok, "%s %s documents %d but contractCases has no %q entry", method, path, status, key)
+						if tc.validatedOnly && mode == validationOff {
+							t.Skip("response is produced by the validator")
+						}
+
+						withConfig(t, func(cfg *config.Config) { cfg.OpenAPI.Validation = mode })
+						if tc.setup != nil {
+							tc.setup(t)
+						}
+
+						resp := serveContractCase(t, tc)
+						assertConformsTo(t, op, status, resp)
+					})
+				}
+			})
+		})
+	}
+}
+
+// TestContractCasesDocumented fails when contractCases exercises a response
+// the spec does not document
+func TestContractCasesDocumented(t *testing.T) {
+	doc, err := loadSpec(context.Background())
+	require.NoError(t, err)
+
+	documented := map[string]bool{}
+	walkOperations(doc, func(_, _ string, op *openapi3.Operation) {
+		for _, status := range documentedStatuses(op) {
+			documented[op.OperationID+" "+strconv.Itoa(status)] = true
+		}
+	})
+
+	for key := range contractCases {
+		assert.Truef(t, documented[key], "contractCases entry %q is not documented in openapi.yaml", key)
+	}
+}
+
+// TestRoutesDocumented fails when a route is registered on the mux without
+// a matching operation in openapi.yaml
+func TestRoutesDocumented(t *testing.T) {
+	doc, err := loadSpec(context.Background())
+	require.NoError(t, err)
+
+	for _, route := range routes {
+		method, _, ok := strings.Cut(route.pattern, " ")
+		require.Truef(t, ok, "route %q has no method", route.pattern)
+		path := routeLabel(route.pattern)
+
+		item := doc.Paths.Find(path)
+		if !assert.NotNilf(t, item, "route %q: path %s is not documented in openapi.yaml", route.pattern, path) {
+			continue
+		}
+		assert.NotNilf(t, item.GetOperation(method), "route %q: %s %s is not documented in openapi.yaml", route.pattern, method, path)
+	}
+}
+
+// TestUnmatchedRoutes checks the JSON errors returned for requests that
+// match no documented operation
+func TestUnmatchedRoutes(t *testing.T) {
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	tests := []struct {
+		method, target string
+		status         int
+		message        string
+		allow          string
+	}{
+		{http.MethodGet, "/does-not-exist", http.StatusNotFound, "Not found", ""},
+		{http.MethodDelete, "/api/v1/echo", http.StatusMethodNotAllowed, "Method not allowed", "POST"},
+		{http.MethodPost, "/health", http.StatusMethodNotAllowed, "Method not allowed", "GET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			if tt.allow != "" {
+				assert.Contains(t, rec.Header().Get("Allow"), tt.allow)
+			}
+
+			var body ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.message, body.Error)
+		})
+	}
+}
+
+// TestDebugValidationAcceptsScrapes checks that an OpenMetrics scrape is no
+// contract violation, and that every operation documents a default error
+// response for statuses such as injected faults
+func TestDebugValidationAcceptsScrapes(t *testing.T) {
+	withConfig(t, func(cfg *config.Config) { cfg.OpenAPI.Validation = validationDebug })
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	violations := openapiViolationsTotal.WithLabelValues("response", "/metrics")
+	before := testutil.ToFloat64(violations)
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/openmetrics-text")
+	assert.Equal(t, before, testutil.ToFloat64(violations))
+
+	doc, err := loadSpec(context.Background())
+	require.NoError(t, err)
+	walkOperations(doc, func(path, method string, op *openapi3.Operation) {
+		assert.NotNilf(t, op.Responses.Default(), "%s %s documents no default response", method, path)
+	})
+}
+
+// walkOperations visits the operations of doc in a stable order
+func walkOperations(doc *openapi3.T, fn func(path, method string, op *openapi3.Operation)) {
+	for _, path := range doc.Paths.InMatchingOrder() {
+		item := doc.Paths.Find(path)
+		ops := item.Operations()
+		methods := make([]string, 0, len(ops))
+		for method := range ops {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			fn(path, method, ops[method])
+		}
+	}
+}
+
+// documentedStatuses returns the explicit status codes of op's responses
+func documentedStatuses(op *openapi3.Operation) []int {
+	var statuses []int
+	for code := range op.Responses.Map() {
+		if status, err := strconv.Atoi(code); err == nil {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Ints(statuses)
+	return statuses
+}
+
+// withConfig swaps appConfig for the defaults as changed by set; setups may
+// change it further
+func withConfig(t *testing.T, set func(cfg *config.Config)) {
+	saved := appConfig
+	appConfig = config.Default()
+	set(appConfig)
+	t.Cleanup(func() { appConfig = saved })
+}
+
+// withReadinessChecks swaps the global readiness registry for one holding a
+// single critical check that returns err
+func withReadinessChecks(err error) func(t *testing.T) {
+	return func(t *testing.T) {
+		saved := readiness
+		readiness = &readinessRegistry{}
+		readiness.Register(&staticChecker{checkOptions{"dependency", time.Second, true}, err})
+		t.Cleanup(func() { readiness = saved })
+	}
+}
+
+type staticChecker struct {
+	checkOptions
+	err error
+}
+
+func (c *staticChecker) Check(context.Context) error { return c.err }
+
+func serveContractCase(t *testing.T, tc contractCase) *http.Response {
+	t.Helper()
+
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	var body io.Reader
+	if tc.body != "" {
+		body = strings.NewReader(tc.body)
+	}
+	req := httptest.NewRequest(tc.method, tc.target, body)
+	if tc.contentType != "" {
+		req.Header.Set("Content-Type", tc.contentType)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+// assertConformsTo checks resp against the response op documents for status
+func assertConformsTo(t *testing.T, op *openapi3.Operation, status int, resp *http.Response) {
+	t.Helper()
+
+	require.Equal(t, status, resp.StatusCode)
+
+	ref := op.Responses.Status(status)
+	require.NotNil(t, ref)
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	require.NoError(t, err, "Content-Type")
+	content := ref.Value.Content.Get(mediaType)
+	require.NotNilf(t, content, "Content-Type %s is not documented for %s %d", mediaType, op.OperationID, status)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NotEmpty(t, body)
+
+	if content.Schema == nil || !strings.HasSuffix(mediaType, "json") {
+		return
+	}
+
+	var value interface{}
+	require.NoError(t, json.Unmarshal(body, &value), "body is not valid JSON")
+	assert.NoError(t, content.Schema.Value.VisitJSON(value), "body does not match the documented schema")
+}
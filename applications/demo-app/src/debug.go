@@ -0,0 +1,16 @@
+package main
+
+import "net/http"
+
+// debugConfigRoute serves the effective configuration
+const debugConfigRoute = "/debug/config"
+
+// debugConfigHandler returns appConfig as JSON. Secrets marshal as
+// [REDACTED], so the response is as safe to share as the startup log.
+func debugConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if !appConfig.Debug.ConfigEndpoint {
+		respondJSON(w, http.StatusNotFound, ErrorResponse{Error: "Debug endpoint is disabled"})
+		return
+	}
+	respondJSON(w, http.StatusOK, appConfig)
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+// faultHeader carries a fault spec for a single request
+const faultHeader = "X-Fault-Inject"
+
+// anyRoute is the rule key that applies to every API route without a rule
+// of its own
+const anyRoute = "*"
+
+// operationalRoutes are faulted only by a rule naming them, never by the
+// anyRoute rule, so probes, scrapes and debugging keep working
+var operationalRoutes = map[string]bool{
+	"/health":        true,
+	"/ready":         true,
+	"/metrics":       true,
+	"/version":       true,
+	debugConfigRoute: true,
+}
+
+// Fault kinds, used as the fault label of faultInjectionsTotal
+const (
+	faultLatency   = "latency"
+	faultError     = "error"
+	faultAbort     = "abort"
+	faultReadiness = "readiness"
+)
+
+var faultInjectionsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "fault_injections_total",
+		Help: "Faults injected by the fault-injection middleware",
+	},
+	[]string{"fault", "endpoint"},
+)
+
+func init() {
+	registry.MustRegister(faultInjectionsTotal)
+}
+
+// FaultRule is the fault configuration of one route
+type FaultRule struct {
+	// Latency is added before the handler runs, plus up to Jitter
+	Latency string `json:"latency,omitempty"`
+	Jitter  string `json:"jitter,omitempty"`
+	// ErrorPercent of requests are answered with ErrorStatus (default 500)
+	ErrorPercent float64 `json:"error_percent,omitempty"`
+	ErrorStatus  int     `json:"error_status,omitempty"`
+	// AbortPercent of requests have their connection closed without a response
+	AbortPercent float64 `json:"abort_percent,omitempty"`
+}
+
+// FaultConfig is the body of the /admin/faults endpoint
+type FaultConfig struct {
+	Enabled bool                 `json:"enabled"`
+	Rules   map[string]FaultRule `json:"rules"`
+	// ReadinessFlap alternates /ready between ready and not ready every
+	// period; empty when off
+	ReadinessFlap string `json:"readiness_flap,omitempty"`
+}
+
+// fault is a validated FaultRule
+type fault struct {
+	rule         FaultRule
+	latency      time.Duration
+	jitter       time.Duration
+	errorPercent float64
+	errorStatus  int
+	abortPercent float64
+
+	// random picks the faulted requests at random, as for the header; rules
+	// from the environment and the admin endpoint spread them evenly over
+	// the request count instead, so a test sees exactly the percentage
+	random bool
+	// hits counts every request, for aborts; answered counts those not
+	// aborted, for errors, so that both percentages hold of all requests
+	hits     atomic.Uint64
+	answered atomic.Uint64
+}
+
+func newFault(rule FaultRule) (*fault, error) {
+	f := &fault{rule: rule, errorPercent: rule.ErrorPercent, errorStatus: rule.ErrorStatus, abortPercent: rule.AbortPercent}
+
+	var err error
+	if f.latency, err = parseFaultDuration("latency", rule.Latency); err != nil {
+		return nil, err
+	}
+	if f.jitter, err = parseFaultDuration("jitter", rule.Jitter); err != nil {
+		return nil, err
+	}
+	for name, p := range map[string]float64{"error_percent": f.errorPercent, "abort_percent": f.abortPercent} {
+		if p < 0 || p > 100 || math.IsNaN(p) {
+			return nil, fmt.Errorf("%s must be between 0 and 100", name)
+		}
+	}
+	if f.errorPercent+f.abortPercent > 100 {
+		return nil, fmt.Errorf("error_percent and abort_percent must not add up to more than 100")
+	}
+	if f.errorStatus == 0 {
+		f.errorStatus = http.StatusInternalServerError
+	}
+	if f.errorStatus < 400 || f.errorStatus > 599 {
+		return nil, fmt.Errorf("error_status must be between 400 and 599")
+	}
+	return f, nil
+}
+
+func parseFaultDuration(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", name, s)
+	}
+	return d, nil
+}
+
+// parseFaultSpec parses the compact form used by FAULT_RULES and the
+// X-Fault-Inject header, such as "latency=200ms,jitter=50ms,error=10,status=503,abort=1"
+func parseFaultSpec(spec string) (*fault, error) {
+	var rule FaultRule
+	for _, item := range splitList(spec) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", item)
+		}
+		var err error
+		switch strings.TrimSpace(key) {
+		case "latency":
+			rule.Latency = value
+		case "jitter":
+			rule.Jitter = value
+		case "error":
+			rule.ErrorPercent, err = strconv.ParseFloat(value, 64)
+		case "status":
+			rule.ErrorStatus, err = strconv.Atoi(value)
+		case "abort":
+			rule.AbortPercent, err = strconv.ParseFloat(value, 64)
+		default:
+			return nil, fmt.Errorf("unknown fault %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid number %q", key, value)
+		}
+	}
+	return newFault(rule)
+}
+
+// due reports whether the n-th of the requests a fault can apply to gets
+// it, when p of every total of them should
+func (f *fault) due(n uint64, p, total float64) bool {
+	switch {
+	case p <= 0:
+		return false
+	case p >= total:
+		return true
+	case f.random:
+		return rand.Float64()*total < p
+	}
+	// The n-th request is faulted when it crosses the next multiple of
+	// total/p: error=10 fails requests 10, 20, 30 and so on
+	return math.Floor(float64(n)*p/total) > math.Floor(float64(n-1)*p/total)
+}
+
+// delay is the latency to add to one request
+func (f *fault) delay() time.Duration {
+	if f.jitter <= 0 {
+		return f.latency
+	}
+	return f.latency + rand.N(f.jitter+1)
+}
+
+// faultInjector holds the fault configuration, switched off by default
+type faultInjector struct {
+	mu      sync.RWMutex
+	enabled bool
+	rules   map[string]*fault
+
+	flap      time.Duration
+	flapSince time.Time
+}
+
+var faults = &faultInjector{}
+
+// configureFaults enables fault injection when cfg says so, with its rules:
+// semicolon-separated route=spec pairs such as
+// "/api/v1/hello=latency=200ms,error=10;*=abort=1". When disabled the
+// header is ignored and /admin/faults answers 404.
+func configureFaults(cfg config.Faults) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	initial := FaultConfig{Rules: map[string]FaultRule{}}
+	if cfg.ReadinessFlap > 0 {
+		initial.ReadinessFlap = cfg.ReadinessFlap.String()
+	}
+	for _, item := range strings.Split(cfg.Rules, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(item, "=")
+		if !ok || route == "" {
+			return fmt.Errorf("FAULT_RULES: expected route=spec, got %q", item)
+		}
+		f, err := parseFaultSpec(spec)
+		if err != nil {
+			return fmt.Errorf("FAULT_RULES: %s: %w", route, err)
+		}
+		initial.Rules[route] = f.rule
+	}
+
+	faults.enable()
+	if err := faults.Set(initial); err != nil {
+		return fmt.Errorf("FAULT_INJECTION: %w", err)
+	}
+	readiness.Register(faultReadinessChecker{checkOptions{"fault-injection", time.Second, true}})
+	slog.Warn("Fault injection is enabled", "rules", len(initial.Rules), "readiness_flap", initial.ReadinessFlap)
+	return nil
+}
+
+func (fi *faultInjector) enable() {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.enabled = true
+}
+
+func (fi *faultInjector) Enabled() bool {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	return fi.enabled
+}
+
+// Set replaces the rules and the readiness flapping; the hit counters of
+// the spread percentages restart
+func (fi *faultInjector) Set(cfg FaultConfig) error {
+	rules := map[string]*fault{}
+	for route, rule := range cfg.Rules {
+		if route != anyRoute && !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("rule %q: route must be a path such as /api/v1/hello or %q", route, anyRoute)
+		}
+		f, err := newFault(rule)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", route, err)
+		}
+		rules[route] = f
+	}
+	flap, err := parseFaultDuration("readiness_flap", cfg.ReadinessFlap)
+	if err != nil {
+		return err
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.rules = rules
+	fi.flap = flap
+	fi.flapSince = time.Now()
+	return nil
+}
+
+// Config returns the current configuration
+func (fi *faultInjector) Config() FaultConfig {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+
+	cfg := FaultConfig{Enabled: fi.enabled, Rules: map[string]FaultRule{}}
+	for route, f := range fi.rules {
+		cfg.Rules[route] = f.rule
+	}
+	if fi.flap > 0 {
+		cfg.ReadinessFlap = fi.flap.String()
+	}
+	return cfg
+}
+
+// lookup returns the fault for a request to route, nil when there is none.
+// The header replaces the route's rule. /admin/faults is never faulted.
+func (fi *faultInjector) lookup(r *http.Request, route string) (*fault, error) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+
+	if !fi.enabled || route == adminFaultsRoute || route == unmatchedRoute {
+		return nil, nil
+	}
+	if spec := r.Header.Get(faultHeader); spec != "" {
+		f, err := parseFaultSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		f.random = true
+		return f, nil
+	}
+	if f, ok := fi.rules[route]; ok {
+		return f, nil
+	}
+	if operationalRoutes[route] {
+		return nil, nil
+	}
+	return fi.rules[anyRoute], nil
+}
+
+// notReady reports whether the readiness flapping is in a not ready period:
+// ready for the first period after it is set, not ready for the next, and so on
+func (fi *faultInjector) notReady(now time.Time) bool {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	if !fi.enabled || fi.flap <= 0 {
+		return false
+	}
+	return int64(now.Sub(fi.flapSince)/fi.flap)%2 == 1
+}
+
+// faultMiddleware injects the faults configured for the route mux matches.
+// It sits inside the instrumentation, so injected errors and latency show
+// in http_requests_total and http_request_duration_seconds like real ones.
+func faultMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		route := routeLabel(pattern)
+
+		f, err := faults.lookup(r, route)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid " + faultHeader + " header: " + err.Error()})
+			return
+		}
+		if f == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if d := f.delay(); d > 0 {
+			faultInjectionsTotal.WithLabelValues(faultLatency, route).Inc()
+			if !sleepContext(r.Context(), d) {
+				return
+			}
+		}
+
+		if f.due(f.hits.Add(1), f.abortPercent, 100) {
+			faultInjectionsTotal.WithLabelValues(faultAbort, route).Inc()
+			// The server closes the connection without a response
+			panic(http.ErrAbortHandler)
+		}
+		// Errors take their share of all requests from the ones left:
+		// error=50,abort=25 fails 50 of the 75 in every 100 not aborted
+		if f.due(f.answered.Add(1), f.errorPercent, 100-f.abortPercent) {
+			faultInjectionsTotal.WithLabelValues(faultError, route).Inc()
+			respondJSON(w, f.errorStatus, ErrorResponse{Error: "Injected fault"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sleepContext waits for d and reports false if ctx ended first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// faultReadinessChecker fails while the readiness flapping is in a not
+// ready period
+type faultReadinessChecker struct {
+	checkOptions
+}
+
+func (c faultReadinessChecker) Check(context.Context) error {
+	if !faults.notReady(time.Now()) {
+		return nil
+	}
+	faultInjectionsTotal.WithLabelValues(faultReadiness, "/ready").Inc()
+	return errors.New("injected readiness failure")
+}
+
+// adminFaultsRoute serves the fault configuration
+const adminFaultsRoute = "/admin/faults"
+
+func getFaultsHandler(w http.ResponseWriter, r *http.Request) {
+	if !faults.Enabled() {
+		respondFaultsDisabled(w)
+		return
+	}
+	respondJSON(w, http.StatusOK, faults.Config())
+}
+
+func putFaultsHandler(w http.ResponseWriter, r *http.Request) {
+	if !faults.Enabled() {
+		respondFaultsDisabled(w)
+		return
+	}
+
+	var cfg FaultConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		respondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if err := faults.Set(cfg); err != nil {
+		respondJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid fault configuration: " + err.Error()})
+		return
+	}
+
+	cfg = faults.Config()
+	slog.WarnContext(r.Context(), "Fault configuration changed", "routes", sortedRoutes(cfg.Rules), "readiness_flap", cfg.ReadinessFlap)
+	respondJSON(w, http.StatusOK, cfg)
+}
+
+func deleteFaultsHandler(w http.ResponseWriter, r *http.Request) {
+	if !faults.Enabled() {
+		respondFaultsDisabled(w)
+		return
+	}
+	faults.Set(FaultConfig{})
+	slog.InfoContext(r.Context(), "Fault configuration cleared")
+	respondJSON(w, http.StatusOK, faults.Config())
+}
+
+func respondFaultsDisabled(w http.ResponseWriter) {
+	respondJSON(w, http.StatusNotFound, ErrorResponse{Error: "Fault injection is disabled"})
+}
+
+func sortedRoutes(rules map[string]FaultRule) []string {
+	routes := make([]string, 0, len(rules))
+	for route := range rules {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+// withFaultInjection swaps the global fault injector and readiness registry
+// for fresh ones configured with FAULT_INJECTION=on and the test's
+// FAULT_RULES and FAULT_READINESS_FLAP
+func withFaultInjection(t *testing.T) {
+	savedFaults, savedReadiness := faults, readiness
+	faults, readiness = &faultInjector{}, &readinessRegistry{}
+	t.Cleanup(func() { faults, readiness = savedFaults, savedReadiness })
+
+	t.Setenv("FAULT_INJECTION", "on")
+	require.NoError(t, configureFaultsFromEnv())
+}
+
+// configureFaultsFromEnv configures fault injection as serve would with the
+// test's environment
+func configureFaultsFromEnv() error {
+	cfg, err := config.Load(nil, os.LookupEnv, io.Discard)
+	if err != nil {
+		return err
+	}
+	return configureFaults(cfg.Faults)
+}
+
+func serveFaults(t *testing.T, router http.Handler, method, target, header string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if header != "" {
+		req.Header.Set(faultHeader, header)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFaultsOffByDefault(t *testing.T) {
+	savedFaults := faults
+	faults = &faultInjector{}
+	t.Cleanup(func() { faults = savedFaults })
+	t.Setenv("FAULT_RULES", "*=error=100")
+	require.NoError(t, configureFaultsFromEnv())
+
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	before := testutil.ToFloat64(faultInjectionsTotal.WithLabelValues(faultError, "/api/v1/hello"))
+	assert.Equal(t, http.StatusOK, serveFaults(t, router, http.MethodGet, "/api/v1/hello", "error=100").Code, "header is ignored")
+	assert.Equal(t, http.StatusNotFound, serveFaults(t, router, http.MethodGet, "/admin/faults", "").Code)
+	assert.Equal(t, before, testutil.ToFloat64(faultInjectionsTotal.WithLabelValues(faultError, "/api/v1/hello")))
+}
+
+func TestParseFaultSpec(t *testing.T) {
+	f, err := parseFaultSpec("latency=200ms, jitter=50ms, error=12.5, status=503, abort=1")
+	require.NoError(t, err)
+	assert.Equal(t, FaultRule{Latency: "200ms", Jitter: "50ms", ErrorPercent: 12.5, ErrorStatus: 503, AbortPercent: 1}, f.rule)
+	assert.Equal(t, 200*time.Millisecond, f.latency)
+	assert.Equal(t, 503, f.errorStatus)
+
+	f, err = parseFaultSpec("error=5")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, f.errorStatus, "default status")
+
+	for _, spec := range []string{"latency", "latency=soon", "latency=-1s", "error=101", "error=ten", "status=200", "abort=-1", "timeout=1s"} {
+		_, err := parseFaultSpec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestConfigureFaultsErrors(t *testing.T) {
+	for name, env := range map[string]map[string]string{
+		"Mode":  {"FAULT_INJECTION": "yes"},
+		"Rule":  {"FAULT_INJECTION": "on", "FAULT_RULES": "/api/v1/hello"},
+		"Spec":  {"FAULT_INJECTION": "on", "FAULT_RULES": "/api/v1/hello=error=200"},
+		"Route": {"FAULT_INJECTION": "on", "FAULT_RULES": "hello=error=1"},
+		"Total": {"FAULT_INJECTION": "on", "FAULT_RULES": "/api/v1/hello=error=80,abort=30"},
+		"Flap":  {"FAULT_INJECTION": "on", "FAULT_READINESS_FLAP": "often"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			savedFaults, savedReadiness := faults, readiness
+			faults, readiness = &faultInjector{}, &readinessRegistry{}
+			t.Cleanup(func() { faults, readiness = savedFaults, savedReadiness })
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			assert.Error(t, configureFaultsFromEnv())
+		})
+	}
+}
+
+// TestFaultErrorsSpread checks that a percentage from the rules faults
+// exactly that share of requests, counted in the fault and request metrics
+func TestFaultErrorsSpread(t *testing.T) {
+	t.Setenv("FAULT_RULES", "/api/v1/hello=error=10,status=503")
+	withFaultInjection(t)
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	injected := faultInjectionsTotal.WithLabelValues(faultError, "/api/v1/hello")
+	unavailable := httpRequestsTotal.WithLabelValues(http.MethodGet, "/api/v1/hello", "503")
+	injectedBefore, unavailableBefore := testutil.ToFloat64(injected), testutil.ToFloat64(unavailable)
+
+	var failed []int
+	for i := 1; i <= 100; i++ {
+		rec := serveFaults(t, router, http.MethodGet, "/api/v1/hello", "")
+		if rec.Code != http.StatusOK {
+			require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.JSONEq(t, `{"error":"Injected fault"}`, rec.Body.String())
+			failed = append(failed, i)
+		}
+	}
+	assert.Equal(t, []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, failed)
+	assert.Equal(t, 10.0, testutil.ToFloat64(injected)-injectedBefore)
+	assert.Equal(t, 10.0, testutil.ToFloat64(unavailable)-unavailableBefore)
+
+	// Other routes are untouched
+	assert.Equal(t, http.StatusOK, serveFaults(t, router, http.MethodGet, "/", "").Code)
+}
+
+func TestFaultLatency(t *testing.T) {
+	t.Setenv("FAULT_RULES", "/api/v1/hello=latency=50ms")
+	withFaultInjection(t)
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	before := testutil.ToFloat64(faultInjectionsTotal.WithLabelValues(faultLatency, "/api/v1/hello"))
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, serveFaults(t, router, http.MethodGet, "/api/v1/hello", "").Code)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, 1.0, testutil.ToFloat64(faultInjectionsTotal.WithLabelValues(faultLatency, "/api/v1/hello"))-before)
+}
+
+func TestFaultAbort(t *testing.T) {
+	t.Setenv("FAULT_RULES", "/api/v1/hello=abort=100")
+	withFaultInjection(t)
+	router, err := newRouter()
+	require.NoError(t, err)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	before := testutil.ToFloat64(faultInjectionsTotal.WithLabelValues(faultAbort, "/api/v1/hello"))
+	resp, err := srv.Client().Get(srv.URL + "/api/v1/hello")
+	if err == nil {
+		resp.Body.Close()
+	}
+	require.Error(t, err, "connection is closed without a response")
+	assert.Equal(t, 1.0, testutil.ToFloat64(faultInjectionsTotal.WithLabelValues(faultAbort, "/api/v1/hello"))-before)
+
+	resp, err = srv.Client().Get(srv.URL + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// TestFaultErrorsAndAborts checks that a rule with both faults aborts and
+// fails its own share of all requests
+func TestFaultErrorsAndAborts(t *testing.T) {
+	for _, tc := range []struct {
+		spec           string
+		aborts, errors int
+	}{
+		{"error=10,abort=10", 10, 10},
+		{"error=50,abort=25", 25, 50},
+		{"error=20,abort=80", 80, 20},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			t.Setenv("FAULT_RULES", "/api/v1/hello="+tc.spec+",status=503")
+			withFaultInjection(t)
+			router, err := newRouter()
+			require.NoError(t, err)
+			srv := httptest.NewServer(router)
+			t.Cleanup(srv.Close)
+			// A fresh connection per request, or the client would retry
+			// aborted requests on a new one
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+			var aborts, errors int
+			for range 100 {
+				resp, err := client.Get(srv.URL + "/api/v1/hello")
+				if err != nil {
+					aborts++
+					continue
+				}
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusServiceUnavailable {
+					errors++
+				}
+			}
+			assert.Equal(t, tc.aborts, aborts, "aborted")
+			assert.Equal(t, tc.errors, errors, "answered 503")
+		})
+	}
+}
+
+func TestFaultHeader(t *testing.T) {
+	t.Setenv("FAULT_RULES", "/api/v1/hello=latency=1h")
+	withFaultInjection(t)
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	rec := serveFaults(t, router, http.MethodGet, "/api/v1/hello", "error=100,status=502")
+	assert.Equal(t, http.StatusBadGateway, rec.Code, "the header replaces the route's rule")
+
+	rec = serveFaults(t, router, http.MethodGet, "/health", "error=100")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "the header applies to probes too")
+
+	rec = serveFaults(t, router, http.MethodGet, "/", "error=lots")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Invalid X-Fault-Inject header")
+}
+
+func TestFaultWildcardSkipsOperationalRoutes(t *testing.T) {
+	t.Setenv("FAULT_RULES", "*=error=100;/ready=error=100,status=503")
+	withFaultInjection(t)
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	for target, status := range map[string]int{
+		"/":             http.StatusInternalServerError,
+		"/api/v1/hello": http.StatusInternalServerError,
+		"/health":       http.StatusOK,
+		"/metrics":      http.StatusOK,
+		"/version":      http.StatusOK,
+		"/debug/config": http.StatusNotFound,
+		"/admin/faults": http.StatusOK,
+		"/ready":        http.StatusServiceUnavailable,
+		"/nowhere":      http.StatusNotFound,
+	} {
+		assert.Equal(t, status, serveFaults(t, router, http.MethodGet, target, "").Code, target)
+	}
+}
+
+func TestReadinessFlap(t *testing.T) {
+	t.Setenv("FAULT_READINESS_FLAP", "1m")
+	withFaultInjection(t)
+
+	since := faults.flapSince
+	assert.False(t, faults.notReady(since.Add(30*time.Second)))
+	assert.True(t, faults.notReady(since.Add(90*time.Second)))
+	assert.False(t, faults.notReady(since.Add(150*time.Second)))
+
+	// Move into a not ready period and check /ready reports it
+	faults.mu.Lock()
+	faults.flapSince = time.Now().Add(-90 * time.Second)
+	faults.mu.Unlock()
+
+	router, err := newRouter()
+	require.NoError(t, err)
+	before := testutil.ToFloat64(faultInjectionsTotal.WithLabelValues(faultReadiness, "/ready"))
+	rec := serveFaults(t, router, http.MethodGet, "/ready", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "injected readiness failure")
+	assert.Equal(t, 1.0, testutil.ToFloat64(faultInjectionsTotal.WithLabelValues(faultReadiness, "/ready"))-before)
+}
+
+func TestAdminFaults(t *testing.T) {
+	withFaultInjection(t)
+	router, err := newRouter()
+	require.NoError(t, err)
+
+	admin := func(method, body string) FaultConfig {
+		t.Helper()
+		req := httptest.NewRequest(method, "/admin/faults", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var cfg FaultConfig
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cfg))
+		return cfg
+	}
+
+	assert.Equal(t, FaultConfig{Enabled: true, Rules: map[string]FaultRule{}}, admin(http.MethodGet, ""))
+
+	admin(http.MethodPut, `{"rules":{"/api/v1/hello":{"error_percent":100,"error_status":504}},"readiness_flap":"30s"}`)
+	assert.Equal(t, FaultConfig{
+		Enabled:       true,
+		Rules:         map[string]FaultRule{"/api/v1/hello": {ErrorPercent: 100, ErrorStatus: 504}},
+		ReadinessFlap: "30s",
+	}, admin(http.MethodGet, ""))
+	assert.Equal(t, http.StatusGatewayTimeout, serveFaults(t, router, http.MethodGet, "/api/v1/hello", "").Code)
+
+	assert.Equal(t, FaultConfig{Enabled: true, Rules: map[string]FaultRule{}}, admin(http.MethodDelete, ""))
+	assert.Equal(t, http.StatusOK, serveFaults(t, router, http.MethodGet, "/api/v1/hello", "").Code)
+}
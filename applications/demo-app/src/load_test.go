@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/loadtest"
+)
+
+// sloThresholds are the SLOs of tests/performance/k6_load_test.js
+var sloThresholds = map[string][]string{
+	"http_req_duration":                   {"p(95)<500", "p(99)<1000"},
+	"http_req_failed":                     {"rate<0.01"},
+	"http_req_duration{scenario:health}":  {"p(95)<100"},
+	"http_req_duration{scenario:metrics}": {"p(95)<200"},
+}
+
+// defaultLoadStages is a short version of the k6 ramp: up, hold, down
+const defaultLoadStages = "2s:10,3s:10,1s:0"
+
+// loadScenarios mirrors the scenarios of the k6 script and their 4:2:3 mix.
+// The health check expects the status of openapi.yaml, "healthy".
+func loadScenarios(baseURL string) []loadtest.Scenario {
+	return []loadtest.Scenario{
+		{
+			Name:    "health",
+			Weight:  4,
+			Request: loadtest.Get(baseURL + "/health"),
+			Check: func(resp *http.Response, body []byte) error {
+				var health struct{ Status string }
+				if resp.StatusCode != http.StatusOK {
+					return errors.New("health status is not 200")
+				}
+				if err := json.Unmarshal(body, &health); err != nil || health.Status != "healthy" {
+					return errors.New("health is not healthy")
+				}
+				return nil
+			},
+		},
+		{
+			Name:    "metrics",
+			Weight:  2,
+			Request: loadtest.Get(baseURL + "/metrics"),
+			Check: func(resp *http.Response, body []byte) error {
+				if resp.StatusCode != http.StatusOK {
+					return errors.New("metrics status is not 200")
+				}
+				if !strings.Contains(string(body), "# HELP") || !strings.Contains(string(body), "http_requests_total") {
+					return errors.New("metrics are not in Prometheus format")
+				}
+				return nil
+			},
+		},
+		{
+			Name:   "api",
+			Weight: 3,
+			Tags:   map[string]string{"traced": "true"},
+			Request: loadtest.Get(baseURL+"/api/v1/hello?name=load",
+				"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+		},
+	}
+}
+
+// TestLoadSLO runs the k6 scenarios against the router in-process, or
+// against LOADTEST_BASE_URL, and fails when a k6 threshold does not hold.
+// LOADTEST_STAGES overrides the ramp, LOADTEST_MODEL=open switches to an
+// arrival rate and LOADTEST_REPORT writes the JSON report to a file.
+func TestLoadSLO(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test skipped in -short mode")
+	}
+
+	stages, err := loadtest.ParseStages(envOr("LOADTEST_STAGES", defaultLoadStages))
+	require.NoError(t, err)
+
+	baseURL := os.Getenv("LOADTEST_BASE_URL")
+	if baseURL == "" {
+		router, err := newRouter()
+		require.NoError(t, err)
+		srv := httptest.NewServer(router)
+		t.Cleanup(srv.Close)
+		baseURL = srv.URL
+	}
+
+	var model loadtest.Model = loadtest.Closed{Stages: stages}
+	if os.Getenv("LOADTEST_MODEL") == "open" {
+		model = loadtest.Open{Stages: stages}
+	}
+
+	report, err := loadtest.Test{
+		Model:        model,
+		Scenarios:    loadScenarios(strings.TrimRight(baseURL, "/")),
+		Thresholds:   sloThresholds,
+		GracefulStop: 5 * time.Second,
+	}.Run(context.Background())
+	require.NoError(t, err)
+
+	var summary strings.Builder
+	require.NoError(t, report.WriteText(&summary))
+	t.Log("\n" + summary.String())
+
+	if path := os.Getenv("LOADTEST_REPORT"); path != "" {
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		defer f.Close()
+		require.NoError(t, report.WriteJSON(f))
+	}
+
+	for _, failure := range report.Failures() {
+		t.Errorf("threshold failed: %s", failure)
+	}
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// BenchmarkRoutes reports the latency percentiles of each scenario next to
+// ns/op, so benchstat can compare them across commits
+func BenchmarkRoutes(b *testing.B) {
+	router, err := newRouter()
+	require.NoError(b, err)
+	srv := httptest.NewServer(router)
+	b.Cleanup(srv.Close)
+
+	for _, s := range loadScenarios(srv.URL) {
+		b.Run(s.Name, func(b *testing.B) {
+			latency := loadtest.NewHistogram()
+			client := srv.Client()
+			ctx := context.Background()
+			b.ResetTimer()
+			for range b.N {
+				req, err := s.Request(ctx)
+				require.NoError(b, err)
+				start := time.Now()
+				resp, err := client.Do(req)
+				require.NoError(b, err)
+				resp.Body.Close()
+				latency.Record(time.Since(start))
+			}
+			b.ReportMetric(float64(latency.Percentile(95).Microseconds()), "p95-µs")
+			b.ReportMetric(float64(latency.Percentile(99).Microseconds()), "p99-µs")
+		})
+	}
+}
@@ -3,51 +3,26 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/semconv/v1.17.0/httpconv"
 	"go.opentelemetry.io/otel/trace"
-)
 
-// Prometheus metrics
-var (
-	httpRequestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-
-	httpRequestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
 )
 
-func init() {
-	// Register Prometheus metrics
-	prometheus.MustRegister(httpRequestsTotal)
-	prometheus.MustRegister(httpRequestDuration)
-}
-
 // Response structures
 type HealthResponse struct {
 	Status  string `json:"status"`
@@ -67,146 +42,169 @@ type ErrorResponse struct {
 
 var startTime = time.Now()
 
+// appConfig is the effective configuration, loaded by serve and read by
+// the handlers and middleware; tests swap it
+var appConfig = config.Default()
+
 func main() {
-	// Initialize OpenTelemetry
-	ctx := context.Background()
-	tp, err := initTracer(ctx)
+	os.Exit(run(os.Args[1:]))
+}
+
+// serve runs the HTTP server until SIGINT or SIGTERM is received. args are
+// the flags of the config package, such as -config and -listen-addr.
+func serve(args []string) int {
+	// Defaults, the optional YAML file, the environment and flags
+	cfg, err := config.Load(args, os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
 	if err != nil {
-		log.Printf("Failed to initialize tracer: %v", err)
-	} else {
-		defer func() {
-			if err := tp.Shutdown(ctx); err != nil {
-				log.Printf("Error shutting down tracer: %v", err)
-			}
-		}()
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 1
 	}
+	appConfig = cfg
 
-	// Setup HTTP server
-	mux := http.NewServeMux()
-
-	// Routes
-	mux.HandleFunc("/", instrumentHandler(homeHandler))
-	mux.HandleFunc("/health", instrumentHandler(healthHandler))
-	mux.HandleFunc("/ready", instrumentHandler(readyHandler))
-	mux.HandleFunc("/api/v1/hello", instrumentHandler(helloHandler))
-	mux.HandleFunc("/api/v1/echo", instrumentHandler(echoHandler))
-
-	// Metrics endpoint
-	mux.Handle("/metrics", promhttp.Handler())
-
-	// Server configuration
-	srv := &http.Server{
-		Addr:         ":8080",
-		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	// Initialize structured logging
+	if err := initLogger(cfg.Log); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		return 1
 	}
-
-	// Start server in goroutine
-	go func() {
-		log.Printf("starting server on %s", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed: %v", err)
+	slog.Info("Effective configuration", "config", cfg)
+	recordBuildInfo()
+
+	// Initialize OpenTelemetry. The provider is shut down explicitly on every
+	// return from here on, so the batcher is flushed whatever the exit code.
+	var tp telemetry
+	if provider, err := initTracer(context.Background(), cfg); err != nil {
+		slog.Error("Failed to initialize tracer", "error", err)
+	} else {
+		tp = provider
+	}
+	fail := func(msg string, err error) int {
+		slog.Error(msg, "error", err)
+		if err := flushTelemetry(tp, time.Duration(cfg.Shutdown.FlushTimeout)); err != nil {
+			slog.Error("Error shutting down tracer", "error", err)
 		}
-	}()
-
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Println("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+		return 1
+	}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	// Trace context propagation for inbound and outbound requests
+	if err := initPropagators(cfg.Tracing.Propagators); err != nil {
+		return fail("Invalid propagator configuration", err)
 	}
 
-	log.Println("Server exited")
-}
+	// Readiness checks for downstream dependencies
+	if err := registerReadinessChecks(cfg.Readiness, cfg.Tracing); err != nil {
+		return fail("Invalid readiness check configuration", err)
+	}
 
-// initTracer initializes OpenTelemetry tracer
-func initTracer(ctx context.Context) (*sdktrace.TracerProvider, error) {
-	// Get OTLP endpoint from environment
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		endpoint = "otel-collector.observability.svc.cluster.local:4317"
+	// Fault injection, off unless FAULT_INJECTION=on
+	if err := configureFaults(cfg.Faults); err != nil {
+		return fail("Invalid fault injection configuration", err)
 	}
 
-	exporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithEndpoint(endpoint),
-		otlptracegrpc.WithInsecure(),
-	)
+	// Routes, validated against the embedded OpenAPI spec
+	router, err := newRouter()
 	if err != nil {
-		return nil, err
+		return fail("Failed to set up routes", err)
 	}
 
-	// Create resource with service information
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("demo-app"),
-			semconv.ServiceVersion(os.Getenv("APP_VERSION")),
-			attribute.String("environment", os.Getenv("ENVIRONMENT")),
-		),
-	)
-	if err != nil {
-		return nil, err
+	// Server configuration
+	srv := &http.Server{
+		Addr:         cfg.Server.ListenAddr,
+		Handler:      router,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
 	}
 
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-	)
+	// Bind before serving so a taken port fails here, with the tracer flushed
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fail("Failed to listen", err)
+	}
 
-	otel.SetTracerProvider(tp)
+	// A buffer of two keeps a second signal, which cuts the shutdown short
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
 
-	return tp, nil
+	slog.Info("Starting server", "addr", srv.Addr, "version", getBuildInfo().Version)
+	return runServer(srv, ln, signals, tp, cfg.Shutdown)
 }
 
-// instrumentHandler wraps HTTP handlers with metrics and tracing
-func instrumentHandler(handler http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+// instrumentHandler wraps next with metrics, tracing and request logging.
+// Metric labels and span names use the route pattern mux matches, never the
+// raw path, so arbitrary URLs cannot create new Prometheus series.
+func instrumentHandler(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
 
-		// Create span
-		tracer := otel.Tracer("demo-app")
-		ctx, span := tracer.Start(r.Context(), r.URL.Path)
-		defer span.End()
+		_, pattern := mux.Handler(r)
+		route := routeLabel(pattern)
+		method := methodLabel(r.Method)
+
+		// Continue the caller's trace (traceparent/baggage from Istio or Kong)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
 
-		// Add span attributes
-		span.SetAttributes(
-			attribute.String("http.method", r.Method),
-			attribute.String("http.url", r.URL.String()),
-			attribute.String("http.user_agent", r.UserAgent()),
+		// Create server span
+		tracer := otel.Tracer("demo-app")
+		ctx, span := tracer.Start(ctx, spanName(method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(httpconv.ServerRequest("demo-app", r)...),
 		)
+		defer span.End()
 
 		// Create response writer wrapper to capture status code
 		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
+		var out http.ResponseWriter = rw
+		if route != unmatchedRoute {
+			span.SetAttributes(semconv.HTTPRoute(route))
+		} else {
+			// Answer 404/405 from the mux with the API's JSON error body
+			out = &jsonErrorWriter{ResponseWriter: rw}
+		}
+
+		// Count request body bytes for chunked requests
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+
 		// Call handler with context
-		handler(rw, r.WithContext(ctx))
+		next.ServeHTTP(out, r.WithContext(ctx))
 
-		// Record metrics
+		// Record metrics, with the trace ID as exemplar for sampled spans
 		duration := time.Since(start).Seconds()
-		httpRequestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
-		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, fmt.Sprintf("%d", rw.statusCode)).Inc()
+		exemplar := exemplarLabels(ctx)
+		observe(httpRequestDuration.WithLabelValues(method, route), duration, exemplar)
+		observe(httpRequestSize.WithLabelValues(method, route), requestSize(r, body), nil)
+		observe(httpResponseSize.WithLabelValues(method, route), float64(rw.bytesWritten), nil)
+		inc(httpRequestsTotal.WithLabelValues(method, route, fmt.Sprintf("%d", rw.statusCode)), exemplar)
 
 		// Add span status
-		span.SetAttributes(attribute.Int("http.status_code", rw.statusCode))
-
-		// Log request
-		log.Printf("%s %s %d %v", r.Method, r.URL.Path, rw.statusCode, duration)
-	}
+		span.SetAttributes(semconv.HTTPStatusCode(rw.statusCode))
+		span.SetStatus(httpconv.ServerStatus(rw.statusCode))
+
+		// Log request; trace_id and span_id are added by traceHandler
+		slog.LogAttrs(ctx, slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rw.statusCode),
+			slog.Float64("duration", duration),
+			slog.Int64("bytes", rw.bytesWritten),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
 }
 
-// responseWriter wraps http.ResponseWriter to capture status code
+// responseWriter wraps http.ResponseWriter to capture status code and body size
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	bytesWritten int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -214,6 +212,12 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytesWritten += int64(n)
+	return n, err
+}
+
 // HTTP Handlers
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
@@ -227,15 +231,24 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, HealthResponse{
 		Status:  "healthy",
-		Version: getEnv("APP_VERSION", "1.0.0"),
+		Version: getBuildInfo().Version,
 		Uptime:  time.Since(startTime).String(),
 	})
 }
 
 func readyHandler(w http.ResponseWriter, r *http.Request) {
-	// Add readiness checks here (database, dependencies, etc.)
-	respondJSON(w, http.StatusOK, map[string]string{
-		"status": "ready",
+	ready, checks := readiness.Run(r.Context())
+	if !ready {
+		respondJSON(w, http.StatusServiceUnavailable, ReadinessResponse{
+			Status: "not_ready",
+			Checks: checks,
+		})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, ReadinessResponse{
+		Status: "ready",
+		Checks: checks,
 	})
 }
 
@@ -253,13 +266,6 @@ func helloHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func echoHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		respondJSON(w, http.StatusMethodNotAllowed, ErrorResponse{
-			Error: "Method not allowed",
-		})
-		return
-	}
-
 	var request map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		respondJSON(w, http.StatusBadRequest, ErrorResponse{
@@ -292,10 +298,3 @@ func getTraceID(ctx context.Context) string {
 	}
 	return ""
 }
-
-func getEnv(key, fallback string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return fallback
-}
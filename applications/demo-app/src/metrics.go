@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// registry is the dedicated registry served on /metrics; nothing is
+// registered on the global default registry
+var registry = prometheus.NewRegistry()
+
+// Latency buckets aligned with the SLOs in tests/performance/k6_load_test.js:
+// health p95 < 100ms, metrics p95 < 200ms, overall p95 < 500ms and p99 < 1s
+var sloBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.25, 0.5, 1, 2.5, 5}
+
+// Body sizes from 100B to 1MB
+var sizeBuckets = prometheus.ExponentialBuckets(100, 10, 5)
+
+// Native histogram settings; scrapers that negotiate protobuf get
+// high-resolution exponential buckets in addition to the classic ones
+const (
+	nativeBucketFactor     = 1.1
+	nativeMaxBucketNumber  = 100
+	nativeMinResetDuration = time.Hour
+)
+
+// Prometheus metrics (RED + saturation)
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests",
+		},
+		[]string{"method", "endpoint", "status"},
+	)
+
+	httpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:                            "http_request_duration_seconds",
+			Help:                            "HTTP request duration in seconds",
+			Buckets:                         sloBuckets,
+			NativeHistogramBucketFactor:     nativeBucketFactor,
+			NativeHistogramMaxBucketNumber:  nativeMaxBucketNumber,
+			NativeHistogramMinResetDuration: nativeMinResetDuration,
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	httpRequestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:                            "http_request_size_bytes",
+			Help:                            "HTTP request body size in bytes",
+			Buckets:                         sizeBuckets,
+			NativeHistogramBucketFactor:     nativeBucketFactor,
+			NativeHistogramMaxBucketNumber:  nativeMaxBucketNumber,
+			NativeHistogramMinResetDuration: nativeMinResetDuration,
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	httpResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:                            "http_response_size_bytes",
+			Help:                            "HTTP response body size in bytes",
+			Buckets:                         sizeBuckets,
+			NativeHistogramBucketFactor:     nativeBucketFactor,
+			NativeHistogramMaxBucketNumber:  nativeMaxBucketNumber,
+			NativeHistogramMinResetDuration: nativeMinResetDuration,
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	httpRequestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests currently being served",
+		},
+	)
+)
+
+func init() {
+	// Register Prometheus metrics
+	registry.MustRegister(
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpRequestSize,
+		httpResponseSize,
+		httpRequestsInFlight,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// metricsHandler serves the registry. OpenMetrics is enabled so exemplars
+// are exposed to scrapers that ask for it.
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		Registry:          registry,
+		EnableOpenMetrics: true,
+	})
+}
+
+// exemplarLabels returns the trace_id exemplar for a sampled span, so
+// Grafana can jump from a latency bucket to the trace in Tempo
+func exemplarLabels(ctx context.Context) prometheus.Labels {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": sc.TraceID().String()}
+}
+
+// observe records v on o, attaching exemplar when there is one
+func observe(o prometheus.Observer, v float64, exemplar prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(v, exemplar)
+		return
+	}
+	o.Observe(v)
+}
+
+// inc increments c, attaching exemplar when there is one
+func inc(c prometheus.Counter, exemplar prometheus.Labels) {
+	if ea, ok := c.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		ea.AddWithExemplar(1, exemplar)
+		return
+	}
+	c.Inc()
+}
+
+// countingBody counts the request body bytes read by the handler
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// requestSize prefers the declared Content-Length and falls back to the
+// bytes actually read for chunked bodies
+func requestSize(r *http.Request, body *countingBody) float64 {
+	if r.ContentLength >= 0 {
+		return float64(r.ContentLength)
+	}
+	return float64(body.n)
+}
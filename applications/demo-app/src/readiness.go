@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+// ReadinessChecker is a single dependency check evaluated by /ready.
+// A failing critical check makes the instance not ready; a failing
+// non-critical check is reported but does not take it out of rotation.
+type ReadinessChecker interface {
+	Name() string
+	Timeout() time.Duration
+	Critical() bool
+	Check(ctx context.Context) error
+}
+
+// CheckResult is the outcome of one ReadinessChecker
+type CheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the body returned by /ready
+type ReadinessResponse struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// readinessRegistry holds the checkers evaluated on every /ready request
+type readinessRegistry struct {
+	mu       sync.RWMutex
+	checkers []ReadinessChecker
+	// draining is set once shutdown starts and never cleared
+	draining atomic.Bool
+}
+
+var readiness = &readinessRegistry{}
+
+// Register adds checkers to the registry
+func (r *readinessRegistry) Register(checkers ...ReadinessChecker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkers = append(r.checkers, checkers...)
+}
+
+// StartDraining makes every later Run report not ready, so the instance is
+// taken out of rotation before the server stops accepting requests
+func (r *readinessRegistry) StartDraining() {
+	r.draining.Store(true)
+}
+
+// Run evaluates all checkers concurrently, each bounded by its own timeout,
+// and reports whether every critical check passed. While draining it reports
+// a failing shutdown check without running the checkers.
+func (r *readinessRegistry) Run(ctx context.Context) (bool, []CheckResult) {
+	if r.draining.Load() {
+		return false, []CheckResult{{
+			Name:     "shutdown",
+			Status:   "fail",
+			Critical: true,
+			Duration: "0s",
+			Error:    "shutting down",
+		}}
+	}
+
+	r.mu.RLock()
+	checkers := append([]ReadinessChecker(nil), r.checkers...)
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checkers))
+	var wg sync.WaitGroup
+	for i, c := range checkers {
+		wg.Add(1)
+		go func(i int, c ReadinessChecker) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, res := range results {
+		if res.Critical && res.Status != "pass" {
+			ready = false
+		}
+	}
+	return ready, results
+}
+
+func runCheck(ctx context.Context, c ReadinessChecker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout())
+	defer cancel()
+
+	start := time.Now()
+	err := c.Check(ctx)
+	res := CheckResult{
+		Name:     c.Name(),
+		Status:   "pass",
+		Critical: c.Critical(),
+		Duration: time.Since(start).Round(time.Microsecond).String(),
+	}
+	if err != nil {
+		res.Status = "fail"
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// checkOptions holds the fields shared by the built-in checkers
+type checkOptions struct {
+	name     string
+	timeout  time.Duration
+	critical bool
+}
+
+func (o checkOptions) Name() string           { return o.name }
+func (o checkOptions) Timeout() time.Duration { return o.timeout }
+func (o checkOptions) Critical() bool         { return o.critical }
+
+// tcpChecker passes when a TCP connection to addr can be established
+type tcpChecker struct {
+	checkOptions
+	addr string
+}
+
+func newTCPChecker(name, addr string, timeout time.Duration, critical bool) *tcpChecker {
+	return &tcpChecker{checkOptions{name, timeout, critical}, addr}
+}
+
+func (c *tcpChecker) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// httpChecker passes when a GET to url returns a 2xx status
+type httpChecker struct {
+	checkOptions
+	url    string
+	client *http.Client
+}
+
+func newHTTPChecker(name, url string, timeout time.Duration, critical bool) *httpChecker {
+	return &httpChecker{checkOptions{name, timeout, critical}, url, newHTTPClient(0)}
+}
+
+func (c *httpChecker) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// newOTLPChecker verifies that the OTLP collector the trace exporter sends
+// to is reachable. The exporter itself only reports failures asynchronously
+// from the batcher, so the check dials the endpoint directly.
+func newOTLPChecker(otlp config.OTLP, timeout time.Duration, critical bool) *tcpChecker {
+	return newTCPChecker("otlp-exporter", otlpDialAddr(otlp.Endpoint, otlp.Protocol), timeout, critical)
+}
+
+// otlpDialAddr turns an OTLP endpoint, with or without scheme, into host:port.
+// A URL without a port dials the protocol's default one.
+func otlpDialAddr(endpoint, protocol string) string {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "4317"
+	switch {
+	case u.Scheme == "https":
+		port = "443"
+	case strings.EqualFold(protocol, "http/protobuf"):
+		port = "4318"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// registerReadinessChecks configures the readiness registry: TCP and HTTP
+// checks from name=target pairs, each critical unless listed as optional,
+// and a dial of the OTLP collector when spans are exported to one
+func registerReadinessChecks(cfg config.Readiness, tracing config.Tracing) error {
+	timeout := time.Duration(cfg.CheckTimeout)
+
+	optional := map[string]bool{}
+	for _, name := range cfg.OptionalChecks {
+		optional[name] = true
+	}
+
+	tcpChecks, err := parseNamedTargets("READINESS_TCP_CHECKS", cfg.TCPChecks)
+	if err != nil {
+		return err
+	}
+	for _, t := range tcpChecks {
+		readiness.Register(newTCPChecker(t[0], t[1], timeout, !optional[t[0]]))
+	}
+
+	httpChecks, err := parseNamedTargets("READINESS_HTTP_CHECKS", cfg.HTTPChecks)
+	if err != nil {
+		return err
+	}
+	for _, t := range httpChecks {
+		readiness.Register(newHTTPChecker(t[0], t[1], timeout, !optional[t[0]]))
+	}
+
+	switch mode := cfg.OTLPCheck; mode {
+	case "off":
+	case "critical", "optional":
+		// Nothing to dial when spans go to stdout or nowhere
+		if tracesExporter(tracing) == "otlp" {
+			readiness.Register(newOTLPChecker(tracing.OTLP, timeout, mode == "critical"))
+		}
+	default:
+		return fmt.Errorf("READINESS_OTLP_CHECK: unknown mode %q", mode)
+	}
+
+	return nil
+}
+
+// parseNamedTargets splits name=target pairs
+func parseNamedTargets(key string, items []string) ([][2]string, error) {
+	var targets [][2]string
+	for _, item := range items {
+		name, target, ok := strings.Cut(item, "=")
+		if !ok || name == "" || target == "" {
+			return nil, fmt.Errorf("%s: expected name=target, got %q", key, item)
+		}
+		targets = append(targets, [2]string{name, target})
+	}
+	return targets, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// unmatchedRoute is the route label for requests no pattern matched
+const unmatchedRoute = "unmatched"
+
+// routes maps ServeMux patterns to handlers. Every entry must be documented
+// in openapi.yaml; the contract tests enforce this.
+var routes = []struct {
+	pattern string
+	handler http.Handler
+}{
+	{"GET /{$}", http.HandlerFunc(homeHandler)},
+	{"GET /health", http.HandlerFunc(healthHandler)},
+	{"GET /ready", http.HandlerFunc(readyHandler)},
+	{"GET /version", http.HandlerFunc(versionHandler)},
+	{"GET /api/v1/hello", http.HandlerFunc(helloHandler)},
+	{"POST /api/v1/echo", http.HandlerFunc(echoHandler)},
+
+	// Metrics endpoint
+	{"GET /metrics", metricsHandler()},
+
+	// Fault injection, 404 unless FAULT_INJECTION=on
+	{"GET " + adminFaultsRoute, http.HandlerFunc(getFaultsHandler)},
+	{"PUT " + adminFaultsRoute, http.HandlerFunc(putFaultsHandler)},
+	{"DELETE " + adminFaultsRoute, http.HandlerFunc(deleteFaultsHandler)},
+
+	// Effective configuration, 404 unless DEBUG_CONFIG_ENDPOINT=on
+	{"GET " + debugConfigRoute, http.HandlerFunc(debugConfigHandler)},
+}
+
+// newRouter registers all routes with Go 1.22 method and path patterns and
+// wraps them with OpenAPI validation, fault injection and instrumentation.
+// Requests that match no pattern get a JSON 404, or 405 when only the method
+// is wrong.
+func newRouter() (http.Handler, error) {
+	v, err := newValidator(appConfig.OpenAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		mux.Handle(route.pattern, route.handler)
+	}
+
+	return instrumentHandler(mux, faultMiddleware(mux, v.Middleware(mux))), nil
+}
+
+// routeLabel turns a ServeMux pattern such as "GET /api/v1/hello" into the
+// route used for metric labels, span names and logs
+func routeLabel(pattern string) string {
+	if pattern == "" {
+		return unmatchedRoute
+	}
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+	return strings.TrimSuffix(pattern, "{$}")
+}
+
+// methodLabel bounds the method label to the standard HTTP methods
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// spanName follows the OpenTelemetry HTTP convention "{method} {route}",
+// falling back to the method alone when no route matched
+func spanName(method, route string) string {
+	if route == unmatchedRoute {
+		return method
+	}
+	return method + " " + route
+}
+
+// jsonErrorWriter replaces the plain-text error bodies the ServeMux writes
+// for unmatched requests with an ErrorResponse
+type jsonErrorWriter struct {
+	http.ResponseWriter
+	replaced bool
+}
+
+func (w *jsonErrorWriter) WriteHeader(code int) {
+	if code < http.StatusBadRequest {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.replaced = true
+	message := http.StatusText(code)
+	switch code {
+	case http.StatusNotFound:
+		message = "Not found"
+	case http.StatusMethodNotAllowed:
+		message = "Method not allowed"
+	}
+	respondJSON(w.ResponseWriter, code, ErrorResponse{Error: message})
+}
+
+func (w *jsonErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
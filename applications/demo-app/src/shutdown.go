@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+// telemetry is what the shutdown sequence flushes, the TracerProvider
+type telemetry interface {
+	Shutdown(ctx context.Context) error
+}
+
+// runServer serves on ln until the server fails or a signal arrives, then
+// shuts down in order:
+//
+//  1. /ready answers 503 and keep-alives are disabled, while requests are
+//     still served for the pre-stop delay
+//  2. the listener closes, idle connections are closed and in-flight
+//     requests get the drain timeout to finish
+//  3. the OTel batcher is flushed with a context of its own
+//
+// The steps are timed by cfg, which must fit in the pod's
+// terminationGracePeriodSeconds. A second signal skips what is left of
+// steps 1 and 2. The exit code is 0 only if the server stopped on a signal
+// and every step succeeded.
+func runServer(srv *http.Server, ln net.Listener, signals <-chan os.Signal, tp telemetry, cfg config.Shutdown) int {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	code := 0
+	select {
+	case err := <-serveErr:
+		slog.Error("Server failed", "error", err)
+		code = 1
+	case sig := <-signals:
+		slog.Info("Shutting down", "signal", sig.String(),
+			"pre_stop_delay", cfg.PreStopDelay.String(), "drain_timeout", cfg.DrainTimeout.String())
+		if err := drain(srv, signals, cfg); err != nil {
+			slog.Error("Server did not shut down cleanly", "error", err)
+			code = 1
+		}
+	}
+
+	if err := flushTelemetry(tp, time.Duration(cfg.FlushTimeout)); err != nil {
+		slog.Error("Error shutting down tracer", "error", err)
+		code = 1
+	}
+	slog.Info("Server exited", "code", code)
+	return code
+}
+
+// drain takes the instance out of rotation, waits the pre-stop delay and
+// shuts the server down
+func drain(srv *http.Server, signals <-chan os.Signal, cfg config.Shutdown) error {
+	readiness.StartDraining()
+	// Responses now carry Connection: close, so clients reconnect, through
+	// endpoints that no longer include this pod
+	srv.SetKeepAlivesEnabled(false)
+
+	delay := time.NewTimer(time.Duration(cfg.PreStopDelay))
+	defer delay.Stop()
+	select {
+	case <-delay.C:
+	case sig := <-signals:
+		srv.Close()
+		return fmt.Errorf("second %s during the pre-stop delay, connections closed", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DrainTimeout))
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- srv.Shutdown(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			srv.Close()
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("requests still in flight after %s, connections closed", cfg.DrainTimeout)
+			}
+			return err
+		}
+		return nil
+	case sig := <-signals:
+		srv.Close()
+		<-done
+		return fmt.Errorf("second %s while draining, connections closed", sig)
+	}
+}
+
+// flushTelemetry exports the spans left in the batcher. The context is
+// fresh: the one the server ran with is already done by now.
+func flushTelemetry(tp telemetry, timeout time.Duration) error {
+	if tp == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return tp.Shutdown(ctx)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+// shutdownServer is a server running under runServer, with the signal
+// channel that stops it and the exit code once it has
+type shutdownServer struct {
+	url     string
+	signals chan os.Signal
+	code    chan int
+	spans   *spanRecorder
+}
+
+// spanRecorder keeps exported spans across the provider's shutdown, which
+// tracetest.InMemoryExporter resets on
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (r *spanRecorder) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Shutdown(context.Context) error { return nil }
+
+func (r *spanRecorder) GetSpans() []sdktrace.ReadOnlySpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]sdktrace.ReadOnlySpan(nil), r.spans...)
+}
+
+// newBatchedProvider returns a provider holding one ended span in a batcher
+// that only exports on shutdown
+func newBatchedProvider() (*sdktrace.TracerProvider, *spanRecorder) {
+	spans := &spanRecorder{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spans, sdktrace.WithBatchTimeout(time.Hour)))
+	_, span := tp.Tracer("test").Start(context.Background(), "before-shutdown")
+	span.End()
+	return tp, spans
+}
+
+// startShutdownServer serves the router, with /slow added, through runServer,
+// with a span from newBatchedProvider to tell whether the batcher was flushed
+func startShutdownServer(t *testing.T, cfg config.Shutdown, slow time.Duration) *shutdownServer {
+	t.Helper()
+	savedReadiness := readiness
+	readiness = &readinessRegistry{}
+	t.Cleanup(func() { readiness = savedReadiness })
+
+	router, err := newRouter()
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("/", router)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(slow)
+		w.Write([]byte("done"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	tp, spans := newBatchedProvider()
+
+	s := &shutdownServer{
+		url:     "http://" + ln.Addr().String(),
+		signals: make(chan os.Signal, 2),
+		code:    make(chan int, 1),
+		spans:   spans,
+	}
+	go func() { s.code <- runServer(&http.Server{Handler: mux}, ln, s.signals, tp, cfg) }()
+	return s
+}
+
+func (s *shutdownServer) get(path string) (*http.Response, error) {
+	resp, err := http.Get(s.url + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	return resp, err
+}
+
+func (s *shutdownServer) exitCode(t *testing.T) int {
+	t.Helper()
+	select {
+	case code := <-s.code:
+		return code
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit")
+		return -1
+	}
+}
+
+func TestShutdownSequence(t *testing.T) {
+	s := startShutdownServer(t, config.Shutdown{
+		PreStopDelay: config.Duration(300 * time.Millisecond),
+		DrainTimeout: config.Duration(2 * time.Second),
+		FlushTimeout: config.Duration(time.Second),
+	}, 500*time.Millisecond)
+
+	resp, err := s.get("/ready")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// In flight when the signal arrives, finishing after the pre-stop delay
+	inFlight := make(chan error, 1)
+	go func() {
+		resp, err := s.get("/slow")
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = errors.New(resp.Status)
+		}
+		inFlight <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.signals <- syscall.SIGTERM
+	time.Sleep(50 * time.Millisecond)
+
+	// During the pre-stop delay: not ready, but still serving, without
+	// keeping connections alive
+	resp, err = http.Get(s.url + "/ready")
+	require.NoError(t, err)
+	var body ReadinessResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "not_ready", body.Status)
+	require.Len(t, body.Checks, 1)
+	assert.Equal(t, "shutdown", body.Checks[0].Name)
+	assert.True(t, resp.Close, "responses should carry Connection: close")
+
+	resp, err = s.get("/health")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, <-inFlight, "in-flight request should complete")
+	assert.Equal(t, 0, s.exitCode(t))
+	assert.Len(t, s.spans.GetSpans(), 1, "batched span should be flushed")
+
+	_, err = s.get("/health")
+	assert.Error(t, err, "listener should be closed")
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	s := startShutdownServer(t, config.Shutdown{
+		DrainTimeout: config.Duration(100 * time.Millisecond),
+		FlushTimeout: config.Duration(time.Second),
+	}, 2*time.Second)
+
+	go s.get("/slow")
+	time.Sleep(50 * time.Millisecond)
+	s.signals <- syscall.SIGTERM
+
+	assert.Equal(t, 1, s.exitCode(t), "requests cut off by the drain timeout")
+	assert.Len(t, s.spans.GetSpans(), 1, "span should be flushed after a forced shutdown")
+}
+
+func TestShutdownSecondSignal(t *testing.T) {
+	s := startShutdownServer(t, config.Shutdown{
+		PreStopDelay: config.Duration(time.Minute),
+		DrainTimeout: config.Duration(time.Minute),
+		FlushTimeout: config.Duration(time.Second),
+	}, 0)
+
+	s.signals <- syscall.SIGTERM
+	s.signals <- syscall.SIGINT
+
+	assert.Equal(t, 1, s.exitCode(t))
+	assert.Len(t, s.spans.GetSpans(), 1)
+}
+
+func TestServerFailureFlushesTelemetry(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln.Close()
+
+	tp, spans := newBatchedProvider()
+
+	code := runServer(&http.Server{}, ln, make(chan os.Signal), tp, config.Shutdown{FlushTimeout: config.Duration(time.Second)})
+	assert.Equal(t, 1, code)
+	assert.Len(t, spans.GetSpans(), 1)
+}
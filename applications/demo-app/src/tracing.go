@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+// initTracer initializes the OpenTelemetry tracer provider from the tracing
+// section of the configuration, which is read from the standard SDK
+// environment variables:
+//
+//	OTEL_TRACES_EXPORTER         otlp (default), console or none
+//	OTEL_TRACES_SAMPLER          always_on, always_off, traceidratio,
+//	                             parentbased_always_on (default),
+//	                             parentbased_always_off, parentbased_traceidratio
+//	OTEL_TRACES_SAMPLER_ARG      sampling ratio for the *traceidratio samplers
+//	OTEL_EXPORTER_OTLP_ENDPOINT  collector endpoint, host:port or URL (default the
+//	                             lab collector on 4317, or 4318 for http/protobuf)
+//	OTEL_EXPORTER_OTLP_PROTOCOL  grpc (default) or http/protobuf
+//	OTEL_EXPORTER_OTLP_HEADERS   key=value pairs sent with every export
+//	OTEL_EXPORTER_OTLP_INSECURE  disable TLS (default true unless TLS files are set)
+//	OTEL_EXPORTER_OTLP_CERTIFICATE, OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE,
+//	OTEL_EXPORTER_OTLP_CLIENT_KEY  PEM files for TLS and mTLS
+//	OTEL_SERVICE_NAME            service.name (default demo-app)
+//	OTEL_RESOURCE_ATTRIBUTES     key=value pairs added to the resource
+//
+// OTEL_EXPORTER_OTLP_TLS_DIR is a shortcut for a mounted cert-manager
+// Secret: ca.crt, tls.crt and tls.key are picked up from that directory.
+func initTracer(ctx context.Context, cfg *config.Config) (*sdktrace.TracerProvider, error) {
+	sampler, err := newSampler(cfg.Tracing.Sampler, cfg.Tracing.SamplerArg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create resource with service and build information.
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES come last and win, as
+	// in the SDK specification; the chart sets the pod's namespace and name
+	// through them.
+	info := getBuildInfo()
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName("demo-app"),
+			semconv.ServiceVersion(info.Version),
+			attribute.String("environment", cfg.App.Environment),
+			attribute.String("build.commit", info.Commit),
+			attribute.String("build.date", info.BuildDate),
+			attribute.String("build.go_version", info.GoVersion),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	}
+
+	switch exp := tracesExporter(cfg.Tracing); exp {
+	case "none":
+		// Spans are still created so trace IDs are propagated and logged
+	case "console", "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case "otlp":
+		exporter, err := newOTLPExporter(ctx, cfg.Tracing.OTLP)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER: unsupported exporter %q", exp)
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+
+	otel.SetTracerProvider(tp)
+
+	return tp, nil
+}
+
+// tracesExporter returns the configured span exporter name
+func tracesExporter(cfg config.Tracing) string {
+	return strings.ToLower(cfg.Exporter)
+}
+
+// newSampler builds a sampler from its OTEL_TRACES_SAMPLER name and the
+// ratio of the *traceidratio samplers
+func newSampler(name string, ratio float64) (sdktrace.Sampler, error) {
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG: %g is not a ratio between 0 and 1", ratio)
+	}
+
+	switch strings.ToLower(name) {
+	case "always_on":
+		return sdktrace.AlwaysSample(), nil
+	case "always_off":
+		return sdktrace.NeverSample(), nil
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case "", "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_SAMPLER: unsupported sampler %q", name)
+	}
+}
+
+// newOTLPExporter creates a gRPC or HTTP OTLP exporter depending on the
+// configured protocol
+func newOTLPExporter(ctx context.Context, cfg config.OTLP) (*otlptrace.Exporter, error) {
+	tlsCfg, err := otlpTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := cfg.HeaderMap()
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+
+	switch protocol := strings.ToLower(cfg.Protocol); protocol {
+	case "grpc":
+		opts := []otlptracegrpc.Option{otlpGRPCEndpoint(cfg.Endpoint), otlptracegrpc.WithHeaders(headers)}
+		if tlsCfg != nil {
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+		} else {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "http/protobuf":
+		opts := []otlptracehttp.Option{otlpHTTPEndpoint(cfg.Endpoint), otlptracehttp.WithHeaders(headers)}
+		if tlsCfg != nil {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsCfg))
+		} else {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL: unsupported protocol %q", protocol)
+	}
+}
+
+func otlpGRPCEndpoint(endpoint string) otlptracegrpc.Option {
+	if strings.Contains(endpoint, "://") {
+		return otlptracegrpc.WithEndpointURL(endpoint)
+	}
+	return otlptracegrpc.WithEndpoint(endpoint)
+}
+
+func otlpHTTPEndpoint(endpoint string) otlptracehttp.Option {
+	if strings.Contains(endpoint, "://") {
+		return otlptracehttp.WithEndpointURL(endpoint)
+	}
+	return otlptracehttp.WithEndpoint(endpoint)
+}
+
+// otlpTLSConfig returns the TLS configuration for the OTLP exporter, or nil
+// when the connection should be plaintext
+func otlpTLSConfig(otlp config.OTLP) (*tls.Config, error) {
+	caFile, certFile, keyFile := otlp.Certificate, otlp.ClientCertificate, otlp.ClientKey
+	if otlp.TLSDir != "" {
+		caFile = filepath.Join(otlp.TLSDir, "ca.crt")
+		certFile = filepath.Join(otlp.TLSDir, "tls.crt")
+		keyFile = filepath.Join(otlp.TLSDir, "tls.key")
+	}
+
+	insecure := caFile == "" && certFile == "" && !strings.HasPrefix(otlp.Endpoint, "https://")
+	if otlp.Insecure != nil {
+		insecure = *otlp.Insecure
+	}
+	if insecure {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading OTLP CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading OTLP client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/prometheus/client_golang/prometheus"
+
+	demoapp "github.com/yourusername/kubernetes-extreme-lab/demo-app"
+	"github.com/yourusername/kubernetes-extreme-lab/demo-app/config"
+)
+
+var openapiViolationsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "openapi_validation_violations_total",
+		Help: "Requests and responses that did not conform to openapi.yaml",
+	},
+	[]string{"direction", "endpoint"},
+)
+
+func init() {
+	registry.MustRegister(openapiViolationsTotal)
+	// /metrics answers in OpenMetrics when Prometheus asks for it; its body
+	// is text like the Prometheus format
+	openapi3filter.RegisterBodyDecoder("application/openmetrics-text", openapi3filter.RegisteredBodyDecoder("text/plain"))
+}
+
+// Validation modes selected by OPENAPI_VALIDATION
+const (
+	validationOff     = "off"
+	validationRequest = "request"
+	validationDebug   = "debug"
+)
+
+// validator checks traffic against the embedded OpenAPI spec. Requests that
+// do not conform are rejected with an ErrorResponse; in debug mode responses
+// are validated too and violations are logged and counted, but still sent.
+type validator struct {
+	doc          *openapi3.T
+	router       routers.Router
+	mode         string
+	maxBodyBytes int64
+}
+
+// newValidator loads the embedded spec; cfg selects the mode, "request",
+// "debug" or "off", and the request body limit
+func newValidator(cfg config.OpenAPI) (*validator, error) {
+	mode := cfg.Validation
+	switch mode {
+	case validationOff, validationRequest, validationDebug:
+	default:
+		return nil, fmt.Errorf("OPENAPI_VALIDATION: unknown mode %q", mode)
+	}
+
+	maxBodyBytes := cfg.MaxRequestBodyBytes
+	if maxBodyBytes <= 0 {
+		return nil, fmt.Errorf("MAX_REQUEST_BODY_BYTES: must be a positive integer")
+	}
+
+	doc, err := loadSpec(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("building OpenAPI router: %w", err)
+	}
+
+	return &validator{doc: doc, router: router, mode: mode, maxBodyBytes: maxBodyBytes}, nil
+}
+
+// loadSpec parses and validates the embedded OpenAPI document
+func loadSpec(ctx context.Context) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(demoapp.OpenAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("loading openapi.yaml: %w", err)
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("invalid openapi.yaml: %w", err)
+	}
+
+	// The servers list documents example hosts; match on path only so the
+	// spec applies behind any Service, Ingress or port-forward
+	doc.Servers = nil
+	return doc, nil
+}
+
+// Middleware wraps next with request (and in debug mode response) validation
+func (v *validator) Middleware(next http.Handler) http.Handler {
+	if v.mode == validationOff {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, v.maxBodyBytes)
+
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			if errors.Is(err, routers.ErrMethodNotAllowed) {
+				w.Header().Set("Allow", v.allowedMethods(r.URL.Path))
+				respondJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+				return
+			}
+			// Undocumented paths are left to the mux, which answers 404
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		endpoint := route.Path
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			openapiViolationsTotal.WithLabelValues("request", endpoint).Inc()
+
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				respondJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{
+					Error: fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit),
+				})
+				return
+			}
+
+			respondJSON(w, http.StatusBadRequest, ErrorResponse{Error: validationMessage(err)})
+			return
+		}
+
+		if v.mode != validationDebug {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tw := &teeResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(tw, r)
+
+		respInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 tw.status,
+			Header:                 w.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(tw.body.Bytes())),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		}
+		if err := openapi3filter.ValidateResponse(r.Context(), respInput); err != nil {
+			openapiViolationsTotal.WithLabelValues("response", endpoint).Inc()
+			slog.WarnContext(r.Context(), "Response does not match openapi.yaml",
+				"endpoint", endpoint,
+				"status", tw.status,
+				"error", err,
+			)
+		}
+	})
+}
+
+// allowedMethods lists the methods the spec documents for path
+func (v *validator) allowedMethods(path string) string {
+	item := v.doc.Paths.Find(path)
+	if item == nil {
+		return ""
+	}
+
+	var methods []string
+	for method := range item.Operations() {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// validationMessage condenses an openapi3filter error into a client-facing
+// message without dumping the schema
+func validationMessage(err error) string {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return "Invalid request"
+	}
+
+	reason := reqErr.Reason
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		reason = schemaErr.Reason
+	} else if reason == "" && reqErr.Err != nil {
+		reason = reqErr.Err.Error()
+	}
+
+	switch {
+	case reqErr.Parameter != nil:
+		return fmt.Sprintf("Invalid %s parameter %q: %s", reqErr.Parameter.In, reqErr.Parameter.Name, reason)
+	case reqErr.RequestBody != nil:
+		return "Invalid request body: " + reason
+	default:
+		return "Invalid request: " + reason
+	}
+}
+
+// teeResponseWriter passes the response through while keeping a copy of
+// the status and body for validation
+type teeResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *teeResponseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *teeResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
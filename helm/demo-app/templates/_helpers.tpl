@@ -58,3 +58,11 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+"true" when the canary shifts traffic through the Istio VirtualService
+rather than by replica count
+*/}}
+{{- define "demo-app.istioCanary" -}}
+{{- if and .Values.argoRollouts.enabled (eq .Values.argoRollouts.strategy "canary") .Values.istio.enabled }}true{{ end }}
+{{- end }}
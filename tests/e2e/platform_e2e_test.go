@@ -2,26 +2,59 @@ package test
 
 import (
 	"context"
-	"fmt"
-	"io"
+	"encoding/json"
 	"net/http"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/common/expfmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/argocd"
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/chaos"
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/harness"
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/istio"
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/observability"
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/rollouts"
+	"github.com/yourusername/kubernetes-extreme-lab/tools/platformctl/health"
+)
+
+// Services the endpoint and canary tests work with
+const (
+	demoAppService   = "demo-app"
+	demoAppPort      = 80
+	demoAppContainer = "demo-app"
+
+	// kube-prometheus-stack's operated service, selected by the demo-app
+	// ServiceMonitor's release: prometheus label
+	prometheusNamespace = "observability"
+	prometheusService   = "prometheus-operated"
+	prometheusPort      = 9090
+
+	// Query endpoints of the Loki and Tempo charts
+	lokiNamespace  = "observability"
+	lokiService    = "loki-gateway"
+	lokiPort       = 80
+	tempoNamespace = "observability"
+	tempoService   = "tempo-query-frontend"
+	tempoPort      = 3100
+
+	demoAppLogSelector = `{namespace="demo"}`
+
+	// faultInjectionEnv turns demo-app's app-level faults on; the lab
+	// values keep them off
+	faultInjectionEnv = "FAULT_INJECTION"
 )
 
 // TestFullPlatformDeployment validates end-to-end platform functionality
 func TestFullPlatformDeployment(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping E2E test in short mode")
-	}
-
-	clientset := getKubernetesClient(t)
+	h := harness.New(t)
+	clientset := h.Clientset
 
 	t.Run("AllNamespacesCreated", func(t *testing.T) {
 		expectedNamespaces := []string{
@@ -62,13 +95,34 @@ func TestFullPlatformDeployment(t *testing.T) {
 	})
 }
 
-// TestDemoApplicationDeployment validates demo app full lifecycle
-func TestDemoApplicationDeployment(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping E2E test in short mode")
+// TestPlatformHealth runs the `platformctl health` checks. Critical and
+// unknown results fail; warnings are logged.
+func TestPlatformHealth(t *testing.T) {
+	h := harness.New(t)
+	clients := health.Clients{Kube: h.Clientset, Dynamic: h.Dynamic}
+
+	report := health.Run(context.Background(), clients, health.Default(), 30*time.Second)
+	for _, res := range report.Results {
+		t.Run(res.Check, func(t *testing.T) {
+			switch res.Status {
+			case health.StatusCritical, health.StatusUnknown:
+				t.Errorf("%s: %s", res.Status, res.Message)
+			case health.StatusWarning:
+				t.Logf("warning: %s", res.Message)
+			case health.StatusSkipped:
+				t.Skip(res.Message)
+			}
+			for _, detail := range res.Details {
+				t.Log(detail)
+			}
+		})
 	}
+}
 
-	clientset := getKubernetesClient(t)
+// TestDemoApplicationDeployment validates demo app full lifecycle
+func TestDemoApplicationDeployment(t *testing.T) {
+	h := harness.New(t)
+	clientset := h.Clientset
 	namespace := "demo"
 
 	t.Run("DemoAppDeployed", func(t *testing.T) {
@@ -76,23 +130,8 @@ func TestDemoApplicationDeployment(t *testing.T) {
 		defer cancel()
 
 		// Wait for demo-app to be deployed
-		for {
-			select {
-			case <-ctx.Done():
-				t.Fatal("Timeout waiting for demo-app deployment")
-			default:
-				pods, err := clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
-					LabelSelector: "app=demo-app",
-				})
-
-				if err == nil && len(pods.Items) > 0 && pods.Items[0].Status.Phase == "Running" {
-					t.Log("demo-app is running")
-					return
-				}
-
-				time.Sleep(10 * time.Second)
-			}
-		}
+		_, err := h.WaitForPodsReady(ctx, namespace, "app=demo-app", 1)
+		require.NoError(t, err, "Timeout waiting for demo-app deployment")
 	})
 
 	t.Run("DemoAppServiceAccessible", func(t *testing.T) {
@@ -106,34 +145,72 @@ func TestDemoApplicationDeployment(t *testing.T) {
 	})
 
 	t.Run("DemoAppHealthEndpoint", func(t *testing.T) {
-		// Port-forward and test health endpoint
-		// In real E2E test, would use kubectl port-forward or expose service
+		baseURL := forwardDemoApp(t, h)
 
-		t.Skip("Requires port-forward setup")
+		resp, err := http.Get(baseURL + "/health")
+		require.NoError(t, err)
+		defer resp.Body.Close()
 
-		// Expected test flow:
-		// 1. kubectl port-forward svc/demo-app 8080:8080 -n demo
-		// 2. curl http://localhost:8080/health
-		// 3. Assert 200 OK with {"status": "ok"}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		var health struct {
+			Status  string `json:"status"`
+			Version string `json:"version"`
+			Uptime  string `json:"uptime"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+		assert.Equal(t, "healthy", health.Status)
+		assert.NotEmpty(t, health.Version)
+		assert.NotEmpty(t, health.Uptime)
 	})
 
 	t.Run("DemoAppMetricsEndpoint", func(t *testing.T) {
-		t.Skip("Requires port-forward setup")
-
-		// Expected test flow:
-		// 1. kubectl port-forward svc/demo-app 8080:8080 -n demo
-		// 2. curl http://localhost:8080/metrics
-		// 3. Assert Prometheus metrics are exposed
+		baseURL := forwardDemoApp(t, h)
+
+		// Request metrics only have series once the pod has served a request
+		resp, err := http.Get(baseURL + "/health")
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		resp, err = http.Get(baseURL + "/metrics")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(resp.Body)
+		require.NoError(t, err, "/metrics should be in the Prometheus text exposition format")
+
+		for name, kind := range map[string]string{
+			"http_requests_total":           "COUNTER",
+			"http_request_duration_seconds": "HISTOGRAM",
+			"http_requests_in_flight":       "GAUGE",
+		} {
+			if assert.Contains(t, families, name) {
+				assert.Equal(t, kind, families[name].GetType().String(), "type of %s", name)
+			}
+		}
 	})
 }
 
+// forwardDemoApp port-forwards to the demo-app service for the rest of the
+// test and returns its base URL
+func forwardDemoApp(t *testing.T, h *harness.Harness) string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	baseURL, err := h.PortForwardService(ctx, t, "demo", demoAppService, demoAppPort)
+	require.NoError(t, err, "Should port-forward to demo-app")
+	return baseURL
+}
+
 // TestObservabilityStack validates full observability pipeline
 func TestObservabilityStack(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping E2E test in short mode")
-	}
-
-	clientset := getKubernetesClient(t)
+	h := harness.New(t)
+	clientset := h.Clientset
 	namespace := "observability"
 
 	t.Run("GrafanaAccessible", func(t *testing.T) {
@@ -147,83 +224,251 @@ func TestObservabilityStack(t *testing.T) {
 	})
 
 	t.Run("PrometheusScrapingTargets", func(t *testing.T) {
-		// Verify ServiceMonitors are created for demo-app
-		// In real test, would query Prometheus API for targets
+		// The demo-app ServiceMonitor should give Prometheus one healthy
+		// target per demo-app pod
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		baseURL, err := h.PortForwardService(ctx, t, prometheusNamespace, prometheusService, prometheusPort)
+		if apierrors.IsNotFound(err) {
+			t.Skip("Prometheus not deployed")
+		}
+		require.NoError(t, err, "Should port-forward to Prometheus")
 
-		t.Skip("Requires Prometheus API access")
+		prom := observability.NewPrometheus(baseURL, nil)
+		targets, err := prom.Targets(ctx)
+		require.NoError(t, err)
 
-		// Expected test flow:
-		// 1. Port-forward to Prometheus
-		// 2. Query /api/v1/targets
-		// 3. Assert demo-app target is present and up
+		demo := observability.FindTargets(targets, map[string]string{"namespace": "demo", "service": demoAppService})
+		require.NotEmpty(t, demo, "demo-app should be a Prometheus scrape target")
+		for _, target := range demo {
+			assert.Equal(t, observability.TargetUp, target.Health, "Target %s: %s", target.ScrapeURL, target.LastError)
+		}
+
+		up, err := prom.Query(ctx, `up{namespace="demo",service="demo-app"}`, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, up, len(demo), "One up series per target")
+		for _, s := range up {
+			assert.Equal(t, 1.0, s.Value, "up%v", s.Metric)
+		}
 	})
 
 	t.Run("LokiReceivingLogs", func(t *testing.T) {
-		// Verify Loki is receiving logs from demo-app
-		t.Skip("Requires Loki API access")
+		// Promtail should ship demo-app's JSON logs to Loki
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
 
-		// Expected test flow:
-		// 1. Port-forward to Loki
-		// 2. Query /loki/api/v1/query?query={app="demo-app"}
-		// 3. Assert logs are present
+		lokiURL, err := h.PortForwardService(ctx, t, lokiNamespace, lokiService, lokiPort)
+		if apierrors.IsNotFound(err) {
+			t.Skip("Loki not deployed")
+		}
+		require.NoError(t, err, "Should port-forward to Loki")
+
+		now := time.Now()
+		streams, err := observability.NewLoki(lokiURL, nil).QueryRange(ctx, demoAppLogSelector, now.Add(-15*time.Minute), now, 10)
+		require.NoError(t, err)
+		assert.NotEmpty(t, observability.Lines(streams), "Loki should hold demo-app logs from the last 15 minutes")
 	})
 
 	t.Run("TempoReceivingTraces", func(t *testing.T) {
-		// Verify Tempo is receiving OpenTelemetry traces
-		t.Skip("Requires Tempo API access")
+		// One request's trace_id should reach both Tempo, as a trace with
+		// demo-app spans, and Loki, in the request's log line
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+		defer cancel()
 
-		// Expected test flow:
-		// 1. Generate trace by calling demo-app
-		// 2. Query Tempo for trace ID
-		// 3. Assert trace spans are present
+		tempoURL, err := h.PortForwardService(ctx, t, tempoNamespace, tempoService, tempoPort)
+		if apierrors.IsNotFound(err) {
+			t.Skip("Tempo not deployed")
+		}
+		require.NoError(t, err, "Should port-forward to Tempo")
+		lokiURL, err := h.PortForwardService(ctx, t, lokiNamespace, lokiService, lokiPort)
+		if apierrors.IsNotFound(err) {
+			t.Skip("Loki not deployed")
+		}
+		require.NoError(t, err, "Should port-forward to Loki")
+
+		rt := &observability.RoundTrip{
+			AppURL:      forwardDemoApp(t, h),
+			Tempo:       observability.NewTempo(tempoURL, nil),
+			Loki:        observability.NewLoki(lokiURL, nil),
+			LogSelector: demoAppLogSelector,
+			Service:     demoAppService,
+		}
+		res, err := rt.Run(ctx)
+		require.NoError(t, err)
+		t.Logf("Trace %s: %d spans from %v, %d log lines", res.TraceID, len(res.Trace.Spans), res.Trace.Services(), len(res.Logs))
 	})
 }
 
-// TestCanaryDeploymentWorkflow validates Argo Rollouts canary
+// TestCanaryDeploymentWorkflow validates Argo Rollouts canary. The
+// progression tests roll demo-app out to $CANARY_IMAGE and back again.
 func TestCanaryDeploymentWorkflow(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping E2E test in short mode")
+	h := harness.New(t)
+	h.Diagnose("demo", "argo-rollouts")
+
+	canary := &rollouts.Canary{
+		Rollouts:  rollouts.NewClient(h.Dynamic),
+		Istio:     istio.NewClient(h.Dynamic),
+		Namespace: "demo",
+		Name:      demoAppService,
+		Logf:      t.Logf,
 	}
+	apps := argocd.NewClient(h.Dynamic)
 
 	t.Run("RolloutResourceExists", func(t *testing.T) {
-		// Verify Rollout CRD is present
-		// In real test, would query argoproj.io/v1alpha1 Rollout
-		assert.True(t, true, "Rollout CRD should exist")
+		ro, err := canary.Rollouts.Get(context.Background(), "demo", demoAppService)
+		require.NoError(t, err, "demo-app Rollout should exist")
+		require.NotNil(t, ro.Spec.Strategy.Canary, "demo-app should use the canary strategy")
+		assert.NotEmpty(t, ro.Steps(), "Canary should define steps")
+		assert.NotEmpty(t, ro.VirtualServices(), "Canary should shift traffic through the Istio VirtualService")
+		assert.True(t, ro.Completed(), "Rollout should be Healthy on a fully promoted revision, phase=%s", ro.Status.Phase)
 	})
 
 	t.Run("CanaryProgressionWorks", func(t *testing.T) {
-		// Test canary deployment: 20% → 40% → 100%
-		t.Skip("Requires Rollout progression simulation")
-
-		// Expected test flow:
-		// 1. Update demo-app image tag
-		// 2. Watch Rollout status
-		// 3. Assert progression: 20% canary
-		// 4. Wait for pause
-		// 5. Promote to 40%
-		// 6. Promote to 100%
-		// 7. Assert stable revision is new version
+		// Test canary deployment: 20% → 40% → ... → 100%, promoting at
+		// every pause and checking the traffic split before each promotion
+		image := canaryImage(t)
+		ro := restoreImageOnCleanup(t, canary, apps)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+		defer cancel()
+
+		results, err := canary.Run(ctx, demoAppContainer, image)
+		require.NoError(t, err)
+
+		var want, got []int32
+		for i, step := range ro.Steps() {
+			if step.Pause != nil {
+				want = append(want, ro.WeightAt(int32(i)))
+			}
+		}
+		want = append(want, 100)
+		for _, res := range results {
+			got = append(got, res.Weight)
+		}
+		assert.Equal(t, want, got, "Traffic to the new revision at each pause")
+
+		for _, res := range results {
+			assert.True(t, res.Routed, "VirtualService weights should be checked at %s", res)
+		}
+	})
+
+	t.Run("CanaryAbortRollsBack", func(t *testing.T) {
+		image := canaryImage(t)
+		ro := restoreImageOnCleanup(t, canary, apps)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		_, err := canary.Start(ctx, demoAppContainer, image)
+		require.NoError(t, err)
+		_, err = canary.WaitForStep(ctx, firstPause(ro))
+		require.NoError(t, err)
+
+		res, err := canary.Abort(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int32(0), res.Weight, "Aborted canary should receive no traffic")
+		assert.True(t, res.Routed, "VirtualService weights should be checked after the abort")
 	})
 
 	t.Run("AutoPromotionAfterAnalysis", func(t *testing.T) {
-		// Verify AnalysisRun promotes canary automatically
-		t.Skip("Requires metrics-based analysis")
-
-		// Expected test flow:
-		// 1. Deploy new version
-		// 2. AnalysisRun queries Prometheus for error rate
-		// 3. If error rate < threshold, auto-promote
-		// 4. Assert promotion occurred
+		// Let timed pauses expire and background analysis run; the rollout
+		// must complete without manual promotion
+		image := canaryImage(t)
+		ro := restoreImageOnCleanup(t, canary, apps)
+		for i, step := range ro.Steps() {
+			if step.Pause != nil && step.Pause.Duration == nil {
+				t.Skipf("Step %d pauses until promoted manually", i)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Minute)
+		defer cancel()
+
+		started, err := canary.Start(ctx, demoAppContainer, image)
+		require.NoError(t, err)
+		done, err := canary.WaitForStep(ctx, int32(len(ro.Steps())))
+		require.NoError(t, err)
+		_, err = canary.Verify(ctx, done)
+		assert.NoError(t, err)
+
+		runs, err := canary.Rollouts.AnalysisRuns(ctx, "demo", done, started.Status.CurrentPodHash)
+		require.NoError(t, err)
+		require.NotEmpty(t, runs, "Canary should be analysed")
+		for _, run := range runs {
+			assert.Equal(t, rollouts.AnalysisSuccessful, run.Status.Phase, "AnalysisRun %s: %s", run.Name, run.Status.Message)
+		}
 	})
 }
 
-// TestSecurityPoliciesEnforced validates Kyverno and OPA policies
-func TestSecurityPoliciesEnforced(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping E2E test in short mode")
+// canaryImage returns the image to roll demo-app out to, skipping the test
+// when none is configured
+func canaryImage(t *testing.T) string {
+	image := os.Getenv("CANARY_IMAGE")
+	if image == "" {
+		t.Skip("Set CANARY_IMAGE to a demo-app image other than the running one")
+	}
+	return image
+}
+
+// restoreImageOnCleanup returns the Rollout as it is now and, when the test
+// ends, rolls it back to its current image, skipping the canary steps.
+// Automated sync of the demo-app Application, and of the apps of apps
+// above it, is suspended meanwhile, so self-heal does not revert the
+// canary image to the one in Git.
+func restoreImageOnCleanup(t *testing.T, canary *rollouts.Canary, apps *argocd.Client) *rollouts.Rollout {
+	ro, err := canary.Rollouts.Get(context.Background(), canary.Namespace, canary.Name)
+	require.NoError(t, err)
+	require.True(t, ro.Completed(), "Rollout should be fully promoted before a canary starts")
+	image := ro.ContainerImage(demoAppContainer)
+
+	restoreSync, err := apps.SuspendAutomatedSync(context.Background(), "argocd", demoAppService)
+	require.NoError(t, err, "suspending automated sync of the demo-app Application")
+	// Registered first, so it runs after the image is restored
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := restoreSync(ctx); err != nil {
+			t.Errorf("Restoring automated sync: %v", err)
+		}
+	})
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		if err := canary.Rollouts.SetImage(ctx, canary.Namespace, canary.Name, demoAppContainer, image); err != nil {
+			t.Errorf("Restoring %s: %v", image, err)
+			return
+		}
+		if err := canary.Rollouts.PromoteFull(ctx, canary.Namespace, canary.Name); err != nil {
+			t.Errorf("Promoting %s: %v", image, err)
+			return
+		}
+		_, err := canary.Rollouts.Until(ctx, canary.Namespace, canary.Name, func(ro *rollouts.Rollout) (bool, error) {
+			return ro.Completed() && ro.ContainerImage(demoAppContainer) == image, nil
+		})
+		if err != nil {
+			t.Errorf("Waiting for %s to be restored: %v", image, err)
+		}
+	})
+	return ro
+}
+
+// firstPause returns the index of the first pause step
+func firstPause(ro *rollouts.Rollout) int32 {
+	for i, step := range ro.Steps() {
+		if step.Pause != nil {
+			return int32(i)
+		}
 	}
+	return int32(len(ro.Steps()))
+}
 
-	clientset := getKubernetesClient(t)
+// TestSecurityPoliciesEnforced validates Kyverno and OPA policies
+func TestSecurityPoliciesEnforced(t *testing.T) {
+	h := harness.New(t)
+	clientset := h.Clientset
 
 	t.Run("NetworkPolicyAutoGenerated", func(t *testing.T) {
 		// Verify Kyverno auto-generates NetworkPolicy for new namespaces
@@ -289,12 +534,10 @@ func TestSecurityPoliciesEnforced(t *testing.T) {
 
 // TestCertificateManagement validates cert-manager functionality
 func TestCertificateManagement(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping E2E test in short mode")
-	}
+	h := harness.New(t)
 
 	t.Run("CertManagerWebhookHealthy", func(t *testing.T) {
-		clientset := getKubernetesClient(t)
+		clientset := h.Clientset
 
 		webhook, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(
 			context.Background(),
@@ -318,11 +561,124 @@ func TestCertificateManagement(t *testing.T) {
 	})
 }
 
+// TestChaosPodDelete is the demo-app-pod-delete ChaosEngine from
+// tests/chaos/litmus_chaos_experiments.yaml in Go: demo-app must answer
+// /health before a pod is deleted and again once it has been replaced. The
+// probe goes through the API server's service proxy, since a port-forward
+// would end with the pod it was opened to.
+func TestChaosPodDelete(t *testing.T) {
+	h := harness.New(t)
+	h.Diagnose("demo")
+
+	client, baseURL, err := h.ServiceProxy("demo", demoAppService, demoAppPort)
+	require.NoError(t, err)
+	health := chaos.HTTPProbe{ProbeName: "check-demo-app-health", URL: baseURL + "/health", Client: client}
+	pods := chaos.PodsReady(h.Clientset, "demo", "app=demo-app", 1)
+
+	experiment := &chaos.Experiment{
+		Name:        "demo-app-pod-delete",
+		SteadyState: []chaos.Probe{pods, health},
+		Action:      &chaos.DeletePods{Client: h.Clientset, Namespace: "demo", Selector: "app=demo-app"},
+		Duration:    10 * time.Second,
+		Logf:        t.Logf,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	report := experiment.Run(ctx)
+
+	var summary strings.Builder
+	require.NoError(t, report.WriteText(&summary))
+	t.Log("\n" + summary.String())
+	assert.True(t, report.Passed(), report.String())
+}
+
+// TestChaosAppFaults turns demo-app's app-level fault injection on for the
+// test only and checks that an X-Fault-Inject header fails requests while
+// probes keep answering. Faults are per pod, so the test uses the header
+// rather than /admin/faults, which would configure a single replica.
+func TestChaosAppFaults(t *testing.T) {
+	h := harness.New(t)
+	h.Diagnose("demo", "argo-rollouts")
+
+	client, baseURL, err := h.ServiceProxy("demo", demoAppService, demoAppPort)
+	require.NoError(t, err)
+	get := func(t *testing.T, path, spec string) int {
+		req, err := http.NewRequest(http.MethodGet, baseURL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Fault-Inject", spec)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("OffByDefault", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, get(t, "/api/v1/hello", "error=100,status=503"), "The header should be ignored while faults are off")
+	})
+
+	enableAppFaults(t, rollouts.NewClient(h.Dynamic), argocd.NewClient(h.Dynamic))
+
+	t.Run("HeaderInjectsErrors", func(t *testing.T) {
+		assert.Equal(t, http.StatusServiceUnavailable, get(t, "/api/v1/hello", "error=100,status=503"))
+		assert.Equal(t, http.StatusOK, get(t, "/api/v1/hello", ""), "Requests without the header are not faulted")
+	})
+}
+
+// enableAppFaults sets FAULT_INJECTION=on on the demo-app Rollout and puts
+// it back when the test ends. Automated sync of the demo-app Application,
+// and of the apps of apps above it, is suspended meanwhile, so self-heal
+// does not revert the variable.
+func enableAppFaults(t *testing.T, rc *rollouts.Client, apps *argocd.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	restoreSync, err := apps.SuspendAutomatedSync(ctx, "argocd", demoAppService)
+	require.NoError(t, err, "suspending automated sync of the demo-app Application")
+	// Registered first, so it runs after the variable is restored
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := restoreSync(ctx); err != nil {
+			t.Errorf("Restoring automated sync: %v", err)
+		}
+	})
+
+	on := "on"
+	previous, err := rc.SetEnv(ctx, "demo", demoAppService, demoAppContainer, faultInjectionEnv, &on)
+	require.NoError(t, err, "enabling fault injection")
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		_, err := rc.SetEnv(ctx, "demo", demoAppService, demoAppContainer, faultInjectionEnv, previous)
+		if err == nil {
+			err = promoteFaultInjection(ctx, rc, previous)
+		}
+		if err != nil {
+			t.Errorf("Restoring %s: %v", faultInjectionEnv, err)
+		}
+	})
+	require.NoError(t, promoteFaultInjection(ctx, rc, &on), "promoting fault injection")
+}
+
+// promoteFaultInjection waits for the demo-app revision with FAULT_INJECTION
+// set to value, or unset when value is nil, to be fully promoted, skipping
+// its canary steps
+func promoteFaultInjection(ctx context.Context, rc *rollouts.Client, value *string) error {
+	if err := rc.PromoteFull(ctx, "demo", demoAppService); err != nil {
+		return err
+	}
+	_, err := rc.Until(ctx, "demo", demoAppService, func(ro *rollouts.Rollout) (bool, error) {
+		got, set := ro.ContainerEnv(demoAppContainer, faultInjectionEnv)
+		return ro.Completed() && set == (value != nil) && (value == nil || got == *value), nil
+	})
+	return err
+}
+
 // TestDisasterRecovery validates backup and restore capability
 func TestDisasterRecovery(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping E2E test in short mode")
-	}
+	harness.SkipIfShort(t)
 
 	t.Run("VeleroBackupCreated", func(t *testing.T) {
 		// Verify Velero creates scheduled backups
@@ -335,14 +691,3 @@ func TestDisasterRecovery(t *testing.T) {
 		t.Skip("Velero not implemented yet")
 	})
 }
-
-// getKubernetesClient creates a Kubernetes clientset
-func getKubernetesClient(t *testing.T) *kubernetes.Clientset {
-	config, err := clientcmd.BuildConfigFromFlags("", clientcmd.RecommendedHomeFile)
-	require.NoError(t, err, "Failed to load kubeconfig")
-
-	clientset, err := kubernetes.NewForConfig(config)
-	require.NoError(t, err, "Failed to create Kubernetes client")
-
-	return clientset
-}
@@ -8,17 +8,31 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/argocd"
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/harness"
 )
 
-// TestArgoCDDeployment validates ArgoCD is deployed and healthy
-func TestArgoCDDeployment(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
+// gitopsDir holds the Application manifests the cluster is expected to run
+const gitopsDir = "../../gitops"
+
+// Time each Application gets to become Synced and Healthy. Applications
+// are waited for concurrently, so the longest entry must fit within the
+// go test -timeout of the integration suite.
+var (
+	applicationTimeouts = map[string]time.Duration{
+		"istiod":             8 * time.Minute,
+		"kong":               8 * time.Minute,
+		"grafana":            8 * time.Minute,
+		"microservices-demo": 8 * time.Minute,
 	}
+	defaultApplicationTimeout = 5 * time.Minute
+)
 
-	clientset := getKubernetesClient(t)
+// TestArgoCDDeployment validates ArgoCD is deployed and healthy
+func TestArgoCDDeployment(t *testing.T) {
+	h := harness.New(t)
+	clientset := h.Clientset
 	namespace := "argocd"
 
 	t.Run("ArgoCDNamespaceExists", func(t *testing.T) {
@@ -60,21 +74,35 @@ func TestArgoCDDeployment(t *testing.T) {
 
 // TestArgoCDApplications validates ArgoCD Applications are synced
 func TestArgoCDApplications(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
-	clientset := getKubernetesClient(t)
+	h := harness.New(t)
+	clientset := h.Clientset
+	apps := argocd.NewClient(h.Dynamic)
 	namespace := "argocd"
 
-	// Wait for Applications to be created
-	time.Sleep(10 * time.Second)
-
 	t.Run("RootApplicationExists", func(t *testing.T) {
-		// In real test, would use ArgoCD API client
-		// Here we check if the Application CRD is present
-		_, err := clientset.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
+		root, err := apps.Get(context.Background(), namespace, "root")
+		require.NoError(t, err, "root Application should be applied by bootstrap")
+		require.NotNil(t, root.Spec.Source)
+		assert.Equal(t, "gitops/bootstrap", root.Spec.Source.Path)
+	})
+
+	t.Run("ApplicationsSyncedAndHealthy", func(t *testing.T) {
+		expected, err := argocd.LoadApplications(gitopsDir)
 		require.NoError(t, err)
+		require.NotEmpty(t, expected, "no Applications found under %s", gitopsDir)
+
+		names := make([]string, len(expected))
+		for i, app := range expected {
+			names[i] = app.Name
+		}
+
+		// The error of an app that times out lists every drifted resource
+		results := apps.WaitAll(context.Background(), namespace, names, applicationTimeouts, defaultApplicationTimeout)
+		for _, res := range results {
+			t.Run(res.Name, func(t *testing.T) {
+				assert.NoError(t, res.Err)
+			})
+		}
 	})
 
 	t.Run("PlatformComponentsHealthy", func(t *testing.T) {
@@ -95,23 +123,11 @@ func TestArgoCDApplications(t *testing.T) {
 				defer cancel()
 
 				// Wait for namespace to exist
-				for {
-					select {
-					case <-ctx.Done():
-						t.Fatalf("Timeout waiting for namespace %s", component.namespace)
-					default:
-						_, err := clientset.CoreV1().Namespaces().Get(context.Background(), component.namespace, metav1.GetOptions{})
-						if err == nil {
-							goto namespaceFound
-						}
-						time.Sleep(2 * time.Second)
-					}
-				}
+				require.NoError(t, h.WaitForNamespace(ctx, component.namespace))
 
-			namespaceFound:
 				// Check deployment health
-				deployment, err := clientset.AppsV1().Deployments(component.namespace).Get(
-					context.Background(),
+				_, err := clientset.AppsV1().Deployments(component.namespace).Get(
+					ctx,
 					component.deployment,
 					metav1.GetOptions{},
 				)
@@ -121,7 +137,7 @@ func TestArgoCDApplications(t *testing.T) {
 					return
 				}
 
-				assert.Greater(t, deployment.Status.ReadyReplicas, int32(0),
+				assert.NoError(t, h.WaitForDeploymentReady(ctx, component.namespace, component.deployment),
 					"Deployment %s/%s should have ready replicas", component.namespace, component.deployment)
 			})
 		}
@@ -130,30 +146,30 @@ func TestArgoCDApplications(t *testing.T) {
 
 // TestAppOfAppsPattern validates the App-of-Apps hierarchy
 func TestAppOfAppsPattern(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
+	h := harness.New(t)
+	apps := argocd.NewClient(h.Dynamic)
 
 	t.Run("RootApplicationBootstraps", func(t *testing.T) {
-		// Validate root-application.yaml creates child apps
-		// In real test, would query ArgoCD API for Application resources
-		assert.True(t, true, "Root application should create platform-apps and application-apps")
-	})
+		root, err := apps.Get(context.Background(), "argocd", "root")
+		require.NoError(t, err)
 
-	t.Run("SyncWavesRespected", func(t *testing.T) {
-		// Validate deployment order via sync waves
-		// cert-manager (wave 0) should deploy before istio-base (wave 2)
-		assert.True(t, true, "Sync waves should enforce deployment order")
+		children := map[string]bool{}
+		for _, res := range root.Status.Resources {
+			if res.Kind == "Application" {
+				children[res.Name] = true
+			}
+		}
+		for _, name := range []string{"argocd-projects", "platform-apps", "application-apps"} {
+			assert.True(t, children[name], "Root application should create %s", name)
+		}
 	})
-}
-
-// getKubernetesClient creates a Kubernetes clientset from kubeconfig
-func getKubernetesClient(t *testing.T) *kubernetes.Clientset {
-	config, err := clientcmd.BuildConfigFromFlags("", clientcmd.RecommendedHomeFile)
-	require.NoError(t, err, "Failed to load kubeconfig")
 
-	clientset, err := kubernetes.NewForConfig(config)
-	require.NoError(t, err, "Failed to create Kubernetes client")
+	t.Run("SyncWavesRespected", func(t *testing.T) {
+		// cert-manager (wave 0) should have first synced before istio-base (wave 2)
+		list, err := apps.List(context.Background(), "argocd")
+		require.NoError(t, err)
+		require.NotEmpty(t, list, "no Applications in argocd namespace")
 
-	return clientset
+		assert.NoError(t, argocd.VerifySyncWaveOrder(list), "Sync waves should enforce deployment order")
+	})
 }
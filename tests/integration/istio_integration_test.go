@@ -2,24 +2,24 @@ package test
 
 import (
 	"context"
-	"fmt"
-	"io"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/harness"
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/istio"
 )
 
 // TestIstioMeshDeployment validates Istio service mesh is deployed
 func TestIstioMeshDeployment(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
-	clientset := getKubernetesClient(t)
+	h := harness.New(t)
+	clientset := h.Clientset
 	namespace := "istio-system"
 
 	t.Run("IstioNamespaceExists", func(t *testing.T) {
@@ -56,38 +56,36 @@ func TestIstioMeshDeployment(t *testing.T) {
 
 // TestIstioAutoMTLS validates automatic mTLS is enabled
 func TestIstioAutoMTLS(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
-	clientset := getKubernetesClient(t)
+	client := istio.NewClient(harness.New(t).Dynamic)
 
 	t.Run("PeerAuthenticationExists", func(t *testing.T) {
-		// Check for default PeerAuthentication in istio-system
-		// This would use Istio client in real test
-		namespace := "istio-system"
-		_, err := clientset.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
-		require.NoError(t, err)
+		// A selector-less policy in the root namespace applies mesh-wide
+		pa, err := client.GetPeerAuthentication(context.Background(), "istio-system", "default")
+		require.NoError(t, err, "Default PeerAuthentication should exist in istio-system")
 
-		// In real test: query for security.istio.io/v1beta1 PeerAuthentication
-		// Expected: mode: STRICT for mTLS
-		assert.True(t, true, "Default PeerAuthentication should enable mTLS")
+		assert.True(t, pa.MeshWide(), "Default PeerAuthentication should not have a workload selector")
+		assert.NoError(t, istio.VerifyStrictMTLS(pa), "Default PeerAuthentication should enforce STRICT mTLS")
 	})
 
 	t.Run("DestinationRulesMTLSEnabled", func(t *testing.T) {
-		// Verify DestinationRules have mTLS configured
-		// In real test: query networking.istio.io/v1beta1 DestinationRule
-		assert.True(t, true, "DestinationRules should use ISTIO_MUTUAL tls mode")
+		rules, err := client.ListDestinationRules(context.Background(), "")
+		require.NoError(t, err)
+
+		if len(rules) == 0 {
+			t.Skip("No DestinationRules defined (auto mTLS applies)")
+			return
+		}
+
+		for i := range rules {
+			assert.NoError(t, istio.VerifyIstioMutual(&rules[i]), "DestinationRules should use ISTIO_MUTUAL tls mode")
+		}
 	})
 }
 
 // TestIstioSidecarInjection validates automatic sidecar injection
 func TestIstioSidecarInjection(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
-	clientset := getKubernetesClient(t)
+	h := harness.New(t)
+	clientset := h.Clientset
 
 	t.Run("SidecarInjectorWebhookExists", func(t *testing.T) {
 		webhook, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(
@@ -127,32 +125,27 @@ func TestIstioSidecarInjection(t *testing.T) {
 
 // TestIstioVirtualService validates VirtualService routing
 func TestIstioVirtualService(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
+	client := istio.NewClient(harness.New(t).Dynamic)
+	vs := getDemoAppVirtualService(t, client)
 
 	t.Run("DemoAppVirtualServiceExists", func(t *testing.T) {
-		// In real test: query networking.istio.io/v1beta1 VirtualService
-		// Expected: demo-app VirtualService with retry policies
-		assert.True(t, true, "VirtualService should define routing rules")
+		assert.Contains(t, vs.Spec.Hosts, "demo-app.lab.local")
+		assert.NotEmpty(t, vs.Spec.HTTP, "VirtualService should define routing rules")
 	})
 
 	t.Run("RetryPolicyConfigured", func(t *testing.T) {
 		// Verify retry policy: 3 attempts, 2s perTryTimeout
-		assert.True(t, true, "VirtualService should have retry policy")
+		assert.NoError(t, istio.VerifyRetries(vs, 3, 2*time.Second), "VirtualService should have retry policy")
 	})
 
 	t.Run("CORSPolicyConfigured", func(t *testing.T) {
-		// Verify CORS policy is set
-		assert.True(t, true, "VirtualService should have CORS policy")
+		assert.NoError(t, istio.VerifyCORS(vs), "VirtualService should have CORS policy")
 	})
 }
 
 // TestIstioObservability validates telemetry integration
 func TestIstioObservability(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
+	harness.SkipIfShort(t)
 
 	t.Run("AccessLogsEnabled", func(t *testing.T) {
 		// Verify Istio access logging is enabled
@@ -174,14 +167,22 @@ func TestIstioObservability(t *testing.T) {
 
 // TestIstioTrafficManagement validates canary deployment capability
 func TestIstioTrafficManagement(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
+	client := istio.NewClient(harness.New(t).Dynamic)
 
 	t.Run("TrafficSplitSupported", func(t *testing.T) {
-		// Verify VirtualService can split traffic between versions
-		// Used by Argo Rollouts for canary deployments
-		assert.True(t, true, "VirtualService should support traffic splitting")
+		// Argo Rollouts shifts canary traffic by rewriting these weights,
+		// so every route must always account for 100% of requests
+		services, err := client.ListVirtualServices(context.Background(), "demo")
+		require.NoError(t, err)
+
+		if len(services) == 0 {
+			t.Skip("demo-app not deployed yet")
+			return
+		}
+
+		for i := range services {
+			assert.NoError(t, istio.VerifyWeights(&services[i]), "Route weights should sum to 100")
+		}
 	})
 
 	t.Run("WeightBasedRouting", func(t *testing.T) {
@@ -192,14 +193,48 @@ func TestIstioTrafficManagement(t *testing.T) {
 
 // TestIstioGatewayIntegration validates Kong + Istio integration
 func TestIstioGatewayIntegration(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
+	h := harness.New(t)
+	client := istio.NewClient(h.Dynamic)
 
 	t.Run("IstioGatewayExists", func(t *testing.T) {
-		// Verify Istio Gateway resource for Kong integration
-		// Kong handles North-South, Istio handles East-West
-		assert.True(t, true, "Istio Gateway should integrate with Kong")
+		// Every Gateway the demo-app VirtualService binds to must exist and
+		// expose its hosts on the HTTP port Kong forwards to
+		vs := getDemoAppVirtualService(t, client)
+
+		for _, ref := range vs.Spec.Gateways {
+			if ref == "mesh" {
+				continue
+			}
+
+			namespace, name, ok := strings.Cut(ref, "/")
+			if !ok {
+				namespace, name = vs.Namespace, ref
+			}
+
+			gw, err := client.GetGateway(context.Background(), namespace, name)
+			require.NoError(t, err, "Gateway %s referenced by VirtualService should exist", ref)
+
+			for _, host := range vs.Spec.Hosts {
+				assert.NoError(t, istio.VerifyGatewayServes(gw, 80, host))
+			}
+		}
+	})
+
+	t.Run("RoutesThroughIngressGateway", func(t *testing.T) {
+		// Each host of the demo-app VirtualService reaches the app through
+		// the ingress gateway's Envoy
+		vs := getDemoAppVirtualService(t, client)
+		require.NotEmpty(t, vs.Spec.Hosts, "VirtualService should route at least one host")
+		gatewayURL := forwardIngressGateway(t, h)
+
+		for _, host := range vs.Spec.Hosts {
+			resp, err := sendRequestThroughIstio(gatewayURL, host, "/health")
+			require.NoError(t, err, "GET /health for %s through the gateway", host)
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "GET /health for %s through the gateway", host)
+			verifyIstioHeaders(t, resp.Header)
+		}
 	})
 
 	t.Run("EndToEndTracing", func(t *testing.T) {
@@ -210,11 +245,8 @@ func TestIstioGatewayIntegration(t *testing.T) {
 
 // TestIstioNetworkPolicy validates NetworkPolicy enforcement
 func TestIstioNetworkPolicy(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
-	clientset := getKubernetesClient(t)
+	h := harness.New(t)
+	clientset := h.Clientset
 
 	t.Run("DemoNamespaceHasNetworkPolicy", func(t *testing.T) {
 		namespace := "demo"
@@ -233,26 +265,50 @@ func TestIstioNetworkPolicy(t *testing.T) {
 	})
 }
 
-// Helper: Send HTTP request through Istio ingress
-func sendRequestThroughIstio(t *testing.T, path string) (*http.Response, error) {
-	// Port-forward to istio-ingressgateway or use LoadBalancer IP
-	ingressURL := fmt.Sprintf("http://localhost:8080%s", path)
-
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// getDemoAppVirtualService fetches the VirtualService rendered by the
+// demo-app chart, skipping the test when the app is not deployed
+func getDemoAppVirtualService(t *testing.T, client *istio.Client) *istio.VirtualService {
+	vs, err := client.GetVirtualService(context.Background(), "demo", "demo-app")
+	if apierrors.IsNotFound(err) {
+		t.Skip("demo-app not deployed yet")
 	}
+	require.NoError(t, err)
+
+	return vs
+}
+
+// forwardIngressGateway port-forwards to istio-ingressgateway's HTTP port
+// for the rest of t and returns its base URL. Open it once per test and
+// pass it to every sendRequestThroughIstio.
+func forwardIngressGateway(t *testing.T, h *harness.Harness) string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
-	resp, err := client.Get(ingressURL)
+	gatewayURL, err := h.PortForwardService(ctx, t, "istio-system", "istio-ingressgateway", 80)
+	require.NoError(t, err, "Should port-forward to istio-ingressgateway")
+	return gatewayURL
+}
+
+// Helper: Send HTTP request for host through the Istio ingress gateway
+// forwarded at gatewayURL
+func sendRequestThroughIstio(gatewayURL, host, path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, gatewayURL+path, nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Host = host
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
 
-	return resp, nil
+	return client.Do(req)
 }
 
-// Helper: Verify Istio headers in response
+// Helper: Verify the response was proxied by the Istio gateway's Envoy
 func verifyIstioHeaders(t *testing.T, headers http.Header) {
-	// Istio adds tracing headers
+	// Envoy times the upstream and Istio names its proxies in Server; it
+	// does not return X-Request-Id unless configured to
 	assert.NotEmpty(t, headers.Get("X-Envoy-Upstream-Service-Time"), "Should have Envoy timing header")
-	assert.NotEmpty(t, headers.Get("X-Request-Id"), "Should have request ID")
+	assert.Equal(t, "istio-envoy", headers.Get("Server"), "Should be served by the Istio gateway")
 }
@@ -0,0 +1,278 @@
+package argocd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/harness"
+)
+
+// newApplication builds an unstructured Application as Argo CD reports it
+func newApplication(name, wave, parent string, started time.Time, sync, health string, resources ...map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "argocd",
+		},
+		"spec": map[string]interface{}{
+			"project":     "platform",
+			"destination": map[string]interface{}{"namespace": name},
+		},
+		"status": map[string]interface{}{
+			"sync":   map[string]interface{}{"status": sync},
+			"health": map[string]interface{}{"status": health},
+		},
+	}}
+	if wave != "" {
+		obj.SetAnnotations(map[string]string{SyncWaveAnnotation: wave})
+	}
+	if parent != "" {
+		obj.SetLabels(map[string]string{instanceLabel: parent})
+	}
+	if !started.IsZero() {
+		resync(obj, 0, started)
+	}
+	if len(resources) > 0 {
+		list := make([]interface{}, len(resources))
+		for i, res := range resources {
+			list[i] = res
+		}
+		_ = unstructured.SetNestedSlice(obj.Object, list, "status", "resources")
+	}
+	return obj
+}
+
+// resync records sync id of obj, started at the given time, as its last
+// operation and in its history
+func resync(obj *unstructured.Unstructured, id int64, started time.Time) *unstructured.Unstructured {
+	_ = unstructured.SetNestedField(obj.Object, map[string]interface{}{
+		"phase":     "Succeeded",
+		"startedAt": started.UTC().Format(time.RFC3339),
+	}, "status", "operationState")
+	history, _, _ := unstructured.NestedSlice(obj.Object, "status", "history")
+	history = append(history, map[string]interface{}{
+		"id":              id,
+		"revision":        "main",
+		"deployStartedAt": started.UTC().Format(time.RFC3339),
+		"deployedAt":      started.Add(30 * time.Second).UTC().Format(time.RFC3339),
+	})
+	_ = unstructured.SetNestedSlice(obj.Object, history, "status", "history")
+	return obj
+}
+
+func newFakeClient(objects ...runtime.Object) (*Client, *dynamicfake.FakeDynamicClient) {
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), ListKinds, objects...)
+	return NewClient(dyn), dyn
+}
+
+func TestClientListSortsBySyncWave(t *testing.T) {
+	client, _ := newFakeClient(
+		newApplication("istiod", "3", "platform-apps", time.Time{}, SyncStatusSynced, HealthHealthy),
+		newApplication("cert-manager", "0", "platform-apps", time.Time{}, SyncStatusSynced, HealthHealthy),
+		newApplication("argocd", "1", "platform-apps", time.Time{}, SyncStatusSynced, HealthHealthy),
+		newApplication("kong", "", "platform-apps", time.Time{}, SyncStatusSynced, HealthHealthy),
+	)
+
+	apps, err := client.List(context.Background(), "argocd")
+	require.NoError(t, err)
+
+	var names []string
+	for _, app := range apps {
+		names = append(names, app.Name)
+	}
+	assert.Equal(t, []string{"cert-manager", "kong", "argocd", "istiod"}, names)
+	assert.Equal(t, "platform-apps", apps[0].Parent())
+}
+
+func TestWaitForSyncedHealthy(t *testing.T) {
+	client, dyn := newFakeClient(
+		newApplication("demo-app", "10", "application-apps", time.Time{}, SyncStatusOutOfSync, HealthProgressing),
+	)
+
+	// Argo CD finishes the rollout shortly after the wait starts
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		synced := newApplication("demo-app", "10", "application-apps", time.Now(), SyncStatusSynced, HealthHealthy)
+		_, err := dyn.Resource(ApplicationResource).Namespace("argocd").Update(context.Background(), synced, metav1.UpdateOptions{})
+		assert.NoError(t, err)
+	}()
+
+	app, err := client.WaitForSyncedHealthy(context.Background(), "argocd", "demo-app", 5*time.Second)
+	require.NoError(t, err)
+	assert.True(t, app.SyncedAndHealthy())
+}
+
+func TestWaitForSyncedHealthyReportsDrift(t *testing.T) {
+	client, _ := newFakeClient(
+		newApplication("demo-app", "10", "application-apps", time.Now(), SyncStatusOutOfSync, HealthDegraded,
+			map[string]interface{}{"group": "argoproj.io", "kind": "Rollout", "namespace": "demo", "name": "demo-app",
+				"status": "Synced", "health": map[string]interface{}{"status": "Degraded", "message": "ProgressDeadlineExceeded"}},
+			map[string]interface{}{"kind": "Service", "namespace": "demo", "name": "demo-app", "status": "OutOfSync"},
+			map[string]interface{}{"kind": "ConfigMap", "namespace": "demo", "name": "legacy", "status": "OutOfSync", "requiresPruning": true},
+			map[string]interface{}{"kind": "ServiceAccount", "namespace": "demo", "name": "demo-app", "status": "Synced"},
+		),
+	)
+
+	_, err := client.WaitForSyncedHealthy(context.Background(), "argocd", "demo-app", 200*time.Millisecond)
+	require.Error(t, err)
+
+	msg := err.Error()
+	assert.Contains(t, msg, "sync=OutOfSync health=Degraded")
+	assert.Contains(t, msg, "argoproj.io/Rollout demo/demo-app: sync=Synced health=Degraded (ProgressDeadlineExceeded)")
+	assert.Contains(t, msg, "Service demo/demo-app: sync=OutOfSync")
+	assert.Contains(t, msg, "ConfigMap demo/legacy: sync=OutOfSync requires pruning")
+	assert.NotContains(t, msg, "ServiceAccount")
+}
+
+func TestWaitForSyncedHealthyMissing(t *testing.T) {
+	client, _ := newFakeClient()
+
+	_, err := client.WaitForSyncedHealthy(context.Background(), "argocd", "missing", 100*time.Millisecond)
+	assert.ErrorContains(t, err, "application argocd/missing not found")
+}
+
+func TestSuspendAutomatedSync(t *testing.T) {
+	ctx := context.Background()
+	automated := map[string]interface{}{"prune": true, "selfHeal": true}
+	withAutomated := func(obj *unstructured.Unstructured) *unstructured.Unstructured {
+		require.NoError(t, unstructured.SetNestedMap(obj.Object, automated, "spec", "syncPolicy", "automated"))
+		return obj
+	}
+	client, dyn := newFakeClient(
+		withAutomated(newApplication("root", "", "", time.Time{}, SyncStatusSynced, HealthHealthy)),
+		withAutomated(newApplication("application-apps", "", "root", time.Time{}, SyncStatusSynced, HealthHealthy)),
+		withAutomated(newApplication("demo-app", "10", "application-apps", time.Time{}, SyncStatusSynced, HealthHealthy)),
+		newApplication("manual", "", "", time.Time{}, SyncStatusSynced, HealthHealthy),
+		withAutomated(newApplication("orphan", "", "elsewhere", time.Time{}, SyncStatusSynced, HealthHealthy)),
+	)
+	automatedOf := func(name string) (map[string]interface{}, bool) {
+		obj, err := dyn.Resource(ApplicationResource).Namespace("argocd").Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		policy, found, _ := unstructured.NestedMap(obj.Object, "spec", "syncPolicy", "automated")
+		return policy, found
+	}
+
+	restore, err := client.SuspendAutomatedSync(ctx, "argocd", "demo-app")
+	require.NoError(t, err)
+	for _, name := range []string{"demo-app", "application-apps", "root"} {
+		_, found := automatedOf(name)
+		assert.False(t, found, "automated sync of %s should be removed", name)
+	}
+	require.NoError(t, restore(ctx))
+	for _, name := range []string{"demo-app", "application-apps", "root"} {
+		policy, _ := automatedOf(name)
+		assert.Equal(t, automated, policy, name)
+	}
+
+	restore, err = client.SuspendAutomatedSync(ctx, "argocd", "manual")
+	require.NoError(t, err)
+	require.NoError(t, restore(ctx))
+	_, found := automatedOf("manual")
+	assert.False(t, found, "a manual sync policy stays manual")
+
+	_, err = client.SuspendAutomatedSync(ctx, "argocd", "orphan")
+	assert.NoError(t, err, "a parent outside the namespace is skipped")
+
+	_, err = client.SuspendAutomatedSync(ctx, "argocd", "missing")
+	assert.Error(t, err)
+}
+
+func TestWaitAllUsesPerAppTimeouts(t *testing.T) {
+	client, _ := newFakeClient(
+		newApplication("cert-manager", "0", "platform-apps", time.Now(), SyncStatusSynced, HealthHealthy),
+		newApplication("istiod", "3", "platform-apps", time.Now(), SyncStatusSynced, HealthProgressing),
+	)
+
+	start := time.Now()
+	results := client.WaitAll(context.Background(), "argocd", []string{"cert-manager", "istiod"},
+		map[string]time.Duration{"istiod": 150 * time.Millisecond}, 10*time.Second)
+
+	require.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorContains(t, results[1].Err, "not Synced/Healthy after 150ms")
+	assert.Less(t, time.Since(start), 5*time.Second, "a healthy app must not wait for the default timeout")
+}
+
+func TestVerifySyncWaveOrder(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	decodeAll := func(objs ...*unstructured.Unstructured) []Application {
+		apps := make([]Application, len(objs))
+		for i, obj := range objs {
+			app, err := harness.Decode[Application](obj)
+			require.NoError(t, err)
+			apps[i] = *app
+		}
+		return apps
+	}
+
+	t.Run("InOrder", func(t *testing.T) {
+		apps := decodeAll(
+			newApplication("cert-manager", "0", "platform-apps", base, SyncStatusSynced, HealthHealthy),
+			newApplication("istio-base", "2", "platform-apps", base.Add(time.Minute), SyncStatusSynced, HealthHealthy),
+			newApplication("istiod", "3", "platform-apps", base.Add(2*time.Minute), SyncStatusSynced, HealthHealthy),
+			newApplication("kong", "3", "platform-apps", base.Add(90*time.Second), SyncStatusSynced, HealthHealthy),
+			newApplication("not-synced", "1", "platform-apps", time.Time{}, SyncStatusOutOfSync, HealthMissing),
+			// Siblings under another parent are ordered independently
+			newApplication("demo-app", "10", "application-apps", base.Add(-time.Hour), SyncStatusSynced, HealthHealthy),
+		)
+		assert.NoError(t, VerifySyncWaveOrder(apps))
+	})
+
+	t.Run("Inversion", func(t *testing.T) {
+		apps := decodeAll(
+			newApplication("istio-base", "2", "platform-apps", base.Add(time.Minute), SyncStatusSynced, HealthHealthy),
+			newApplication("istiod", "3", "platform-apps", base, SyncStatusSynced, HealthHealthy),
+		)
+		err := VerifySyncWaveOrder(apps)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "istiod (wave 3) started its initial sync at 2024-03-01T12:00:00Z, 1m0s before istio-base (wave 2)")
+	})
+
+	t.Run("LaterSyncsIgnored", func(t *testing.T) {
+		// cert-manager self-healed an hour after istio-base first synced
+		certManager := newApplication("cert-manager", "0", "platform-apps", base, SyncStatusSynced, HealthHealthy)
+		apps := decodeAll(
+			resync(certManager, 1, base.Add(time.Hour)),
+			newApplication("istio-base", "2", "platform-apps", base.Add(time.Minute), SyncStatusSynced, HealthHealthy),
+		)
+		assert.NoError(t, VerifySyncWaveOrder(apps))
+	})
+
+	t.Run("InitialSyncUnknown", func(t *testing.T) {
+		// History entry 0 was dropped, so the initial sync time is lost
+		trimmed := newApplication("istiod", "3", "platform-apps", time.Time{}, SyncStatusSynced, HealthHealthy)
+		apps := decodeAll(
+			newApplication("istio-base", "2", "platform-apps", base.Add(time.Minute), SyncStatusSynced, HealthHealthy),
+			resync(trimmed, 10, base),
+		)
+		assert.NoError(t, VerifySyncWaveOrder(apps))
+	})
+}
+
+func TestLoadApplications(t *testing.T) {
+	apps, err := LoadApplications("../../../gitops")
+	require.NoError(t, err)
+
+	byName := map[string]Application{}
+	for _, app := range apps {
+		assert.NotContains(t, byName, app.Name, "duplicate Application name")
+		byName[app.Name] = app
+	}
+
+	for _, name := range []string{"root", "argocd-projects", "platform-apps", "application-apps", "cert-manager", "istiod", "demo-app"} {
+		assert.Contains(t, byName, name)
+	}
+	assert.Equal(t, -2, apps[0].SyncWave(), "argocd-projects should sort first")
+	assert.Equal(t, "helm/demo-app", byName["demo-app"].Spec.Source.Path)
+	assert.Equal(t, []string{"values.yaml", "values-lab.yaml"}, byName["demo-app"].Spec.Source.Helm.ValueFiles)
+}
@@ -0,0 +1,270 @@
+package argocd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	watchtools "k8s.io/client-go/tools/watch"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/harness"
+)
+
+// Client reads Applications through a dynamic client, so no generated
+// Argo CD clientset is needed and a fake dynamic client can stand in for tests
+type Client struct {
+	dynamic dynamic.Interface
+}
+
+// NewClient wraps an existing dynamic client
+func NewClient(dyn dynamic.Interface) *Client {
+	return &Client{dynamic: dyn}
+}
+
+// NewForConfig creates a Client for the cluster described by config
+func NewForConfig(config *rest.Config) (*Client, error) {
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+	return NewClient(dyn), nil
+}
+
+// ListKinds maps each resource to its list kind, as required by
+// k8s.io/client-go/dynamic/fake.NewSimpleDynamicClientWithCustomListKinds
+var ListKinds = map[schema.GroupVersionResource]string{
+	ApplicationResource: "ApplicationList",
+}
+
+// Get fetches one Application. API errors are returned unwrapped so callers
+// can use apierrors.IsNotFound.
+func (c *Client) Get(ctx context.Context, namespace, name string) (*Application, error) {
+	obj, err := c.dynamic.Resource(ApplicationResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return harness.Decode[Application](obj)
+}
+
+// List returns the Applications in namespace sorted by sync wave, then name
+func (c *Client) List(ctx context.Context, namespace string) ([]Application, error) {
+	objs, err := c.dynamic.Resource(ApplicationResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make([]Application, 0, len(objs.Items))
+	for i := range objs.Items {
+		app, err := harness.Decode[Application](&objs.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, *app)
+	}
+	SortBySyncWave(apps)
+	return apps, nil
+}
+
+// SuspendAutomatedSync removes the automated sync policy of the Application
+// and of the apps of apps above it, whose self-heal would otherwise put the
+// Application's policy back, so Argo CD neither syncs nor self-heals it
+// while a test changes its resources. The returned func restores every
+// policy, the Application's first.
+func (c *Client) SuspendAutomatedSync(ctx context.Context, namespace, name string) (func(context.Context) error, error) {
+	var chain []string
+	for n := name; n != "" && !slices.Contains(chain, n); {
+		app, err := c.Get(ctx, namespace, n)
+		if apierrors.IsNotFound(err) && n != name {
+			// The parent lives in another namespace, or is gone
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, n)
+		n = app.Parent()
+	}
+
+	var restores []func(context.Context) error
+	restore := func(ctx context.Context) error {
+		var errs []error
+		for i := len(restores) - 1; i >= 0; i-- {
+			errs = append(errs, restores[i](ctx))
+		}
+		return errors.Join(errs...)
+	}
+	// From the root down, so no parent re-syncs a child already suspended
+	for i := len(chain) - 1; i >= 0; i-- {
+		r, err := c.suspendAutomatedSync(ctx, namespace, chain[i])
+		if err != nil {
+			return nil, errors.Join(err, restore(ctx))
+		}
+		restores = append(restores, r)
+	}
+	return restore, nil
+}
+
+// suspendAutomatedSync removes the automated sync policy of one
+// Application and returns a func that puts it back
+func (c *Client) suspendAutomatedSync(ctx context.Context, namespace, name string) (func(context.Context) error, error) {
+	resource := c.dynamic.Resource(ApplicationResource).Namespace(namespace)
+	obj, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	automated, found, err := unstructured.NestedMap(obj.Object, "spec", "syncPolicy", "automated")
+	if err != nil {
+		return nil, fmt.Errorf("application %s/%s: %w", namespace, name, err)
+	}
+	if !found {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	setAutomated := func(ctx context.Context, automated map[string]any) error {
+		patch, err := json.Marshal(map[string]any{
+			"spec": map[string]any{"syncPolicy": map[string]any{"automated": automated}},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := resource.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("patching application %s/%s: %w", namespace, name, err)
+		}
+		return nil
+	}
+	if err := setAutomated(ctx, nil); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error { return setAutomated(ctx, automated) }, nil
+}
+
+// WaitForSyncedHealthy watches the Application until it is Synced and
+// Healthy or timeout expires. On timeout the error lists the last observed
+// status and every drifted resource.
+func (c *Client) WaitForSyncedHealthy(ctx context.Context, namespace, name string, timeout time.Duration) (*Application, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resource := c.dynamic.Resource(ApplicationResource).Namespace(namespace)
+	lw := harness.ListWatchFor(resource.List, resource.Watch, harness.ByName(name))
+
+	var last *Application
+	_, err := watchtools.UntilWithSync(ctx, lw, &unstructured.Unstructured{}, nil, func(event watch.Event) (bool, error) {
+		obj, ok := event.Object.(*unstructured.Unstructured)
+		if !ok || obj.GetName() != name {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("application %s/%s was deleted", namespace, name)
+		}
+
+		app, err := harness.Decode[Application](obj)
+		if err != nil {
+			return false, err
+		}
+		last = app
+		return app.SyncedAndHealthy(), nil
+	})
+	if err == nil {
+		return last, nil
+	}
+	if wait.Interrupted(err) {
+		return last, timeoutError(namespace, name, timeout, last)
+	}
+	return last, err
+}
+
+// WaitResult is the outcome of waiting for one Application
+type WaitResult struct {
+	Name        string
+	Application *Application
+	Err         error
+}
+
+// WaitAll waits concurrently for every named Application to become Synced
+// and Healthy. Each gets its entry in timeouts, or defaultTimeout. Results
+// are returned in the order of names.
+func (c *Client) WaitAll(ctx context.Context, namespace string, names []string, timeouts map[string]time.Duration, defaultTimeout time.Duration) []WaitResult {
+	results := make([]WaitResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		timeout, ok := timeouts[name]
+		if !ok {
+			timeout = defaultTimeout
+		}
+
+		wg.Add(1)
+		go func(i int, name string, timeout time.Duration) {
+			defer wg.Done()
+			app, err := c.WaitForSyncedHealthy(ctx, namespace, name, timeout)
+			results[i] = WaitResult{Name: name, Application: app, Err: err}
+		}(i, name, timeout)
+	}
+	wg.Wait()
+	return results
+}
+
+func timeoutError(namespace, name string, timeout time.Duration, app *Application) error {
+	if app == nil {
+		return fmt.Errorf("application %s/%s not found after %s", namespace, name, timeout)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "application %s/%s not Synced/Healthy after %s: sync=%s health=%s",
+		namespace, name, timeout, app.Status.Sync.Status, app.Status.Health.Status)
+	if msg := app.Status.Health.Message; msg != "" {
+		fmt.Fprintf(&b, " (%s)", msg)
+	}
+	if op := app.Status.OperationState; op != nil && op.Message != "" {
+		fmt.Fprintf(&b, "\n  last operation %s: %s", op.Phase, op.Message)
+	}
+	if drift := FormatDrift(app.Drift()); drift != "" {
+		b.WriteString("\n")
+		b.WriteString(drift)
+	}
+	return errors.New(b.String())
+}
+
+// FormatDrift renders drifted resources one per line for test failures
+func FormatDrift(drift []ResourceStatus) string {
+	lines := make([]string, 0, len(drift))
+	for _, res := range drift {
+		line := fmt.Sprintf("  %s: sync=%s", res, res.Status)
+		if res.Health != nil && res.Health.Status != "" {
+			line += " health=" + res.Health.Status
+			if res.Health.Message != "" {
+				line += " (" + res.Health.Message + ")"
+			}
+		}
+		if res.RequiresPruning {
+			line += " requires pruning"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SortBySyncWave orders apps by sync wave, then name, as Argo CD applies them
+func SortBySyncWave(apps []Application) {
+	sort.SliceStable(apps, func(i, j int) bool {
+		if wi, wj := apps[i].SyncWave(), apps[j].SyncWave(); wi != wj {
+			return wi < wj
+		}
+		return apps[i].Name < apps[j].Name
+	})
+}
@@ -0,0 +1,71 @@
+package argocd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// LoadApplications reads every Application manifest under dir, such as the
+// repository's gitops/ directory, sorted by sync wave. These are the
+// Applications the cluster is expected to run.
+func LoadApplications(dir string) ([]Application, error) {
+	var apps []Application
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (!strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml")) {
+			return nil
+		}
+
+		found, err := readApplications(path)
+		if err != nil {
+			return err
+		}
+		apps = append(apps, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	SortBySyncWave(apps)
+	return apps, nil
+}
+
+func readApplications(path string) ([]Application, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var apps []Application
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return apps, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		var app Application
+		if err := yaml.Unmarshal(doc, &app); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if app.Kind == "Application" && strings.HasPrefix(app.APIVersion, ApplicationResource.Group+"/") {
+			apps = append(apps, app)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package argocd reads Argo CD Applications through the Kubernetes dynamic
+// client and checks their sync status, health, sync-wave ordering and
+// per-resource drift.
+//
+// Only the subset of argoproj.io/v1alpha1 the platform tests assert on is
+// modelled; unknown fields are ignored when decoding.
+package argocd
+
+import (
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ApplicationResource is the Application CRD installed by Argo CD
+var ApplicationResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+
+// SyncWaveAnnotation orders resources within a sync; lower waves go first
+const SyncWaveAnnotation = "argocd.argoproj.io/sync-wave"
+
+// Sync and health statuses reported by Argo CD
+const (
+	SyncStatusSynced    = "Synced"
+	SyncStatusOutOfSync = "OutOfSync"
+
+	HealthHealthy     = "Healthy"
+	HealthProgressing = "Progressing"
+	HealthDegraded    = "Degraded"
+	HealthMissing     = "Missing"
+)
+
+// Application is argoproj.io/v1alpha1 Application
+type Application struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ApplicationSpec   `json:"spec"`
+	Status            ApplicationStatus `json:"status,omitempty"`
+}
+
+type ApplicationSpec struct {
+	Project     string                 `json:"project,omitempty"`
+	Source      *ApplicationSource     `json:"source,omitempty"`
+	Sources     []ApplicationSource    `json:"sources,omitempty"`
+	Destination ApplicationDestination `json:"destination"`
+}
+
+type ApplicationSource struct {
+	RepoURL        string      `json:"repoURL"`
+	Path           string      `json:"path,omitempty"`
+	TargetRevision string      `json:"targetRevision,omitempty"`
+	Chart          string      `json:"chart,omitempty"`
+	Helm           *HelmSource `json:"helm,omitempty"`
+}
+
+type HelmSource struct {
+	ValueFiles []string `json:"valueFiles,omitempty"`
+}
+
+type ApplicationDestination struct {
+	Server    string `json:"server,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type ApplicationStatus struct {
+	Sync           SyncStatus        `json:"sync,omitempty"`
+	Health         HealthStatus      `json:"health,omitempty"`
+	OperationState *OperationState   `json:"operationState,omitempty"`
+	Resources      []ResourceStatus  `json:"resources,omitempty"`
+	ReconciledAt   *metav1.Time      `json:"reconciledAt,omitempty"`
+	History        []RevisionHistory `json:"history,omitempty"`
+}
+
+type SyncStatus struct {
+	Status   string `json:"status,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+type HealthStatus struct {
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type OperationState struct {
+	Phase      string       `json:"phase,omitempty"`
+	Message    string       `json:"message,omitempty"`
+	RetryCount int64        `json:"retryCount,omitempty"`
+	StartedAt  metav1.Time  `json:"startedAt"`
+	FinishedAt *metav1.Time `json:"finishedAt,omitempty"`
+}
+
+// RevisionHistory is one entry of status.history, added by every successful
+// sync. IDs count up from 0, and Argo CD drops the oldest entries beyond
+// spec.revisionHistoryLimit (10 by default).
+type RevisionHistory struct {
+	ID              int64        `json:"id"`
+	Revision        string       `json:"revision,omitempty"`
+	DeployedAt      metav1.Time  `json:"deployedAt"`
+	DeployStartedAt *metav1.Time `json:"deployStartedAt,omitempty"`
+}
+
+// ResourceStatus is the sync and health state of one managed resource
+type ResourceStatus struct {
+	Group           string        `json:"group,omitempty"`
+	Version         string        `json:"version,omitempty"`
+	Kind            string        `json:"kind,omitempty"`
+	Namespace       string        `json:"namespace,omitempty"`
+	Name            string        `json:"name,omitempty"`
+	Status          string        `json:"status,omitempty"`
+	Health          *HealthStatus `json:"health,omitempty"`
+	RequiresPruning bool          `json:"requiresPruning,omitempty"`
+}
+
+// SyncWave returns the application's sync-wave annotation, 0 when unset or
+// not an integer, matching Argo CD's own default
+func (a *Application) SyncWave() int {
+	wave, err := strconv.Atoi(a.Annotations[SyncWaveAnnotation])
+	if err != nil {
+		return 0
+	}
+	return wave
+}
+
+// SyncedAndHealthy reports whether Argo CD considers the application fully
+// rolled out
+func (a *Application) SyncedAndHealthy() bool {
+	return a.Status.Sync.Status == SyncStatusSynced && a.Status.Health.Status == HealthHealthy
+}
+
+// Drift returns the managed resources that are out of sync with Git,
+// waiting to be pruned, or unhealthy
+func (a *Application) Drift() []ResourceStatus {
+	var drift []ResourceStatus
+	for _, res := range a.Status.Resources {
+		unhealthy := res.Health != nil && res.Health.Status != "" && res.Health.Status != HealthHealthy
+		if res.Status != SyncStatusSynced || res.RequiresPruning || unhealthy {
+			drift = append(drift, res)
+		}
+	}
+	return drift
+}
+
+// String identifies the resource as group/kind namespace/name
+func (r ResourceStatus) String() string {
+	kind := r.Kind
+	if r.Group != "" {
+		kind = r.Group + "/" + r.Kind
+	}
+	name := r.Name
+	if r.Namespace != "" {
+		name = r.Namespace + "/" + r.Name
+	}
+	return kind + " " + name
+}
@@ -0,0 +1,88 @@
+package argocd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Argo CD records which Application manages an object either with the
+// tracking-id annotation or, by default, the instance label
+const (
+	trackingIDAnnotation = "argocd.argoproj.io/tracking-id"
+	instanceLabel        = "app.kubernetes.io/instance"
+)
+
+// Parent returns the name of the Application that manages a, or "" when it
+// was applied by hand, like the root of an app of apps
+func (a *Application) Parent() string {
+	if id := a.Annotations[trackingIDAnnotation]; id != "" {
+		parent, _, _ := strings.Cut(id, ":")
+		return parent
+	}
+	return a.Labels[instanceLabel]
+}
+
+// InitialSyncStarted returns when the Application's first sync began, from
+// status.history entry 0, or the zero time when that entry is gone: the app
+// never synced, or has synced so often since that Argo CD dropped it.
+// status.operationState is not used because it only holds the latest
+// operation, which every self-heal and re-sync overwrites; only the
+// initial syncs follow the waves.
+func (a *Application) InitialSyncStarted() time.Time {
+	for _, h := range a.Status.History {
+		if h.ID != 0 {
+			continue
+		}
+		if h.DeployStartedAt != nil {
+			return h.DeployStartedAt.Time
+		}
+		return h.DeployedAt.Time
+	}
+	return time.Time{}
+}
+
+// VerifySyncWaveOrder checks that, among Applications created by the same
+// parent, no Application started its initial sync before one in a lower
+// sync wave did. Later syncs, such as self-heals or manual re-syncs, are
+// not ordered by waves and are ignored; Applications whose initial sync is
+// unknown are skipped. Every inversion is reported.
+func VerifySyncWaveOrder(apps []Application) error {
+	siblings := map[string][]Application{}
+	for _, app := range apps {
+		if app.InitialSyncStarted().IsZero() {
+			continue
+		}
+		siblings[app.Parent()] = append(siblings[app.Parent()], app)
+	}
+
+	parents := make([]string, 0, len(siblings))
+	for parent := range siblings {
+		parents = append(parents, parent)
+	}
+	sort.Strings(parents)
+
+	var errs []error
+	for _, parent := range parents {
+		group := siblings[parent]
+		SortBySyncWave(group)
+
+		for i, earlier := range group {
+			for _, later := range group[i+1:] {
+				if later.SyncWave() == earlier.SyncWave() {
+					continue
+				}
+				laterStart := later.InitialSyncStarted()
+				earlierStart := earlier.InitialSyncStarted()
+				if laterStart.Before(earlierStart) {
+					errs = append(errs, fmt.Errorf("%s (wave %d) started its initial sync at %s, %s before %s (wave %d)",
+						later.Name, later.SyncWave(), laterStart.Format(time.RFC3339),
+						earlierStart.Sub(laterStart), earlier.Name, earlier.SyncWave()))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,162 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// DeletePods deletes Count of the pods matching Selector, picked at random,
+// like Litmus pod-delete. Their controller recreates them, so there is
+// nothing to revert.
+type DeletePods struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Selector  string
+	// Count is 1 if 0; more than match deletes them all
+	Count int
+	// GracePeriod overrides the pods' termination grace period; 0 forces
+	// the deletion, like Litmus FORCE=true
+	GracePeriod *int64
+
+	// Deleted lists the pods the last Inject deleted
+	Deleted []string
+}
+
+func (a *DeletePods) Name() string {
+	return fmt.Sprintf("delete-pods %s in %s", a.Selector, a.Namespace)
+}
+
+func (a *DeletePods) Inject(ctx context.Context) error {
+	pods, err := a.Client.CoreV1().Pods(a.Namespace).List(ctx, metav1.ListOptions{LabelSelector: a.Selector})
+	if err != nil {
+		return err
+	}
+
+	var candidates []string
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			candidates = append(candidates, pod.Name)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no pods matching %q in %s", a.Selector, a.Namespace)
+	}
+	sort.Strings(candidates)
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	count := max(a.Count, 1)
+	a.Deleted = nil
+	for _, name := range candidates[:min(count, len(candidates))] {
+		err := a.Client.CoreV1().Pods(a.Namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: a.GracePeriod})
+		if err != nil {
+			return fmt.Errorf("deleting pod %s/%s: %w", a.Namespace, name, err)
+		}
+		a.Deleted = append(a.Deleted, name)
+	}
+	return nil
+}
+
+func (a *DeletePods) Revert(context.Context) error { return nil }
+
+// ScaleToZero scales a Deployment to zero replicas, like a bad release or
+// an operator mistake taking a service away, and restores the replicas it
+// had on Revert
+type ScaleToZero struct {
+	Client     kubernetes.Interface
+	Namespace  string
+	Deployment string
+
+	replicas *int32
+}
+
+func (a *ScaleToZero) Name() string {
+	return fmt.Sprintf("scale-to-zero deployment %s/%s", a.Namespace, a.Deployment)
+}
+
+func (a *ScaleToZero) Inject(ctx context.Context) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		d, err := a.Client.AppsV1().Deployments(a.Namespace).Get(ctx, a.Deployment, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		zero := int32(0)
+		d.Spec.Replicas = &zero
+		if _, err := a.Client.AppsV1().Deployments(a.Namespace).Update(ctx, d, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		a.replicas = &replicas
+		return nil
+	})
+}
+
+// Revert restores the replicas Inject found; it does nothing if Inject
+// did not scale the Deployment
+func (a *ScaleToZero) Revert(ctx context.Context) error {
+	if a.replicas == nil {
+		return nil
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		d, err := a.Client.AppsV1().Deployments(a.Namespace).Get(ctx, a.Deployment, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		d.Spec.Replicas = a.replicas
+		_, err = a.Client.AppsV1().Deployments(a.Namespace).Update(ctx, d, metav1.UpdateOptions{})
+		return err
+	})
+	if err == nil {
+		a.replicas = nil
+	}
+	return err
+}
+
+// CordonNode marks a node unschedulable, as kubectl cordon, so pods deleted
+// or evicted during the experiment must be scheduled elsewhere. Revert
+// uncordons it, unless it was already cordoned.
+type CordonNode struct {
+	Client kubernetes.Interface
+	Node   string
+
+	cordoned bool
+}
+
+func (a *CordonNode) Name() string { return "cordon node " + a.Node }
+
+func (a *CordonNode) Inject(ctx context.Context) error {
+	return a.setUnschedulable(ctx, true)
+}
+
+func (a *CordonNode) Revert(ctx context.Context) error {
+	if !a.cordoned {
+		return nil
+	}
+	return a.setUnschedulable(ctx, false)
+}
+
+func (a *CordonNode) setUnschedulable(ctx context.Context, unschedulable bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := a.Client.CoreV1().Nodes().Get(ctx, a.Node, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if node.Spec.Unschedulable == unschedulable {
+			return nil
+		}
+		node.Spec.Unschedulable = unschedulable
+		if _, err := a.Client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		a.cordoned = unschedulable
+		return nil
+	})
+}
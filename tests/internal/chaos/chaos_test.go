@@ -0,0 +1,379 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/observability"
+)
+
+func readyPod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "demo", Labels: map[string]string{"app": "demo-app"}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func deployment(replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-app", Namespace: "demo", Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: replicas, ReadyReplicas: replicas},
+	}
+}
+
+func node(name string, ready corev1.ConditionStatus) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready, Message: "kubelet"}}},
+	}
+}
+
+// fast keeps the experiments of the tests in the millisecond range
+func fast(e Experiment) *Experiment {
+	e.Interval = 5 * time.Millisecond
+	if e.RecoveryTimeout == 0 {
+		e.RecoveryTimeout = 500 * time.Millisecond
+	}
+	e.ProbeTimeout = time.Second
+	return &e
+}
+
+func TestDeletePodsExperiment(t *testing.T) {
+	client := fake.NewClientset(readyPod("demo-app-a"), readyPod("demo-app-b"), readyPod("demo-app-c"))
+
+	// The controller replaces deleted pods; here the replacement is ready
+	// on the third verification attempt
+	var checks atomic.Int32
+	recreated := ProbeFunc("replacement ready", func(ctx context.Context) error {
+		if checks.Add(1) < 3 {
+			return errors.New("replacement pending")
+		}
+		return nil
+	})
+
+	action := &DeletePods{Client: client, Namespace: "demo", Selector: "app=demo-app", Count: 2}
+	report := fast(Experiment{
+		Name:        "demo-app-pod-delete",
+		SteadyState: []Probe{PodsReady(client, "demo", "app=demo-app", 3)},
+		Action:      action,
+		Verify:      []Probe{recreated},
+	}).Run(context.Background())
+
+	require.True(t, report.Passed(), report.String())
+	assert.Len(t, action.Deleted, 2)
+	pods, err := client.CoreV1().Pods("demo").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, pods.Items, 1)
+	for _, name := range action.Deleted {
+		assert.NotEqual(t, name, pods.Items[0].Name)
+	}
+	require.Len(t, report.Verification, 1)
+	assert.Equal(t, 3, report.Verification[0].Attempts)
+	assert.Equal(t, "3 pods app=demo-app in demo ready", report.SteadyState[0].Probe)
+}
+
+func TestScaleToZeroExperiment(t *testing.T) {
+	client := fake.NewClientset(deployment(3))
+	deployments := client.AppsV1().Deployments("demo")
+
+	var during []int32
+	replicas := ProbeFunc("replicas", func(ctx context.Context) error {
+		d, err := deployments.Get(ctx, "demo-app", metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		during = append(during, *d.Spec.Replicas)
+		return nil
+	})
+
+	report := fast(Experiment{
+		Name:        "scale-to-zero",
+		SteadyState: []Probe{DeploymentReady(client, "demo", "demo-app")},
+		Action:      &ScaleToZero{Client: client, Namespace: "demo", Deployment: "demo-app"},
+		During:      []Probe{replicas},
+		Duration:    20 * time.Millisecond,
+	}).Run(context.Background())
+
+	require.True(t, report.Passed(), report.String())
+	require.NotEmpty(t, during)
+	assert.Equal(t, int32(0), during[0], "scaled to zero while the fault is active")
+	assert.Greater(t, report.During[0].Attempts, 1, "during probes repeat every interval")
+
+	d, err := deployments.Get(context.Background(), "demo-app", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), *d.Spec.Replicas, "replicas restored")
+	assert.Equal(t, []ProbeResult{{Probe: "deployment demo/demo-app ready", Phase: PhaseVerification, Passed: true, Attempts: 1}},
+		withoutDurations(report.Verification), "verification defaults to the steady state")
+}
+
+func TestCordonNodeExperiment(t *testing.T) {
+	client := fake.NewClientset(node("worker-1", corev1.ConditionTrue))
+
+	cordoned := ProbeFunc("worker-1 cordoned", func(ctx context.Context) error {
+		n, err := client.CoreV1().Nodes().Get(ctx, "worker-1", metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !n.Spec.Unschedulable {
+			return errors.New("worker-1 is schedulable")
+		}
+		return nil
+	})
+
+	report := fast(Experiment{
+		Name:        "cordon",
+		SteadyState: []Probe{NodeCondition(client, "worker-1", corev1.NodeReady, corev1.ConditionTrue)},
+		Action:      &CordonNode{Client: client, Node: "worker-1"},
+		During:      []Probe{cordoned},
+	}).Run(context.Background())
+	require.True(t, report.Passed(), report.String())
+
+	n, err := client.CoreV1().Nodes().Get(context.Background(), "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.False(t, n.Spec.Unschedulable, "uncordoned")
+
+	// A node cordoned before the experiment stays cordoned
+	n.Spec.Unschedulable = true
+	_, err = client.CoreV1().Nodes().Update(context.Background(), n, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	action := &CordonNode{Client: client, Node: "worker-1"}
+	require.NoError(t, action.Inject(context.Background()))
+	require.NoError(t, action.Revert(context.Background()))
+	n, err = client.CoreV1().Nodes().Get(context.Background(), "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.True(t, n.Spec.Unschedulable)
+}
+
+func TestAbortedWhenSteadyStateFails(t *testing.T) {
+	client := fake.NewClientset(deployment(3))
+	unready := readyPod("demo-app-a")
+	unready.Status.Conditions[0].Status = corev1.ConditionFalse
+	require.NoError(t, client.Tracker().Add(unready))
+
+	action := &ScaleToZero{Client: client, Namespace: "demo", Deployment: "demo-app"}
+	report := fast(Experiment{
+		Name:        "scale-to-zero",
+		SteadyState: []Probe{PodsReady(client, "demo", "app=demo-app", 1)},
+		Action:      action,
+	}).Run(context.Background())
+
+	assert.Equal(t, VerdictAborted, report.Verdict)
+	assert.Contains(t, report.String(), "steady-state hypothesis does not hold")
+	assert.Equal(t, "0 of 1 pods matching \"app=demo-app\" in demo ready", report.SteadyState[0].Err)
+	assert.Empty(t, report.Verification)
+
+	d, err := client.AppsV1().Deployments("demo").Get(context.Background(), "demo-app", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), *d.Spec.Replicas, "the fault was not injected")
+}
+
+func TestFailedWhenNoRecovery(t *testing.T) {
+	client := fake.NewClientset(deployment(2))
+
+	// Nothing reconciles status in the fake clientset, so after the revert
+	// the Deployment looks like a new generation that never rolls out
+	client.PrependReactor("update", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		d := action.(clienttesting.UpdateAction).GetObject().(*appsv1.Deployment)
+		d.Generation++
+		return false, nil, nil
+	})
+
+	report := fast(Experiment{
+		Name:            "scale-to-zero",
+		SteadyState:     []Probe{DeploymentReady(client, "demo", "demo-app")},
+		Action:          &ScaleToZero{Client: client, Namespace: "demo", Deployment: "demo-app"},
+		RecoveryTimeout: 50 * time.Millisecond,
+	}).Run(context.Background())
+
+	assert.Equal(t, VerdictFailed, report.Verdict)
+	assert.Contains(t, report.String(), "did not recover within 50ms")
+	require.Len(t, report.Verification, 1)
+	assert.False(t, report.Verification[0].Passed)
+	assert.Greater(t, report.Verification[0].Attempts, 1)
+	assert.Contains(t, report.Verification[0].Err, "not observed yet")
+}
+
+func TestFailedDuringFault(t *testing.T) {
+	var calls atomic.Int32
+	flaky := ProbeFunc("flaky", func(context.Context) error {
+		if calls.Add(1) == 2 {
+			return errors.New("503")
+		}
+		return nil
+	})
+
+	report := fast(Experiment{
+		Name:     "flaky",
+		Action:   &DeletePods{Client: fake.NewClientset(readyPod("demo-app-a")), Namespace: "demo", Selector: "app=demo-app"},
+		During:   []Probe{flaky},
+		Duration: 30 * time.Millisecond,
+	}).Run(context.Background())
+
+	assert.Equal(t, VerdictFailed, report.Verdict)
+	assert.Contains(t, report.String(), "probe flaky failed during the fault")
+	require.Len(t, report.During, 1)
+	assert.Equal(t, "503", report.During[0].Err, "the first failure is kept")
+	assert.Equal(t, 2, report.During[0].Attempts)
+}
+
+func TestActionErrors(t *testing.T) {
+	t.Run("Inject", func(t *testing.T) {
+		report := fast(Experiment{
+			Name:   "no pods",
+			Action: &DeletePods{Client: fake.NewClientset(), Namespace: "demo", Selector: "app=demo-app"},
+		}).Run(context.Background())
+		assert.Equal(t, VerdictFailed, report.Verdict)
+		assert.Equal(t, `no pods matching "app=demo-app" in demo`, report.Action.Err)
+	})
+
+	t.Run("Revert", func(t *testing.T) {
+		client := fake.NewClientset(deployment(2))
+		var updates atomic.Int32
+		client.PrependReactor("update", "deployments", func(clienttesting.Action) (bool, runtime.Object, error) {
+			if updates.Add(1) > 1 {
+				return true, nil, errors.New("forbidden")
+			}
+			return false, nil, nil
+		})
+
+		report := fast(Experiment{
+			Name:   "scale",
+			Action: &ScaleToZero{Client: client, Namespace: "demo", Deployment: "demo-app"},
+		}).Run(context.Background())
+		assert.Equal(t, VerdictFailed, report.Verdict)
+		assert.Equal(t, "forbidden", report.Action.RevertErr)
+	})
+
+	t.Run("NoAction", func(t *testing.T) {
+		report := (&Experiment{Name: "empty"}).Run(context.Background())
+		assert.Equal(t, VerdictAborted, report.Verdict)
+	})
+}
+
+func TestRevertAfterCancel(t *testing.T) {
+	client := fake.NewClientset(deployment(3))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report := fast(Experiment{
+		Name:     "canceled",
+		Action:   &ScaleToZero{Client: client, Namespace: "demo", Deployment: "demo-app"},
+		Duration: time.Hour,
+	}).Run(ctx)
+	assert.Equal(t, VerdictFailed, report.Verdict)
+	assert.Contains(t, report.String(), "interrupted during the fault: context canceled")
+
+	d, err := client.AppsV1().Deployments("demo").Get(context.Background(), "demo-app", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), *d.Spec.Replicas, "reverted although ctx was canceled")
+}
+
+func TestHTTPProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, HTTPProbe{ProbeName: "health", URL: srv.URL + "/health"}.Check(ctx))
+	assert.NoError(t, HTTPProbe{ProbeName: "ready", URL: srv.URL + "/ready", Status: http.StatusServiceUnavailable}.Check(ctx))
+
+	err := HTTPProbe{ProbeName: "ready", URL: srv.URL + "/ready"}.Check(ctx)
+	assert.ErrorContains(t, err, "status 503, want 200")
+}
+
+func TestPrometheusProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result string
+		switch r.URL.Query().Get("query") {
+		case "error_ratio":
+			result = `[{"metric":{"route":"/api/v1/hello"},"value":[1700000000,"0.002"]},{"metric":{"route":"/"},"value":[1700000000,"0.05"]}]`
+		case "up":
+			result = `[{"metric":{"job":"demo-app"},"value":[1700000000,"1"]}]`
+		default:
+			result = `[]`
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":%s}}`, result)
+	}))
+	defer srv.Close()
+	prom := observability.NewPrometheus(srv.URL, nil)
+	ctx := context.Background()
+
+	assert.NoError(t, PrometheusProbe{Prometheus: prom, Query: "up", Comparator: "==", Value: 1}.Check(ctx))
+
+	err := PrometheusProbe{Prometheus: prom, Query: "error_ratio", Comparator: "<", Value: 0.01}.Check(ctx)
+	assert.EqualError(t, err, `query "error_ratio": {route="/"} = 0.05, want < 0.01`)
+
+	err = PrometheusProbe{Prometheus: prom, Query: "missing", Comparator: "<", Value: 1}.Check(ctx)
+	assert.EqualError(t, err, `query "missing" returned no samples`)
+
+	err = PrometheusProbe{Prometheus: prom, Query: "up", Comparator: "=~", Value: 1}.Check(ctx)
+	assert.EqualError(t, err, `unknown comparator "=~"`)
+}
+
+func TestNodeConditionProbe(t *testing.T) {
+	client := fake.NewClientset(node("worker-1", corev1.ConditionFalse))
+	ctx := context.Background()
+
+	assert.EqualError(t, NodeCondition(client, "worker-1", corev1.NodeReady, corev1.ConditionTrue).Check(ctx),
+		"node worker-1: Ready is False: kubelet")
+	assert.EqualError(t, NodeCondition(client, "worker-1", corev1.NodeMemoryPressure, corev1.ConditionFalse).Check(ctx),
+		"node worker-1 has no MemoryPressure condition")
+	assert.Error(t, NodeCondition(client, "worker-2", corev1.NodeReady, corev1.ConditionTrue).Check(ctx))
+}
+
+func TestReportOutput(t *testing.T) {
+	client := fake.NewClientset(deployment(1))
+	report := fast(Experiment{
+		Name:        "scale-to-zero",
+		SteadyState: []Probe{DeploymentReady(client, "demo", "demo-app")},
+		Action:      &ScaleToZero{Client: client, Namespace: "demo", Deployment: "demo-app"},
+	}).Run(context.Background())
+
+	var text strings.Builder
+	require.NoError(t, report.WriteText(&text))
+	assert.Contains(t, text.String(), "Experiment scale-to-zero: Pass")
+	assert.Contains(t, text.String(), "Steady state:\n  ✓ deployment demo/demo-app ready (1 attempt)\n")
+	assert.Contains(t, text.String(), "Action scale-to-zero deployment demo/demo-app: active for")
+	assert.Contains(t, text.String(), "Verification:\n  ✓ deployment demo/demo-app ready (1 attempt)\n")
+
+	var doc map[string]any
+	var js strings.Builder
+	require.NoError(t, report.WriteJSON(&js))
+	require.NoError(t, json.Unmarshal([]byte(js.String()), &doc))
+	assert.Equal(t, "Pass", doc["verdict"])
+	assert.Len(t, doc["steadyState"], 1)
+}
+
+func withoutDurations(results []ProbeResult) []ProbeResult {
+	out := append([]ProbeResult(nil), results...)
+	for i := range out {
+		out[i].Duration = 0
+	}
+	return out
+}
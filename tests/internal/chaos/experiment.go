@@ -0,0 +1,259 @@
+// Package chaos runs chaos experiments from Go in the shape Litmus and the
+// Chaos Toolkit use: a steady-state hypothesis is checked first, then a
+// fault is injected, and the hypothesis must hold again once the system has
+// had time to recover. Faults are Kubernetes actions through client-go
+// (delete pods, scale a Deployment to zero, cordon a node) and probes are
+// HTTP requests, Prometheus queries or Kubernetes conditions.
+//
+// Run returns a Report instead of failing a test, so the same experiment can
+// gate a CI job, back a Go test, or be reported on after a game day.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Defaults for the zero values of Experiment's timing fields
+const (
+	// DefaultInterval matches the 2s interval of the Litmus probes in
+	// tests/chaos/litmus_chaos_experiments.yaml
+	DefaultInterval = 2 * time.Second
+	// DefaultRecoveryTimeout bounds how long verification may take to pass
+	DefaultRecoveryTimeout = 2 * time.Minute
+	// DefaultProbeTimeout bounds a single probe check, as Litmus probeTimeout
+	DefaultProbeTimeout = 5 * time.Second
+)
+
+// Probe checks one property of the system. Check returns nil when it holds,
+// or an error saying why not.
+type Probe interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// Action injects a fault. Revert undoes what Inject changed, such as a
+// scaled Deployment's replicas; faults the cluster heals by itself, such as
+// deleted pods, revert to nothing.
+type Action interface {
+	Name() string
+	Inject(ctx context.Context) error
+	Revert(ctx context.Context) error
+}
+
+// Experiment is a steady-state hypothesis, a fault and its verification
+type Experiment struct {
+	Name string
+	// SteadyState must hold before the fault is injected; if any probe
+	// fails the experiment is aborted without injecting it
+	SteadyState []Probe
+	Action      Action
+	// During are checked every Interval while the fault is active, like
+	// Litmus Continuous probes; a failure fails the experiment
+	During []Probe
+	// Duration is how long the fault stays active before it is reverted
+	// and verification starts
+	Duration time.Duration
+	// Verify must hold again within RecoveryTimeout of the fault ending;
+	// SteadyState when empty
+	Verify []Probe
+
+	// Interval between probe attempts, DefaultInterval if 0
+	Interval time.Duration
+	// RecoveryTimeout is DefaultRecoveryTimeout if 0
+	RecoveryTimeout time.Duration
+	// ProbeTimeout bounds each probe check, DefaultProbeTimeout if 0
+	ProbeTimeout time.Duration
+
+	// Logf, when set, receives one line per phase, e.g. t.Logf
+	Logf func(format string, args ...any)
+}
+
+// Run runs the experiment and reports what happened. The fault is reverted
+// whatever the outcome, with a context of its own so that a canceled ctx
+// does not leave a Deployment at zero replicas or a node cordoned.
+func (e *Experiment) Run(ctx context.Context) *Report {
+	r := &Report{Experiment: e.Name, Started: time.Now()}
+	defer func() { r.Duration = time.Since(r.Started) }()
+
+	if e.Action == nil {
+		r.abort(errors.New("experiment has no action"))
+		return r
+	}
+	r.Action = ActionResult{Name: e.Action.Name()}
+
+	// Steady-state hypothesis
+	e.logf("%s: checking steady state", e.Name)
+	r.SteadyState = e.checkAll(ctx, PhaseSteadyState, e.SteadyState)
+	if !allPassed(r.SteadyState) {
+		r.abort(errors.New("steady-state hypothesis does not hold before the fault"))
+		return r
+	}
+
+	// Fault
+	e.logf("%s: injecting %s", e.Name, e.Action.Name())
+	injected := time.Now()
+	if err := e.Action.Inject(ctx); err != nil {
+		r.Action.Err = err.Error()
+		r.fail(fmt.Errorf("injecting %s: %w", e.Action.Name(), err))
+		e.revert(r)
+		return r
+	}
+	r.During = e.watch(ctx, injected)
+	r.Action.Duration = time.Since(injected)
+	e.revert(r)
+	if r.Action.RevertErr != "" {
+		r.fail(fmt.Errorf("reverting %s: %s", e.Action.Name(), r.Action.RevertErr))
+	}
+	for _, res := range r.During {
+		if !res.Passed {
+			r.fail(fmt.Errorf("probe %s failed during the fault", res.Probe))
+			break
+		}
+	}
+	if err := context.Cause(ctx); err != nil {
+		r.fail(fmt.Errorf("interrupted during the fault: %w", err))
+		return r
+	}
+
+	// Verification
+	verify := e.Verify
+	if len(verify) == 0 {
+		verify = e.SteadyState
+	}
+	e.logf("%s: verifying recovery", e.Name)
+	r.Verification = e.recover(ctx, verify)
+	if !allPassed(r.Verification) {
+		r.fail(fmt.Errorf("system did not recover within %s", e.recoveryTimeout()))
+	}
+
+	if r.Verdict == "" {
+		r.Verdict = VerdictPassed
+	}
+	e.logf("%s: %s", e.Name, r.Verdict)
+	return r
+}
+
+// watch runs the During probes every interval until Duration has passed
+// since the fault was injected, keeping the first failure of each probe,
+// or its last pass
+func (e *Experiment) watch(ctx context.Context, injected time.Time) []ProbeResult {
+	results := make([]ProbeResult, len(e.During))
+	for {
+		for i, p := range e.During {
+			if results[i].Attempts > 0 && !results[i].Passed {
+				continue
+			}
+			attempts := results[i].Attempts
+			results[i] = e.check(ctx, PhaseDuring, p)
+			results[i].Attempts = attempts + 1
+		}
+
+		remaining := e.Duration - time.Since(injected)
+		if remaining <= 0 || !sleep(ctx, min(remaining, e.interval())) {
+			return results
+		}
+	}
+}
+
+// recover retries probes that fail until all pass or the recovery timeout
+// ends. Each result records the attempts its probe needed.
+func (e *Experiment) recover(ctx context.Context, probes []Probe) []ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, e.recoveryTimeout())
+	defer cancel()
+
+	results := make([]ProbeResult, len(probes))
+	for {
+		pending := false
+		for i, p := range probes {
+			if results[i].Passed {
+				continue
+			}
+			attempts := results[i].Attempts
+			results[i] = e.check(ctx, PhaseVerification, p)
+			results[i].Attempts = attempts + 1
+			pending = pending || !results[i].Passed
+		}
+		if !pending || !sleep(ctx, e.interval()) {
+			return results
+		}
+	}
+}
+
+func (e *Experiment) checkAll(ctx context.Context, phase Phase, probes []Probe) []ProbeResult {
+	results := make([]ProbeResult, len(probes))
+	for i, p := range probes {
+		results[i] = e.check(ctx, phase, p)
+		results[i].Attempts = 1
+	}
+	return results
+}
+
+func (e *Experiment) check(ctx context.Context, phase Phase, p Probe) ProbeResult {
+	timeout := e.ProbeTimeout
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.Check(ctx)
+	res := ProbeResult{Probe: p.Name(), Phase: phase, Passed: err == nil, Duration: time.Since(start)}
+	if err != nil {
+		res.Err = err.Error()
+		e.logf("%s: %s probe %s: %v", e.Name, phase, p.Name(), err)
+	}
+	return res
+}
+
+func (e *Experiment) revert(r *Report) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := e.Action.Revert(ctx); err != nil {
+		r.Action.RevertErr = err.Error()
+	}
+}
+
+func (e *Experiment) interval() time.Duration {
+	if e.Interval > 0 {
+		return e.Interval
+	}
+	return DefaultInterval
+}
+
+func (e *Experiment) recoveryTimeout() time.Duration {
+	if e.RecoveryTimeout > 0 {
+		return e.RecoveryTimeout
+	}
+	return DefaultRecoveryTimeout
+}
+
+func (e *Experiment) logf(format string, args ...any) {
+	if e.Logf != nil {
+		e.Logf(format, args...)
+	}
+}
+
+// sleep waits for d and reports false if ctx ended first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func allPassed(results []ProbeResult) bool {
+	for _, res := range results {
+		if !res.Passed {
+			return false
+		}
+	}
+	return true
+}
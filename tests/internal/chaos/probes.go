@@ -0,0 +1,196 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/harness"
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/observability"
+)
+
+// ProbeFunc adapts a function to a Probe
+func ProbeFunc(name string, check func(ctx context.Context) error) Probe {
+	return probeFunc{name, check}
+}
+
+type probeFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (p probeFunc) Name() string                    { return p.name }
+func (p probeFunc) Check(ctx context.Context) error { return p.check(ctx) }
+
+// HTTPProbe passes when a request to URL returns Status, like a Litmus
+// httpProbe with criteria ==
+type HTTPProbe struct {
+	ProbeName string
+	URL       string
+	// Method is GET if empty
+	Method string
+	// Status is 200 if 0
+	Status int
+	// Client is http.DefaultClient if nil, e.g. the client of
+	// harness.ServiceProxy
+	Client *http.Client
+}
+
+func (p HTTPProbe) Name() string { return p.ProbeName }
+
+func (p HTTPProbe) Check(ctx context.Context) error {
+	method, want, client := p.Method, p.Status, p.Client
+	if method == "" {
+		method = http.MethodGet
+	}
+	if want == 0 {
+		want = http.StatusOK
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != want {
+		return fmt.Errorf("%s %s: status %d, want %d", method, p.URL, resp.StatusCode, want)
+	}
+	return nil
+}
+
+// PrometheusProbe passes when every sample of Query compares to Value with
+// Comparator: one of <, <=, >, >=, == and !=. A query without samples
+// fails, so that a typo in a label cannot pass.
+type PrometheusProbe struct {
+	ProbeName  string
+	Prometheus *observability.Prometheus
+	Query      string
+	Comparator string
+	Value      float64
+}
+
+func (p PrometheusProbe) Name() string { return p.ProbeName }
+
+func (p PrometheusProbe) Check(ctx context.Context) error {
+	samples, err := p.Prometheus.Query(ctx, p.Query, time.Time{})
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("query %q returned no samples", p.Query)
+	}
+
+	for _, s := range samples {
+		ok, err := compare(s.Value, p.Comparator, p.Value)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("query %q: %s = %g, want %s %g", p.Query, formatLabels(s.Metric), s.Value, p.Comparator, p.Value)
+		}
+	}
+	return nil
+}
+
+func compare(a float64, op string, b float64) (bool, error) {
+	switch op {
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	case "==":
+		return a == b, nil
+	case "!=":
+		return a != b, nil
+	default:
+		return false, fmt.Errorf("unknown comparator %q", op)
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// DeploymentReady passes when the Deployment has fully rolled out, as
+// harness.DeploymentReady decides
+func DeploymentReady(client kubernetes.Interface, namespace, name string) Probe {
+	return ProbeFunc("deployment "+namespace+"/"+name+" ready", func(ctx context.Context) error {
+		d, err := client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		return harness.DeploymentReady(d)
+	})
+}
+
+// PodsReady passes when at least min pods matching selector are Running
+// and Ready, like the Litmus k8sProbe on app=demo-app pods
+func PodsReady(client kubernetes.Interface, namespace, selector string, min int) Probe {
+	name := fmt.Sprintf("%d pods %s in %s ready", min, selector, namespace)
+	return ProbeFunc(name, func(ctx context.Context) error {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return err
+		}
+		ready := 0
+		for i := range pods.Items {
+			if harness.PodReady(&pods.Items[i]) {
+				ready++
+			}
+		}
+		if ready < min {
+			return fmt.Errorf("%d of %d pods matching %q in %s ready", ready, min, selector, namespace)
+		}
+		return nil
+	})
+}
+
+// NodeCondition passes when the node's condition of type has status, such
+// as Ready True or MemoryPressure False
+func NodeCondition(client kubernetes.Interface, node string, condition corev1.NodeConditionType, status corev1.ConditionStatus) Probe {
+	name := fmt.Sprintf("node %s %s=%s", node, condition, status)
+	return ProbeFunc(name, func(ctx context.Context) error {
+		n, err := client.CoreV1().Nodes().Get(ctx, node, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for _, c := range n.Status.Conditions {
+			if c.Type == condition {
+				if c.Status != status {
+					return fmt.Errorf("node %s: %s is %s: %s", node, condition, c.Status, c.Message)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("node %s has no %s condition", node, condition)
+	})
+}
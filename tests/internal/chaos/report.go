@@ -0,0 +1,143 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Phase is the part of an experiment a probe ran in
+type Phase string
+
+const (
+	PhaseSteadyState  Phase = "steady-state"
+	PhaseDuring       Phase = "during"
+	PhaseVerification Phase = "verification"
+)
+
+// Verdict is the outcome of an experiment
+type Verdict string
+
+const (
+	// VerdictPassed means the hypothesis held before and after the fault
+	VerdictPassed Verdict = "Pass"
+	// VerdictFailed means the system did not tolerate or recover from the fault
+	VerdictFailed Verdict = "Fail"
+	// VerdictAborted means the fault was not injected, because the steady
+	// state did not hold to begin with
+	VerdictAborted Verdict = "Aborted"
+)
+
+// ProbeResult is the last check of one probe in one phase
+type ProbeResult struct {
+	Probe  string `json:"probe"`
+	Phase  Phase  `json:"phase"`
+	Passed bool   `json:"passed"`
+	Err    string `json:"error,omitempty"`
+	// Attempts is how many times the probe ran in the phase
+	Attempts int           `json:"attempts"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ActionResult is what happened to the fault
+type ActionResult struct {
+	Name string `json:"name"`
+	Err  string `json:"error,omitempty"`
+	// Duration is how long the fault was active
+	Duration  time.Duration `json:"duration"`
+	RevertErr string        `json:"revertError,omitempty"`
+}
+
+// Report is the outcome of one experiment
+type Report struct {
+	Experiment   string        `json:"experiment"`
+	Verdict      Verdict       `json:"verdict"`
+	Reasons      []string      `json:"reasons,omitempty"`
+	Started      time.Time     `json:"started"`
+	Duration     time.Duration `json:"duration"`
+	SteadyState  []ProbeResult `json:"steadyState"`
+	Action       ActionResult  `json:"action"`
+	During       []ProbeResult `json:"during,omitempty"`
+	Verification []ProbeResult `json:"verification,omitempty"`
+}
+
+// Passed reports whether the experiment passed
+func (r *Report) Passed() bool {
+	return r.Verdict == VerdictPassed
+}
+
+func (r *Report) abort(reason error) {
+	r.Verdict = VerdictAborted
+	r.Reasons = append(r.Reasons, reason.Error())
+}
+
+func (r *Report) fail(reason error) {
+	r.Verdict = VerdictFailed
+	r.Reasons = append(r.Reasons, reason.Error())
+}
+
+// String summarizes the report on one line, for a test failure message
+func (r *Report) String() string {
+	s := fmt.Sprintf("experiment %s: %s", r.Experiment, r.Verdict)
+	if len(r.Reasons) > 0 {
+		s += ": " + strings.Join(r.Reasons, "; ")
+	}
+	return s
+}
+
+// WriteText writes the report with one line per probe result
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Experiment %s: %s in %s\n", r.Experiment, r.Verdict, r.Duration.Round(time.Millisecond))
+	for _, reason := range r.Reasons {
+		fmt.Fprintf(&b, "  reason: %s\n", reason)
+	}
+
+	writeProbes(&b, "Steady state", r.SteadyState)
+	if r.Action.Name != "" && r.Verdict != VerdictAborted {
+		fmt.Fprintf(&b, "Action %s: active for %s", r.Action.Name, r.Action.Duration.Round(time.Millisecond))
+		if r.Action.Err != "" {
+			fmt.Fprintf(&b, ", failed: %s", r.Action.Err)
+		}
+		if r.Action.RevertErr != "" {
+			fmt.Fprintf(&b, ", revert failed: %s", r.Action.RevertErr)
+		}
+		b.WriteString("\n")
+	}
+	writeProbes(&b, "During the fault", r.During)
+	writeProbes(&b, "Verification", r.Verification)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeProbes(b *strings.Builder, title string, results []ProbeResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", title)
+	for _, res := range results {
+		mark := "✓"
+		if !res.Passed {
+			mark = "✗"
+		}
+		attempts := "attempts"
+		if res.Attempts == 1 {
+			attempts = "attempt"
+		}
+		fmt.Fprintf(b, "  %s %s (%d %s)", mark, res.Probe, res.Attempts, attempts)
+		if res.Err != "" {
+			fmt.Fprintf(b, ": %s", res.Err)
+		}
+		b.WriteString("\n")
+	}
+}
+
+// WriteJSON writes the report as indented JSON, durations in nanoseconds
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
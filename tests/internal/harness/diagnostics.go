@@ -0,0 +1,193 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Limits that keep a diagnostics dump readable in CI logs
+const (
+	diagnosticsTimeout = 30 * time.Second
+	maxEvents          = 50
+	logTailLines       = int64(50)
+)
+
+// dumpOnFailure writes diagnostics for the registered namespaces to the
+// test log, and to $TEST_ARTIFACTS_DIR/<test>/<namespace>.txt when set
+func (h *Harness) dumpOnFailure() {
+	if !h.t.Failed() || len(h.namespaces) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	for _, ns := range uniq(h.namespaces) {
+		var buf bytes.Buffer
+		h.DumpDiagnostics(ctx, &buf, ns)
+		h.t.Logf("Diagnostics for namespace %s:\n%s", ns, buf.String())
+
+		if dir := os.Getenv("TEST_ARTIFACTS_DIR"); dir != "" {
+			path := filepath.Join(dir, strings.ReplaceAll(h.t.Name(), "/", "_"), ns+".txt")
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+				_ = os.WriteFile(path, buf.Bytes(), 0o644)
+			}
+		}
+	}
+}
+
+// DumpDiagnostics writes the recent events, a describe-style summary of
+// every deployment and pod, and the log tail of every container in
+// namespace to w. Errors are written inline so a partial dump still helps.
+func (h *Harness) DumpDiagnostics(ctx context.Context, w io.Writer, namespace string) {
+	h.dumpEvents(ctx, w, namespace)
+	h.dumpDeployments(ctx, w, namespace)
+	h.dumpPods(ctx, w, namespace)
+}
+
+func (h *Harness) dumpEvents(ctx context.Context, w io.Writer, namespace string) {
+	fmt.Fprintf(w, "=== Events (%s)\n", namespace)
+	events, err := h.Clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintf(w, "error listing events: %v\n", err)
+		return
+	}
+
+	items := events.Items
+	sort.Slice(items, func(i, j int) bool { return eventTime(items[i]).Before(eventTime(items[j])) })
+	if len(items) > maxEvents {
+		items = items[len(items)-maxEvents:]
+	}
+	for _, ev := range items {
+		fmt.Fprintf(w, "%s  %-7s  %-20s  %s/%s  %s\n",
+			eventTime(ev).Format(time.RFC3339), ev.Type, ev.Reason,
+			ev.InvolvedObject.Kind, ev.InvolvedObject.Name, strings.TrimSpace(ev.Message))
+	}
+}
+
+func eventTime(ev corev1.Event) time.Time {
+	switch {
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	default:
+		return ev.CreationTimestamp.Time
+	}
+}
+
+func (h *Harness) dumpDeployments(ctx context.Context, w io.Writer, namespace string) {
+	fmt.Fprintf(w, "=== Deployments (%s)\n", namespace)
+	deployments, err := h.Clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintf(w, "error listing deployments: %v\n", err)
+		return
+	}
+
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		status := "ready"
+		if err := DeploymentReady(d); err != nil {
+			status = err.Error()
+		}
+		fmt.Fprintf(w, "Deployment %s: %s\n", d.Name, status)
+		for _, cond := range d.Status.Conditions {
+			fmt.Fprintf(w, "  %s=%s  %s  %s\n", cond.Type, cond.Status, cond.Reason, cond.Message)
+		}
+	}
+}
+
+func (h *Harness) dumpPods(ctx context.Context, w io.Writer, namespace string) {
+	fmt.Fprintf(w, "=== Pods (%s)\n", namespace)
+	pods, err := h.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintf(w, "error listing pods: %v\n", err)
+		return
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		describePod(w, pod)
+		for _, c := range pod.Spec.InitContainers {
+			h.dumpLogs(ctx, w, pod, c.Name)
+		}
+		for _, c := range pod.Spec.Containers {
+			h.dumpLogs(ctx, w, pod, c.Name)
+		}
+	}
+}
+
+// describePod is a compact kubectl describe: phase, node, conditions and
+// the state of each container
+func describePod(w io.Writer, pod *corev1.Pod) {
+	fmt.Fprintf(w, "Pod %s: phase=%s node=%s ready=%t\n", pod.Name, pod.Status.Phase, pod.Spec.NodeName, PodReady(pod))
+	if pod.Status.Reason != "" || pod.Status.Message != "" {
+		fmt.Fprintf(w, "  %s: %s\n", pod.Status.Reason, pod.Status.Message)
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			fmt.Fprintf(w, "  %s=%s  %s  %s\n", cond.Type, cond.Status, cond.Reason, cond.Message)
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		fmt.Fprintf(w, "  container %s: ready=%t restarts=%d %s\n", cs.Name, cs.Ready, cs.RestartCount, containerState(cs.State))
+		if cs.LastTerminationState.Terminated != nil {
+			fmt.Fprintf(w, "    last %s\n", containerState(cs.LastTerminationState))
+		}
+	}
+}
+
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "running since " + state.Running.StartedAt.Format(time.RFC3339)
+	case state.Waiting != nil:
+		return fmt.Sprintf("waiting: %s %s", state.Waiting.Reason, state.Waiting.Message)
+	case state.Terminated != nil:
+		return fmt.Sprintf("terminated: %s exit=%d %s", state.Terminated.Reason, state.Terminated.ExitCode, state.Terminated.Message)
+	default:
+		return "unknown"
+	}
+}
+
+func (h *Harness) dumpLogs(ctx context.Context, w io.Writer, pod *corev1.Pod, container string) {
+	tail := logTailLines
+	fmt.Fprintf(w, "--- logs %s/%s (last %d lines)\n", pod.Name, container, tail)
+
+	stream, err := h.Clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &tail,
+	}).Stream(ctx)
+	if err != nil {
+		fmt.Fprintf(w, "error fetching logs: %v\n", err)
+		return
+	}
+	defer stream.Close()
+
+	io.Copy(w, stream)
+	fmt.Fprintln(w)
+}
+
+func uniq(items []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			out = append(out, item)
+		}
+	}
+	return out
+}
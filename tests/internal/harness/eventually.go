@@ -0,0 +1,112 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Condition inspects the objects an informer currently holds. It returns
+// nil once satisfied, or an error describing why not yet, which becomes
+// the failure message if the wait times out.
+type Condition[T runtime.Object] func(objs []T) error
+
+// Eventually runs an informer over lw and evaluates cond against its cache
+// after the initial list and after every change, until cond is satisfied or
+// ctx ends. Nothing is polled: the informer's watch drives re-evaluation.
+func Eventually[T runtime.Object](ctx context.Context, lw cache.ListerWatcher, cond Condition[T]) error {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	store, controller := cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: lw,
+		ObjectType:    newObject[T](),
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(interface{}) { notify() },
+			UpdateFunc: func(interface{}, interface{}) { notify() },
+			DeleteFunc: func(interface{}) { notify() },
+		},
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go controller.RunWithContext(ctx)
+
+	// HasSynced only reads local state; cache.WaitForCacheSync would check
+	// it every 100ms, which dominates short waits
+	err := wait.PollUntilContextCancel(ctx, 5*time.Millisecond, true, func(context.Context) (bool, error) {
+		return controller.HasSynced(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("informer did not sync: %w", context.Cause(ctx))
+	}
+
+	for {
+		items := store.List()
+		objs := make([]T, 0, len(items))
+		for _, item := range items {
+			objs = append(objs, item.(T))
+		}
+
+		err := cond(objs)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", context.Cause(ctx), err)
+		}
+	}
+}
+
+// newObject returns an empty *Kind for the pointer type T, which the
+// informer uses to check the type of listed and watched objects
+func newObject[T runtime.Object]() T {
+	var zero T
+	return reflect.New(reflect.TypeOf(zero).Elem()).Interface().(T)
+}
+
+// ListWatchFor adapts a typed client's List and Watch to a ListerWatcher,
+// applying tweak to the options of both, e.g. to add a selector:
+//
+//	harness.ListWatchFor(
+//		func(ctx context.Context, o metav1.ListOptions) (*corev1.PodList, error) {
+//			return cs.CoreV1().Pods(ns).List(ctx, o)
+//		},
+//		cs.CoreV1().Pods(ns).Watch,
+//		func(o *metav1.ListOptions) { o.LabelSelector = "app=demo-app" },
+//	)
+func ListWatchFor[L runtime.Object](
+	list func(context.Context, metav1.ListOptions) (L, error),
+	watchFn func(context.Context, metav1.ListOptions) (watch.Interface, error),
+	tweak func(*metav1.ListOptions),
+) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			if tweak != nil {
+				tweak(&options)
+			}
+			return list(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			if tweak != nil {
+				tweak(&options)
+			}
+			return watchFn(ctx, options)
+		},
+	}
+}
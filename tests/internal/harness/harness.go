@@ -0,0 +1,111 @@
+// Package harness is the shared setup for tests that run against a live
+// cluster: kubeconfig and context selection, the -short skip policy,
+// informer-based waits and a diagnostics dump attached to failing tests.
+package harness
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster selection. Flags are passed after -args, e.g.
+//
+//	go test ./... -args -kubeconfig ~/.kube/lab -kube-context k3d-lab
+//
+// and fall back to KUBE_CONTEXT and the standard KUBECONFIG loading rules.
+var (
+	kubeconfigFlag = flag.String("kubeconfig", "", "path to the kubeconfig file (default $KUBECONFIG or ~/.kube/config)")
+	contextFlag    = flag.String("kube-context", "", "kubeconfig context to use (default $KUBE_CONTEXT or the current context)")
+)
+
+// Harness bundles the clients for one test and the namespaces whose
+// diagnostics are dumped if it fails
+type Harness struct {
+	t          testing.TB
+	Config     *rest.Config
+	Clientset  kubernetes.Interface
+	Dynamic    dynamic.Interface
+	namespaces []string
+}
+
+var (
+	configOnce sync.Once
+	config     *rest.Config
+	configErr  error
+)
+
+// SkipIfShort skips t when go test runs with -short. Every test that needs
+// a live cluster goes through it, so -short runs only offline tests.
+func SkipIfShort(t testing.TB) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping test against a live cluster in short mode")
+	}
+}
+
+// New skips t in short mode, then connects to the configured cluster
+func New(t testing.TB) *Harness {
+	t.Helper()
+	SkipIfShort(t)
+
+	cfg, err := RESTConfig()
+	if err != nil {
+		t.Fatalf("Failed to load kubeconfig: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create Kubernetes client: %v", err)
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create dynamic client: %v", err)
+	}
+
+	h := NewForClients(t, clientset, dyn)
+	h.Config = cfg
+	return h
+}
+
+// NewForClients builds a Harness around existing clients, such as the
+// fakes from k8s.io/client-go/kubernetes/fake and dynamic/fake
+func NewForClients(t testing.TB, clientset kubernetes.Interface, dyn dynamic.Interface) *Harness {
+	h := &Harness{t: t, Clientset: clientset, Dynamic: dyn}
+	t.Cleanup(h.dumpOnFailure)
+	return h
+}
+
+// RESTConfig loads the cluster configuration once per test binary
+func RESTConfig() (*rest.Config, error) {
+	configOnce.Do(func() {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		if *kubeconfigFlag != "" {
+			rules.ExplicitPath = *kubeconfigFlag
+		}
+
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: *contextFlag}
+		if overrides.CurrentContext == "" {
+			overrides.CurrentContext = os.Getenv("KUBE_CONTEXT")
+		}
+
+		config, configErr = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+		if configErr != nil {
+			configErr = fmt.Errorf("context %q: %w", overrides.CurrentContext, configErr)
+		}
+	})
+	return config, configErr
+}
+
+// Diagnose registers namespaces whose events, pods, logs and deployments
+// are dumped when the test fails
+func (h *Harness) Diagnose(namespaces ...string) {
+	h.namespaces = append(h.namespaces, namespaces...)
+}
@@ -0,0 +1,256 @@
+package harness
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func newFakeHarness(t testing.TB, objects ...runtime.Object) (*Harness, *fake.Clientset) {
+	clientset := fake.NewSimpleClientset(objects...)
+	return NewForClients(t, clientset, nil), clientset
+}
+
+func newDeployment(replicas, ready int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-app", Namespace: "demo", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			UpdatedReplicas:    replicas,
+			ReadyReplicas:      ready,
+		},
+	}
+}
+
+func newPod(name string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "demo", Labels: map[string]string{"app": "demo-app"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "demo-app"}}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestWaitForNamespace(t *testing.T) {
+	h, clientset := newFakeHarness(t)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, err := clientset.CoreV1().Namespaces().Create(context.Background(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+			Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+		}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, h.WaitForNamespace(ctx, "demo"))
+}
+
+func TestWaitForDeploymentReady(t *testing.T) {
+	h, clientset := newFakeHarness(t, newDeployment(2, 1))
+
+	t.Run("TimeoutReportsReason", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := h.WaitForDeploymentReady(ctx, "demo", "demo-app")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "1 of 2 replicas ready")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("BecomesReady", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_, err := clientset.AppsV1().Deployments("demo").UpdateStatus(context.Background(), newDeployment(2, 2), metav1.UpdateOptions{})
+			assert.NoError(t, err)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.NoError(t, h.WaitForDeploymentReady(ctx, "demo", "demo-app"))
+	})
+}
+
+func TestDeploymentReady(t *testing.T) {
+	assert.NoError(t, DeploymentReady(newDeployment(3, 3)))
+
+	stale := newDeployment(3, 3)
+	stale.Generation = 3
+	assert.ErrorContains(t, DeploymentReady(stale), "generation 3 not observed")
+
+	rolling := newDeployment(3, 3)
+	rolling.Status.UpdatedReplicas = 1
+	assert.ErrorContains(t, DeploymentReady(rolling), "1 of 3 replicas updated")
+}
+
+func TestWaitForPodsReady(t *testing.T) {
+	h, clientset := newFakeHarness(t, newPod("demo-app-1", true), newPod("demo-app-2", false))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, err := clientset.CoreV1().Pods("demo").UpdateStatus(context.Background(), newPod("demo-app-2", true), metav1.UpdateOptions{})
+		assert.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pods, err := h.WaitForPodsReady(ctx, "demo", "app=demo-app", 2)
+	require.NoError(t, err)
+	assert.Len(t, pods, 2)
+}
+
+func TestDumpDiagnostics(t *testing.T) {
+	crashing := newPod("demo-app-1", false)
+	crashing.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:         "demo-app",
+		RestartCount: 4,
+		State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1},
+		},
+	}}
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "demo-app-1.1", Namespace: "demo"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "demo-app-1"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		LastTimestamp:  metav1.Now(),
+	}
+	h, _ := newFakeHarness(t, crashing, newDeployment(1, 0), event)
+
+	var buf bytes.Buffer
+	h.DumpDiagnostics(context.Background(), &buf, "demo")
+	out := buf.String()
+
+	assert.Contains(t, out, "Warning  BackOff")
+	assert.Contains(t, out, "Back-off restarting failed container")
+	assert.Contains(t, out, "Deployment demo-app: deployment demo/demo-app: 0 of 1 replicas ready")
+	assert.Contains(t, out, "Pod demo-app-1: phase=Running")
+	assert.Contains(t, out, "container demo-app: ready=false restarts=4 waiting: CrashLoopBackOff")
+	assert.Contains(t, out, "last terminated: Error exit=1")
+	assert.Contains(t, out, "--- logs demo-app-1/demo-app")
+	assert.Contains(t, out, "fake logs")
+}
+
+func TestTargetPort(t *testing.T) {
+	pod := newPod("demo-app-1", true)
+	pod.Spec.Containers[0].Ports = []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}
+
+	tests := []struct {
+		name       string
+		targetPort intstr.IntOrString
+		want       int
+		wantErr    string
+	}{
+		{"Named", intstr.FromString("http"), 8080, ""},
+		{"Numeric", intstr.FromInt32(9090), 9090, ""},
+		{"DefaultsToPort", intstr.IntOrString{}, 80, ""},
+		{"UnknownName", intstr.FromString("grpc"), 0, `no container port named "grpc"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "demo-app", Namespace: "demo"},
+				Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80, TargetPort: tt.targetPort}}},
+			}
+
+			got, err := TargetPort(svc, pod, 80)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			_, err = TargetPort(svc, pod, 443)
+			assert.ErrorContains(t, err, "has no port 443")
+		})
+	}
+}
+
+func TestServiceProxy(t *testing.T) {
+	apiserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer apiserver.Close()
+
+	h, _ := newFakeHarness(t)
+	h.Config = &rest.Config{Host: apiserver.URL + "/", BearerToken: "token"}
+
+	client, base, err := h.ServiceProxy("demo", "demo-app", 80)
+	require.NoError(t, err)
+
+	resp, err := client.Get(base + "/health")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "/api/v1/namespaces/demo/services/demo-app:80/proxy/health", string(body))
+}
+
+func TestPortForwardNeedsCluster(t *testing.T) {
+	h, _ := newFakeHarness(t)
+
+	_, err := h.PortForwardService(context.Background(), t, "demo", "demo-app", 80)
+	assert.ErrorIs(t, err, errNoCluster)
+}
+
+// recordingTB captures what a Harness logs from its cleanup
+type recordingTB struct {
+	testing.TB
+	failed   bool
+	cleanups []func()
+	logs     strings.Builder
+}
+
+func (r *recordingTB) Failed() bool                    { return r.failed }
+func (r *recordingTB) Name() string                    { return "TestRecording" }
+func (r *recordingTB) Cleanup(f func())                { r.cleanups = append(r.cleanups, f) }
+func (r *recordingTB) Logf(format string, args ...any) { r.logs.WriteString(format) }
+
+func TestDiagnosticsAttachedOnFailure(t *testing.T) {
+	for _, failed := range []bool{false, true} {
+		tb := &recordingTB{TB: t, failed: failed}
+		h, _ := newFakeHarness(tb, newPod("demo-app-1", true))
+		h.Diagnose("demo", "demo")
+
+		for _, f := range tb.cleanups {
+			f()
+		}
+
+		if failed {
+			assert.Equal(t, 1, strings.Count(tb.logs.String(), "Diagnostics for namespace"), "namespaces are dumped once")
+		} else {
+			assert.Empty(t, tb.logs.String(), "passing tests dump nothing")
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// errNoCluster is returned by helpers that need a real API server when the
+// Harness was built around fake clients
+var errNoCluster = errors.New("no rest config: harness was not created with New")
+
+// PortForwardService forwards a free local port to port of the service,
+// through one of its ready pods, and returns the base URL to reach it, e.g.
+// http://127.0.0.1:43125. The forward is closed when t ends, so a subtest
+// that needs one passes its own t rather than the Harness's.
+func (h *Harness) PortForwardService(ctx context.Context, t testing.TB, namespace, service string, port int) (string, error) {
+	if h.Config == nil {
+		return "", errNoCluster
+	}
+
+	svc, err := h.Clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", fmt.Errorf("service %s/%s has no selector to pick a pod from", namespace, service)
+	}
+
+	pods, err := h.WaitForPodsReady(ctx, namespace, labels.SelectorFromSet(svc.Spec.Selector).String(), 1)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := TargetPort(svc, &pods[0], port)
+	if err != nil {
+		return "", err
+	}
+	return h.PortForwardPod(ctx, t, namespace, pods[0].Name, target)
+}
+
+// PortForwardPod forwards a free local port to port of the pod over SPDY,
+// like kubectl port-forward, and returns the base URL once it is listening.
+// The forward is closed when t ends.
+func (h *Harness) PortForwardPod(ctx context.Context, t testing.TB, namespace, pod string, port int) (string, error) {
+	if h.Config == nil {
+		return "", errNoCluster
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(h.Config)
+	if err != nil {
+		return "", err
+	}
+	req := h.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(pod).SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	var errOut strings.Builder
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)}, stop, ready, io.Discard, &errOut)
+	if err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fw.ForwardPorts() }()
+
+	select {
+	case <-ready:
+	case err := <-done:
+		return "", fmt.Errorf("port-forward to pod %s/%s:%d: %w %s", namespace, pod, port, err, errOut.String())
+	case <-ctx.Done():
+		close(stop)
+		return "", fmt.Errorf("port-forward to pod %s/%s:%d: %w", namespace, pod, port, context.Cause(ctx))
+	}
+	t.Cleanup(func() { close(stop) })
+
+	ports, err := fw.GetPorts()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", ports[0].Local), nil
+}
+
+// ServiceProxy returns a client and base URL that reach port of the service
+// through the API server's service proxy, for clusters where the test runner
+// may not port-forward. Requests carry the kubeconfig credentials, so only
+// plain HTTP services work this way.
+func (h *Harness) ServiceProxy(namespace, service string, port int) (*http.Client, string, error) {
+	if h.Config == nil {
+		return nil, "", errNoCluster
+	}
+
+	client, err := rest.HTTPClientFor(h.Config)
+	if err != nil {
+		return nil, "", err
+	}
+	base := fmt.Sprintf("%s/api/v1/namespaces/%s/services/%s:%d/proxy",
+		strings.TrimSuffix(h.Config.Host, "/"), namespace, service, port)
+	return client, base, nil
+}
+
+// TargetPort resolves the container port of pod that service port forwards
+// to, following named target ports the way kube-proxy does
+func TargetPort(svc *corev1.Service, pod *corev1.Pod, port int) (int, error) {
+	for _, sp := range svc.Spec.Ports {
+		if int(sp.Port) != port {
+			continue
+		}
+
+		switch {
+		case sp.TargetPort.Type == intstr.String:
+			for _, c := range pod.Spec.Containers {
+				for _, cp := range c.Ports {
+					if cp.Name == sp.TargetPort.StrVal {
+						return int(cp.ContainerPort), nil
+					}
+				}
+			}
+			return 0, fmt.Errorf("pod %s has no container port named %q", pod.Name, sp.TargetPort.StrVal)
+		case sp.TargetPort.IntVal != 0:
+			return int(sp.TargetPort.IntVal), nil
+		default:
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("service %s/%s has no port %d", svc.Namespace, svc.Name, port)
+}
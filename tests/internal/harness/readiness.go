@@ -0,0 +1,108 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// WaitForNamespace waits until namespace exists and is Active
+func (h *Harness) WaitForNamespace(ctx context.Context, namespace string) error {
+	namespaces := h.Clientset.CoreV1().Namespaces()
+	lw := ListWatchFor(namespaces.List, namespaces.Watch, ByName(namespace))
+
+	return Eventually(ctx, lw, func(items []*corev1.Namespace) error {
+		for _, ns := range items {
+			if ns.Name != namespace {
+				continue
+			}
+			if ns.Status.Phase != corev1.NamespaceActive {
+				return fmt.Errorf("namespace %s is %s", namespace, ns.Status.Phase)
+			}
+			return nil
+		}
+		return fmt.Errorf("namespace %s not found", namespace)
+	})
+}
+
+// WaitForDeploymentReady waits until the deployment has rolled out its
+// current generation and every desired replica is updated and ready
+func (h *Harness) WaitForDeploymentReady(ctx context.Context, namespace, name string) error {
+	h.Diagnose(namespace)
+	deployments := h.Clientset.AppsV1().Deployments(namespace)
+	lw := ListWatchFor(deployments.List, deployments.Watch, ByName(name))
+
+	return Eventually(ctx, lw, func(items []*appsv1.Deployment) error {
+		for _, d := range items {
+			if d.Name == name {
+				return DeploymentReady(d)
+			}
+		}
+		return fmt.Errorf("deployment %s/%s not found", namespace, name)
+	})
+}
+
+// DeploymentReady returns nil when d has fully rolled out, or the reason
+// it has not
+func DeploymentReady(d *appsv1.Deployment) error {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+
+	switch {
+	case d.Status.ObservedGeneration < d.Generation:
+		return fmt.Errorf("deployment %s/%s: generation %d not observed yet", d.Namespace, d.Name, d.Generation)
+	case d.Status.UpdatedReplicas < desired:
+		return fmt.Errorf("deployment %s/%s: %d of %d replicas updated", d.Namespace, d.Name, d.Status.UpdatedReplicas, desired)
+	case d.Status.ReadyReplicas < desired:
+		return fmt.Errorf("deployment %s/%s: %d of %d replicas ready", d.Namespace, d.Name, d.Status.ReadyReplicas, desired)
+	}
+	return nil
+}
+
+// WaitForPodsReady waits until at least min pods matching selector are
+// Running with the Ready condition, and returns them
+func (h *Harness) WaitForPodsReady(ctx context.Context, namespace, selector string, min int) ([]corev1.Pod, error) {
+	h.Diagnose(namespace)
+	pods := h.Clientset.CoreV1().Pods(namespace)
+	lw := ListWatchFor(pods.List, pods.Watch, func(o *metav1.ListOptions) { o.LabelSelector = selector })
+
+	var ready []corev1.Pod
+	err := Eventually(ctx, lw, func(items []*corev1.Pod) error {
+		ready = ready[:0]
+		for _, pod := range items {
+			if PodReady(pod) {
+				ready = append(ready, *pod)
+			}
+		}
+		if len(ready) < min {
+			return fmt.Errorf("%d of %d pods matching %q in %s ready", len(ready), min, selector, namespace)
+		}
+		return nil
+	})
+	return ready, err
+}
+
+// PodReady reports whether pod is Running and passing its readiness probes
+func PodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// ByName is a ListWatchFor tweak that selects the one object called name
+func ByName(name string) func(*metav1.ListOptions) {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	return func(o *metav1.ListOptions) { o.FieldSelector = selector }
+}
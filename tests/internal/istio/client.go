@@ -0,0 +1,109 @@
+package istio
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/harness"
+)
+
+// Client reads Istio resources through a dynamic client, so no generated
+// Istio clientset is needed and a fake dynamic client can stand in for tests
+type Client struct {
+	dynamic dynamic.Interface
+}
+
+// NewClient wraps an existing dynamic client
+func NewClient(dyn dynamic.Interface) *Client {
+	return &Client{dynamic: dyn}
+}
+
+// NewForConfig creates a Client for the cluster described by config
+func NewForConfig(config *rest.Config) (*Client, error) {
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+	return NewClient(dyn), nil
+}
+
+// ListKinds maps each resource to its list kind, as required by
+// k8s.io/client-go/dynamic/fake.NewSimpleDynamicClientWithCustomListKinds
+var ListKinds = map[schema.GroupVersionResource]string{
+	PeerAuthenticationResource: "PeerAuthenticationList",
+	DestinationRuleResource:    "DestinationRuleList",
+	VirtualServiceResource:     "VirtualServiceList",
+	GatewayResource:            "GatewayList",
+}
+
+func (c *Client) GetPeerAuthentication(ctx context.Context, namespace, name string) (*PeerAuthentication, error) {
+	return get[PeerAuthentication](ctx, c, PeerAuthenticationResource, namespace, name)
+}
+
+// ListPeerAuthentications lists policies in namespace, or in all namespaces
+// when namespace is empty
+func (c *Client) ListPeerAuthentications(ctx context.Context, namespace string) ([]PeerAuthentication, error) {
+	return list[PeerAuthentication](ctx, c, PeerAuthenticationResource, namespace)
+}
+
+func (c *Client) GetDestinationRule(ctx context.Context, namespace, name string) (*DestinationRule, error) {
+	return get[DestinationRule](ctx, c, DestinationRuleResource, namespace, name)
+}
+
+// ListDestinationRules lists rules in namespace, or in all namespaces when
+// namespace is empty
+func (c *Client) ListDestinationRules(ctx context.Context, namespace string) ([]DestinationRule, error) {
+	return list[DestinationRule](ctx, c, DestinationRuleResource, namespace)
+}
+
+func (c *Client) GetVirtualService(ctx context.Context, namespace, name string) (*VirtualService, error) {
+	return get[VirtualService](ctx, c, VirtualServiceResource, namespace, name)
+}
+
+// ListVirtualServices lists routes in namespace, or in all namespaces when
+// namespace is empty
+func (c *Client) ListVirtualServices(ctx context.Context, namespace string) ([]VirtualService, error) {
+	return list[VirtualService](ctx, c, VirtualServiceResource, namespace)
+}
+
+func (c *Client) GetGateway(ctx context.Context, namespace, name string) (*Gateway, error) {
+	return get[Gateway](ctx, c, GatewayResource, namespace, name)
+}
+
+// ListGateways lists gateways in namespace, or in all namespaces when
+// namespace is empty
+func (c *Client) ListGateways(ctx context.Context, namespace string) ([]Gateway, error) {
+	return list[Gateway](ctx, c, GatewayResource, namespace)
+}
+
+// get fetches one object and decodes it into T. API errors are returned
+// unwrapped so callers can use apierrors.IsNotFound.
+func get[T any](ctx context.Context, c *Client, gvr schema.GroupVersionResource, namespace, name string) (*T, error) {
+	obj, err := c.dynamic.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return harness.Decode[T](obj)
+}
+
+func list[T any](ctx context.Context, c *Client, gvr schema.GroupVersionResource, namespace string) ([]T, error) {
+	objs, err := c.dynamic.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]T, 0, len(objs.Items))
+	for i := range objs.Items {
+		item, err := harness.Decode[T](&objs.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
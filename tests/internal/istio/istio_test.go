@@ -0,0 +1,237 @@
+package istio
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/yaml"
+)
+
+const peerAuthenticationYAML = `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: default
+  namespace: istio-system
+spec:
+  mtls:
+    mode: STRICT
+`
+
+const destinationRuleYAML = `
+apiVersion: networking.istio.io/v1beta1
+kind: DestinationRule
+metadata:
+  name: demo-app
+  namespace: demo
+spec:
+  host: demo-app.demo.svc.cluster.local
+  trafficPolicy:
+    tls:
+      mode: ISTIO_MUTUAL
+  subsets:
+    - name: stable
+      labels:
+        app: demo-app
+    - name: canary
+      labels:
+        app: demo-app
+      trafficPolicy:
+        tls:
+          mode: DISABLE
+`
+
+const virtualServiceYAML = `
+apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: demo-app
+  namespace: demo
+spec:
+  hosts:
+    - demo-app.lab.local
+  gateways:
+    - istio-system/istio-ingressgateway
+  http:
+    - name: primary
+      route:
+        - destination:
+            host: demo-app-stable
+          weight: 80
+        - destination:
+            host: demo-app-canary
+          weight: 20
+      corsPolicy:
+        allowOrigins:
+          - prefix: "https://"
+        allowMethods: [GET, POST]
+      retries:
+        attempts: 3
+        perTryTimeout: 2s
+        retryOn: 5xx,reset,connect-failure,refused-stream
+      timeout: 10s
+`
+
+const gatewayYAML = `
+apiVersion: networking.istio.io/v1beta1
+kind: Gateway
+metadata:
+  name: istio-ingressgateway
+  namespace: istio-system
+spec:
+  selector:
+    istio: ingressgateway
+  servers:
+    - port:
+        number: 80
+        name: http
+        protocol: HTTP
+      hosts:
+        - "*.lab.local"
+`
+
+// newFakeClient returns a Client backed by a fake dynamic client holding
+// manifests. Objects are created through the client rather than passed to
+// the constructor, whose kind-to-resource guess turns Gateway into
+// "gatewaies".
+func newFakeClient(t *testing.T, manifests ...string) *Client {
+	t.Helper()
+
+	resources := map[string]schema.GroupVersionResource{}
+	for gvr, listKind := range ListKinds {
+		resources[strings.TrimSuffix(listKind, "List")] = gvr
+	}
+
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), ListKinds)
+	for _, manifest := range manifests {
+		obj := &unstructured.Unstructured{}
+		require.NoError(t, yaml.Unmarshal([]byte(manifest), &obj.Object))
+
+		gvr, ok := resources[obj.GetKind()]
+		require.True(t, ok, "unsupported kind %s", obj.GetKind())
+		_, err := dyn.Resource(gvr).Namespace(obj.GetNamespace()).Create(context.Background(), obj, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	return NewClient(dyn)
+}
+
+func TestClientDecodesResources(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient(t, peerAuthenticationYAML, destinationRuleYAML, virtualServiceYAML, gatewayYAML)
+
+	t.Run("PeerAuthentication", func(t *testing.T) {
+		pa, err := client.GetPeerAuthentication(ctx, "istio-system", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "default", pa.Name)
+		assert.Equal(t, MTLSStrict, pa.Mode())
+		assert.True(t, pa.MeshWide())
+	})
+
+	t.Run("DestinationRule", func(t *testing.T) {
+		rules, err := client.ListDestinationRules(ctx, "")
+		require.NoError(t, err)
+		require.Len(t, rules, 1)
+		assert.Equal(t, "demo-app.demo.svc.cluster.local", rules[0].Spec.Host)
+		assert.Len(t, rules[0].Spec.Subsets, 2)
+	})
+
+	t.Run("VirtualService", func(t *testing.T) {
+		vs, err := client.GetVirtualService(ctx, "demo", "demo-app")
+		require.NoError(t, err)
+		require.Len(t, vs.Spec.HTTP, 1)
+
+		route := vs.Spec.HTTP[0]
+		assert.Equal(t, []string{"istio-system/istio-ingressgateway"}, vs.Spec.Gateways)
+		assert.Equal(t, map[string]int32{"demo-app-stable": 80, "demo-app-canary": 20}, Weights(route))
+		require.NotNil(t, route.Retries)
+		assert.Equal(t, int32(3), route.Retries.Attempts)
+		require.NotNil(t, route.CorsPolicy)
+		assert.Equal(t, "https://", route.CorsPolicy.AllowOrigins[0].Prefix)
+	})
+
+	t.Run("Gateway", func(t *testing.T) {
+		gateways, err := client.ListGateways(ctx, "istio-system")
+		require.NoError(t, err)
+		require.Len(t, gateways, 1)
+		assert.Equal(t, uint32(80), gateways[0].Spec.Servers[0].Port.Number)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := client.GetVirtualService(ctx, "demo", "missing")
+		assert.True(t, apierrors.IsNotFound(err), "got %v", err)
+	})
+}
+
+func TestVerifyStrictMTLS(t *testing.T) {
+	pa := &PeerAuthentication{Spec: PeerAuthenticationSpec{MTLS: &PeerMTLS{Mode: MTLSStrict}}}
+	assert.NoError(t, VerifyStrictMTLS(pa))
+
+	pa.Spec.PortLevelMTLS = map[string]PeerMTLS{"8080": {Mode: MTLSPermissive}}
+	assert.ErrorContains(t, VerifyStrictMTLS(pa), "port 8080")
+
+	pa = &PeerAuthentication{Spec: PeerAuthenticationSpec{MTLS: &PeerMTLS{Mode: MTLSPermissive}}}
+	assert.ErrorContains(t, VerifyStrictMTLS(pa), "PERMISSIVE")
+
+	assert.ErrorContains(t, VerifyStrictMTLS(&PeerAuthentication{}), MTLSUnset)
+}
+
+func TestVerifyIstioMutual(t *testing.T) {
+	client := newFakeClient(t, destinationRuleYAML)
+	dr, err := client.GetDestinationRule(context.Background(), "demo", "demo-app")
+	require.NoError(t, err)
+
+	assert.ErrorContains(t, VerifyIstioMutual(dr), "subset canary")
+
+	dr.Spec.Subsets[1].TrafficPolicy = nil
+	assert.NoError(t, VerifyIstioMutual(dr))
+
+	dr.Spec.TrafficPolicy = nil
+	assert.Error(t, VerifyIstioMutual(dr))
+}
+
+func TestVerifyVirtualService(t *testing.T) {
+	client := newFakeClient(t, virtualServiceYAML)
+	vs, err := client.GetVirtualService(context.Background(), "demo", "demo-app")
+	require.NoError(t, err)
+
+	assert.NoError(t, VerifyRetries(vs, 3, 2*time.Second))
+	assert.ErrorContains(t, VerifyRetries(vs, 5, 2*time.Second), "retries 3 times, want 5")
+	assert.ErrorContains(t, VerifyRetries(vs, 3, time.Second), "perTryTimeout is 2s, want 1s")
+	assert.NoError(t, VerifyCORS(vs))
+	assert.NoError(t, VerifyWeights(vs))
+
+	vs.Spec.HTTP[0].Route[1].Weight = 30
+	assert.ErrorContains(t, VerifyWeights(vs), "weights sum to 110")
+
+	vs.Spec.HTTP[0].Route = vs.Spec.HTTP[0].Route[:1]
+	vs.Spec.HTTP[0].Route[0].Weight = 0
+	assert.NoError(t, VerifyWeights(vs), "a single unweighted destination receives all traffic")
+
+	vs.Spec.HTTP[0].Retries = nil
+	vs.Spec.HTTP[0].CorsPolicy = nil
+	assert.ErrorContains(t, VerifyRetries(vs, 3, 2*time.Second), "no retry policy")
+	assert.ErrorContains(t, VerifyCORS(vs), "no CORS policy")
+
+	assert.Error(t, VerifyWeights(&VirtualService{}))
+}
+
+func TestVerifyGatewayServes(t *testing.T) {
+	client := newFakeClient(t, gatewayYAML)
+	gw, err := client.GetGateway(context.Background(), "istio-system", "istio-ingressgateway")
+	require.NoError(t, err)
+
+	assert.NoError(t, VerifyGatewayServes(gw, 80, "demo-app.lab.local"))
+	assert.Error(t, VerifyGatewayServes(gw, 443, "demo-app.lab.local"))
+	assert.Error(t, VerifyGatewayServes(gw, 80, "demo-app.example.com"))
+}
@@ -0,0 +1,175 @@
+// Package istio fetches Istio custom resources through the Kubernetes
+// dynamic client and decodes the fields the platform tests assert on.
+//
+// Only the subset of each API the lab relies on is modelled; unknown fields
+// are ignored when decoding.
+package istio
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Resources served by istiod's CRDs
+var (
+	PeerAuthenticationResource = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1beta1", Resource: "peerauthentications"}
+	DestinationRuleResource    = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "destinationrules"}
+	VirtualServiceResource     = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "virtualservices"}
+	GatewayResource            = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "gateways"}
+)
+
+// Mutual TLS modes of PeerAuthentication and DestinationRule
+const (
+	MTLSStrict     = "STRICT"
+	MTLSPermissive = "PERMISSIVE"
+	MTLSUnset      = "UNSET"
+	TLSIstioMutual = "ISTIO_MUTUAL"
+)
+
+// PeerAuthentication is security.istio.io/v1beta1 PeerAuthentication
+type PeerAuthentication struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              PeerAuthenticationSpec `json:"spec"`
+}
+
+type PeerAuthenticationSpec struct {
+	Selector      *WorkloadSelector   `json:"selector,omitempty"`
+	MTLS          *PeerMTLS           `json:"mtls,omitempty"`
+	PortLevelMTLS map[string]PeerMTLS `json:"portLevelMtls,omitempty"`
+}
+
+type WorkloadSelector struct {
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+}
+
+type PeerMTLS struct {
+	Mode string `json:"mode,omitempty"`
+}
+
+// Mode returns the workload-level mTLS mode, UNSET when none is configured
+func (pa *PeerAuthentication) Mode() string {
+	if pa.Spec.MTLS == nil || pa.Spec.MTLS.Mode == "" {
+		return MTLSUnset
+	}
+	return pa.Spec.MTLS.Mode
+}
+
+// MeshWide reports whether the policy applies to every workload in its
+// namespace, which for the root namespace means the whole mesh
+func (pa *PeerAuthentication) MeshWide() bool {
+	return pa.Spec.Selector == nil || len(pa.Spec.Selector.MatchLabels) == 0
+}
+
+// DestinationRule is networking.istio.io/v1beta1 DestinationRule
+type DestinationRule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              DestinationRuleSpec `json:"spec"`
+}
+
+type DestinationRuleSpec struct {
+	Host          string         `json:"host"`
+	TrafficPolicy *TrafficPolicy `json:"trafficPolicy,omitempty"`
+	Subsets       []Subset       `json:"subsets,omitempty"`
+}
+
+type TrafficPolicy struct {
+	TLS *ClientTLSSettings `json:"tls,omitempty"`
+}
+
+type ClientTLSSettings struct {
+	Mode string `json:"mode,omitempty"`
+}
+
+type Subset struct {
+	Name          string            `json:"name"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	TrafficPolicy *TrafficPolicy    `json:"trafficPolicy,omitempty"`
+}
+
+// VirtualService is networking.istio.io/v1beta1 VirtualService
+type VirtualService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              VirtualServiceSpec `json:"spec"`
+}
+
+type VirtualServiceSpec struct {
+	Hosts    []string    `json:"hosts,omitempty"`
+	Gateways []string    `json:"gateways,omitempty"`
+	HTTP     []HTTPRoute `json:"http,omitempty"`
+}
+
+type HTTPRoute struct {
+	Name       string                 `json:"name,omitempty"`
+	Route      []HTTPRouteDestination `json:"route,omitempty"`
+	Retries    *HTTPRetry             `json:"retries,omitempty"`
+	Timeout    string                 `json:"timeout,omitempty"`
+	CorsPolicy *CorsPolicy            `json:"corsPolicy,omitempty"`
+}
+
+type HTTPRouteDestination struct {
+	Destination Destination `json:"destination"`
+	Weight      int32       `json:"weight,omitempty"`
+}
+
+type Destination struct {
+	Host   string        `json:"host"`
+	Subset string        `json:"subset,omitempty"`
+	Port   *PortSelector `json:"port,omitempty"`
+}
+
+type PortSelector struct {
+	Number uint32 `json:"number,omitempty"`
+}
+
+type HTTPRetry struct {
+	Attempts      int32  `json:"attempts"`
+	PerTryTimeout string `json:"perTryTimeout,omitempty"`
+	RetryOn       string `json:"retryOn,omitempty"`
+}
+
+type CorsPolicy struct {
+	AllowOrigins     []StringMatch `json:"allowOrigins,omitempty"`
+	AllowMethods     []string      `json:"allowMethods,omitempty"`
+	AllowHeaders     []string      `json:"allowHeaders,omitempty"`
+	ExposeHeaders    []string      `json:"exposeHeaders,omitempty"`
+	MaxAge           string        `json:"maxAge,omitempty"`
+	AllowCredentials *bool         `json:"allowCredentials,omitempty"`
+}
+
+type StringMatch struct {
+	Exact  string `json:"exact,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+}
+
+// Gateway is networking.istio.io/v1beta1 Gateway
+type Gateway struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              GatewaySpec `json:"spec"`
+}
+
+type GatewaySpec struct {
+	Selector map[string]string `json:"selector,omitempty"`
+	Servers  []Server          `json:"servers,omitempty"`
+}
+
+type Server struct {
+	Port  Port               `json:"port"`
+	Hosts []string           `json:"hosts,omitempty"`
+	TLS   *ServerTLSSettings `json:"tls,omitempty"`
+}
+
+type Port struct {
+	Number   uint32 `json:"number"`
+	Protocol string `json:"protocol,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+type ServerTLSSettings struct {
+	Mode           string `json:"mode,omitempty"`
+	CredentialName string `json:"credentialName,omitempty"`
+}
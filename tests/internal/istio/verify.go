@@ -0,0 +1,182 @@
+package istio
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VerifyStrictMTLS checks that pa enforces STRICT mTLS for every workload it
+// selects and that no port-level override relaxes it
+func VerifyStrictMTLS(pa *PeerAuthentication) error {
+	if mode := pa.Mode(); mode != MTLSStrict {
+		return fmt.Errorf("PeerAuthentication %s/%s: mtls mode is %s, want %s", pa.Namespace, pa.Name, mode, MTLSStrict)
+	}
+	for port, mtls := range pa.Spec.PortLevelMTLS {
+		if mtls.Mode != MTLSStrict && mtls.Mode != MTLSUnset && mtls.Mode != "" {
+			return fmt.Errorf("PeerAuthentication %s/%s: port %s overrides mtls mode to %s", pa.Namespace, pa.Name, port, mtls.Mode)
+		}
+	}
+	return nil
+}
+
+// VerifyIstioMutual checks that dr originates Istio mTLS to its host,
+// including from every subset that overrides the traffic policy
+func VerifyIstioMutual(dr *DestinationRule) error {
+	if mode := tlsMode(dr.Spec.TrafficPolicy); mode != TLSIstioMutual {
+		return fmt.Errorf("DestinationRule %s/%s: tls mode is %q, want %s", dr.Namespace, dr.Name, mode, TLSIstioMutual)
+	}
+	for _, subset := range dr.Spec.Subsets {
+		if subset.TrafficPolicy == nil || subset.TrafficPolicy.TLS == nil {
+			continue
+		}
+		if mode := subset.TrafficPolicy.TLS.Mode; mode != TLSIstioMutual {
+			return fmt.Errorf("DestinationRule %s/%s: subset %s tls mode is %q, want %s", dr.Namespace, dr.Name, subset.Name, mode, TLSIstioMutual)
+		}
+	}
+	return nil
+}
+
+func tlsMode(policy *TrafficPolicy) string {
+	if policy == nil || policy.TLS == nil {
+		return ""
+	}
+	return policy.TLS.Mode
+}
+
+// VerifyRetries checks that every HTTP route of vs retries the given number
+// of attempts with the given per-try timeout
+func VerifyRetries(vs *VirtualService, attempts int32, perTryTimeout time.Duration) error {
+	if len(vs.Spec.HTTP) == 0 {
+		return fmt.Errorf("VirtualService %s/%s: no http routes", vs.Namespace, vs.Name)
+	}
+
+	var errs []error
+	for i, route := range vs.Spec.HTTP {
+		name := RouteName(i, route)
+		if route.Retries == nil {
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s: route %s has no retry policy", vs.Namespace, vs.Name, name))
+			continue
+		}
+		if route.Retries.Attempts != attempts {
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s: route %s retries %d times, want %d", vs.Namespace, vs.Name, name, route.Retries.Attempts, attempts))
+		}
+		d, err := time.ParseDuration(route.Retries.PerTryTimeout)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s: route %s perTryTimeout %q: %w", vs.Namespace, vs.Name, name, route.Retries.PerTryTimeout, err))
+		} else if d != perTryTimeout {
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s: route %s perTryTimeout is %s, want %s", vs.Namespace, vs.Name, name, d, perTryTimeout))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyCORS checks that every HTTP route of vs has a CORS policy allowing
+// at least one origin and one method
+func VerifyCORS(vs *VirtualService) error {
+	if len(vs.Spec.HTTP) == 0 {
+		return fmt.Errorf("VirtualService %s/%s: no http routes", vs.Namespace, vs.Name)
+	}
+
+	var errs []error
+	for i, route := range vs.Spec.HTTP {
+		name := RouteName(i, route)
+		switch {
+		case route.CorsPolicy == nil:
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s: route %s has no CORS policy", vs.Namespace, vs.Name, name))
+		case len(route.CorsPolicy.AllowOrigins) == 0:
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s: route %s CORS policy allows no origins", vs.Namespace, vs.Name, name))
+		case len(route.CorsPolicy.AllowMethods) == 0:
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s: route %s CORS policy allows no methods", vs.Namespace, vs.Name, name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyWeights checks that the destination weights of every HTTP route of
+// vs sum to 100. A single destination without a weight receives all traffic.
+func VerifyWeights(vs *VirtualService) error {
+	if len(vs.Spec.HTTP) == 0 {
+		return fmt.Errorf("VirtualService %s/%s: no http routes", vs.Namespace, vs.Name)
+	}
+
+	var errs []error
+	for i, route := range vs.Spec.HTTP {
+		if len(route.Route) == 1 && route.Route[0].Weight == 0 {
+			continue
+		}
+		if total := TotalWeight(route); total != 100 {
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s: route %s weights sum to %d, want 100", vs.Namespace, vs.Name, RouteName(i, route), total))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TotalWeight sums the destination weights of route
+func TotalWeight(route HTTPRoute) int32 {
+	var total int32
+	for _, dest := range route.Route {
+		total += dest.Weight
+	}
+	return total
+}
+
+// Weights returns the weight of each destination of route keyed by host,
+// or host/subset when a subset is set
+func Weights(route HTTPRoute) map[string]int32 {
+	weights := make(map[string]int32, len(route.Route))
+	for _, dest := range route.Route {
+		key := dest.Destination.Host
+		if dest.Destination.Subset != "" {
+			key += "/" + dest.Destination.Subset
+		}
+		weight := dest.Weight
+		if len(route.Route) == 1 && weight == 0 {
+			weight = 100
+		}
+		weights[key] += weight
+	}
+	return weights
+}
+
+// VerifyGatewayServes checks that gw has a server on port exposing host,
+// either by name or through a wildcard
+func VerifyGatewayServes(gw *Gateway, port uint32, host string) error {
+	for _, server := range gw.Spec.Servers {
+		if server.Port.Number != port {
+			continue
+		}
+		for _, h := range server.Hosts {
+			if hostMatches(h, host) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("Gateway %s/%s: no server on port %d exposes host %s", gw.Namespace, gw.Name, port, host)
+}
+
+// hostMatches reports whether a Gateway server host, optionally prefixed
+// with "namespace/" and possibly a wildcard, matches host
+func hostMatches(pattern, host string) bool {
+	if _, h, ok := strings.Cut(pattern, "/"); ok {
+		pattern = h
+	}
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	default:
+		return pattern == host
+	}
+}
+
+// RouteName names the i-th HTTP route of a VirtualService in messages: its
+// name, or #i when it has none
+func RouteName(i int, route HTTPRoute) string {
+	if route.Name != "" {
+		return route.Name
+	}
+	return fmt.Sprintf("#%d", i)
+}
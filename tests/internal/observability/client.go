@@ -0,0 +1,74 @@
+// Package observability queries the platform's telemetry backends over
+// their HTTP APIs: Prometheus scrape targets and instant queries, Loki log
+// ranges and Tempo traces by ID. It also checks that a request to demo-app
+// can be followed from its trace_id into both traces and logs.
+//
+// Only the response fields the platform tests assert on are decoded.
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxErrorBody bounds how much of an error response ends up in the error
+const maxErrorBody = 512
+
+// APIError is a non-2xx response from a backend
+type APIError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GET %s: %d %s: %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// apiClient issues GET requests against one backend's base URL, e.g. a
+// port-forward from harness.PortForwardService
+type apiClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func newAPIClient(baseURL string, client *http.Client) apiClient {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return apiClient{baseURL: strings.TrimSuffix(baseURL, "/"), http: client}
+}
+
+// getJSON fetches path with query and decodes the JSON body into out
+func (c apiClient) getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return &APIError{URL: u, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("GET %s: decoding response: %w", u, err)
+	}
+	return nil
+}
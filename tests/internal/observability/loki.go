@@ -0,0 +1,87 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Loki is a client for the Loki HTTP API
+type Loki struct {
+	api apiClient
+}
+
+// NewLoki returns a client for the Loki gateway at baseURL. A nil client
+// means http.DefaultClient.
+func NewLoki(baseURL string, client *http.Client) *Loki {
+	return &Loki{api: newAPIClient(baseURL, client)}
+}
+
+// Stream is the log lines of one label set
+type Stream struct {
+	Labels  map[string]string `json:"stream"`
+	Entries []Entry           `json:"values"`
+}
+
+// Entry is one log line
+type Entry struct {
+	Time time.Time
+	Line string
+}
+
+// QueryRange runs a LogQL log query over [start, end] and returns up to
+// limit lines, newest first
+func (l *Loki) QueryRange(ctx context.Context, query string, start, end time.Time, limit int) ([]Stream, error) {
+	params := url.Values{
+		"query":     {query},
+		"start":     {strconv.FormatInt(start.UnixNano(), 10)},
+		"end":       {strconv.FormatInt(end.UnixNano(), 10)},
+		"limit":     {strconv.Itoa(limit)},
+		"direction": {"backward"},
+	}
+
+	var resp promResponse[struct {
+		ResultType string   `json:"resultType"`
+		Result     []Stream `json:"result"`
+	}]
+	if err := l.api.getJSON(ctx, "/loki/api/v1/query_range", params, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.err(); err != nil {
+		return nil, err
+	}
+	if resp.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("query %q: got %s, want a log query returning streams", query, resp.Data.ResultType)
+	}
+	return resp.Data.Result, nil
+}
+
+// UnmarshalJSON decodes a ["<unix nanoseconds>", "<line>"] pair
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var pair [2]string
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	ns, err := strconv.ParseInt(pair[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("entry timestamp: %w", err)
+	}
+	e.Time = time.Unix(0, ns)
+	e.Line = pair[1]
+	return nil
+}
+
+// Lines flattens streams into their log lines
+func Lines(streams []Stream) []string {
+	var lines []string
+	for _, s := range streams {
+		for _, e := range s.Entries {
+			lines = append(lines, e.Line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,258 @@
+package observability
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanID  = "00f067aa0ba902b7"
+)
+
+// serve returns a server answering path with body, after checking the
+// request with check when set
+func serve(t *testing.T, path string, status int, body string, check func(*http.Request)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		if check != nil {
+			check(r)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPrometheusTargets(t *testing.T) {
+	srv := serve(t, "/api/v1/targets", http.StatusOK, `{
+		"status": "success",
+		"data": {"activeTargets": [
+			{"labels": {"job": "demo-app", "namespace": "demo", "service": "demo-app"},
+			 "scrapePool": "serviceMonitor/demo/demo-app/0",
+			 "scrapeUrl": "http://10.42.0.12:8080/metrics", "health": "up", "lastError": "",
+			 "lastScrape": "2024-05-01T10:00:00.123Z"},
+			{"labels": {"job": "kong", "namespace": "kong"}, "health": "down", "lastError": "connection refused"}
+		]}
+	}`, func(r *http.Request) {
+		assert.Equal(t, "active", r.URL.Query().Get("state"))
+	})
+
+	targets, err := NewPrometheus(srv.URL+"/", nil).Targets(context.Background())
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+
+	demo := FindTargets(targets, map[string]string{"namespace": "demo", "service": "demo-app"})
+	require.Len(t, demo, 1)
+	assert.Equal(t, TargetUp, demo[0].Health)
+	assert.Equal(t, "http://10.42.0.12:8080/metrics", demo[0].ScrapeURL)
+	assert.False(t, demo[0].LastScrape.IsZero())
+}
+
+func TestPrometheusQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    []Sample
+		wantErr string
+	}{
+		{
+			name:   "Vector",
+			status: http.StatusOK,
+			body: `{"status": "success", "data": {"resultType": "vector", "result": [
+				{"metric": {"__name__": "up", "service": "demo-app"}, "value": [1714557600.5, "1"]}
+			]}}`,
+			want: []Sample{{
+				Metric:    map[string]string{"__name__": "up", "service": "demo-app"},
+				Value:     1,
+				Timestamp: time.UnixMilli(1714557600500),
+			}},
+		},
+		{
+			name:   "Scalar",
+			status: http.StatusOK,
+			body:   `{"status": "success", "data": {"resultType": "scalar", "result": [1714557600, "0.25"]}}`,
+			want:   []Sample{{Metric: map[string]string{}, Value: 0.25, Timestamp: time.Unix(1714557600, 0)}},
+		},
+		{
+			name:    "Matrix",
+			status:  http.StatusOK,
+			body:    `{"status": "success", "data": {"resultType": "matrix", "result": []}}`,
+			wantErr: `unsupported result type "matrix"`,
+		},
+		{
+			name:    "BadQuery",
+			status:  http.StatusBadRequest,
+			body:    `{"status": "error", "errorType": "bad_data", "error": "parse error at char 4"}`,
+			wantErr: "400 Bad Request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serve(t, "/api/v1/query", tt.status, tt.body, func(r *http.Request) {
+				assert.Equal(t, `up{service="demo-app"}`, r.URL.Query().Get("query"))
+				assert.Equal(t, "1714557600.000", r.URL.Query().Get("time"))
+			})
+
+			samples, err := NewPrometheus(srv.URL, nil).Query(context.Background(), `up{service="demo-app"}`, time.Unix(1714557600, 0))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, samples)
+		})
+	}
+}
+
+func TestLokiQueryRange(t *testing.T) {
+	start, end := time.Unix(1714557600, 0), time.Unix(1714557900, 0)
+	srv := serve(t, "/loki/api/v1/query_range", http.StatusOK, `{
+		"status": "success",
+		"data": {"resultType": "streams", "result": [
+			{"stream": {"namespace": "demo", "pod": "demo-app-1"},
+			 "values": [["1714557601000000001", "{\"msg\":\"request\",\"trace_id\":\"`+traceID+`\"}"]]}
+		]}
+	}`, func(r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, `{namespace="demo"} |= "`+traceID+`"`, q.Get("query"))
+		assert.Equal(t, "1714557600000000000", q.Get("start"))
+		assert.Equal(t, "1714557900000000000", q.Get("end"))
+		assert.Equal(t, "backward", q.Get("direction"))
+	})
+
+	streams, err := NewLoki(srv.URL, nil).QueryRange(context.Background(), `{namespace="demo"} |= "`+traceID+`"`, start, end, 100)
+	require.NoError(t, err)
+	require.Len(t, streams, 1)
+	assert.Equal(t, "demo-app-1", streams[0].Labels["pod"])
+	assert.Equal(t, time.Unix(1714557601, 1), streams[0].Entries[0].Time)
+	assert.Contains(t, Lines(streams)[0], traceID)
+
+	metric := serve(t, "/loki/api/v1/query_range", http.StatusOK,
+		`{"status": "success", "data": {"resultType": "matrix", "result": []}}`, nil)
+	_, err = NewLoki(metric.URL, nil).QueryRange(context.Background(), `rate({namespace="demo"}[1m])`, start, end, 100)
+	assert.ErrorContains(t, err, "want a log query")
+}
+
+// tempoTrace renders a trace the way Tempo does, with base64 IDs
+func tempoTrace(service string) string {
+	b64 := func(h string) string {
+		b, _ := hex.DecodeString(h)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return fmt.Sprintf(`{"batches": [{
+		"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": %q}}]},
+		"scopeSpans": [{"spans": [{"traceId": %q, "spanId": %q, "name": %q}]}]
+	}]}`, service, b64(traceID), b64(spanID), "GET "+HelloPath)
+}
+
+func TestTempoTraceByID(t *testing.T) {
+	srv := serve(t, "/api/traces/"+traceID, http.StatusOK, tempoTrace("demo-app"), nil)
+
+	trace, err := NewTempo(srv.URL, nil).TraceByID(context.Background(), traceID)
+	require.NoError(t, err)
+	require.Len(t, trace.Spans, 1)
+	assert.Equal(t, Span{TraceID: traceID, SpanID: spanID, Name: "GET " + HelloPath, Service: "demo-app"}, trace.Spans[0])
+	assert.Equal(t, []string{"demo-app"}, trace.Services())
+
+	_, err = NewTempo(srv.URL, nil).TraceByID(context.Background(), "0af7651916cd43dd8448eb211c80319c")
+	assert.ErrorIs(t, err, ErrTraceNotFound)
+}
+
+// fakeStack serves demo-app, Tempo and Loki from one server. Tempo and
+// Loki only return the request's telemetry after `ingestAfter` polls.
+func fakeStack(t *testing.T, ingestAfter int32, service string) (*httptest.Server, *atomic.Int32) {
+	var polls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+HelloPath, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"message": "Hello, %s!", "timestamp": "2024-05-01T10:00:00Z", "trace_id": %q}`, r.URL.Query().Get("name"), traceID)
+	})
+	mux.HandleFunc("GET /api/traces/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if polls.Add(1) <= ingestAfter || r.PathValue("id") != traceID {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, tempoTrace(service))
+	})
+	mux.HandleFunc("GET /loki/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		values := ""
+		if polls.Load() > ingestAfter {
+			values = fmt.Sprintf(`["%d", "{\"msg\":\"request\",\"trace_id\":\"%s\"}"]`, time.Now().UnixNano(), traceID)
+		}
+		fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "streams", "result": [{"stream": {"namespace": "demo"}, "values": [%s]}]}}`, values)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &polls
+}
+
+func newRoundTrip(srv *httptest.Server) *RoundTrip {
+	return &RoundTrip{
+		AppURL:      srv.URL,
+		Tempo:       NewTempo(srv.URL, nil),
+		Loki:        NewLoki(srv.URL, nil),
+		LogSelector: `{namespace="demo"}`,
+		Service:     "demo-app",
+		Interval:    5 * time.Millisecond,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	srv, polls := fakeStack(t, 3, "demo-app")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := newRoundTrip(srv).Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, traceID, res.TraceID)
+	assert.Equal(t, traceID, res.Trace.Spans[0].TraceID)
+	require.NotEmpty(t, res.Logs)
+	assert.Contains(t, res.Logs[0], traceID)
+	assert.EqualValues(t, 4, polls.Load(), "Tempo is not polled again once the trace is found")
+}
+
+func TestRoundTripReportsMissingTelemetry(t *testing.T) {
+	t.Run("NeverIngested", func(t *testing.T) {
+		srv, _ := fakeStack(t, 1<<30, "demo-app")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := newRoundTrip(srv).Run(ctx)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "tempo: trace not found")
+		assert.ErrorContains(t, err, `loki: no line matches {namespace="demo"} |= "`+traceID+`"`)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("WrongService", func(t *testing.T) {
+		srv, _ := fakeStack(t, 0, "kong")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := newRoundTrip(srv).Run(ctx)
+		assert.ErrorContains(t, err, "no span from service demo-app, got [kong]")
+	})
+}
@@ -0,0 +1,171 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Target health values reported by /api/v1/targets
+const (
+	TargetUp      = "up"
+	TargetDown    = "down"
+	TargetUnknown = "unknown"
+)
+
+// Prometheus is a client for the Prometheus HTTP API
+type Prometheus struct {
+	api apiClient
+}
+
+// NewPrometheus returns a client for the Prometheus server at baseURL. A
+// nil client means http.DefaultClient.
+func NewPrometheus(baseURL string, client *http.Client) *Prometheus {
+	return &Prometheus{api: newAPIClient(baseURL, client)}
+}
+
+// Target is one active scrape target
+type Target struct {
+	Labels     map[string]string `json:"labels"`
+	ScrapePool string            `json:"scrapePool"`
+	ScrapeURL  string            `json:"scrapeUrl"`
+	Health     string            `json:"health"`
+	LastError  string            `json:"lastError"`
+	LastScrape time.Time         `json:"lastScrape"`
+}
+
+// Sample is one series of an instant vector
+type Sample struct {
+	Metric    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+// promResponse is the envelope of every Prometheus API response
+type promResponse[T any] struct {
+	Status    string `json:"status"`
+	Data      T      `json:"data"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+}
+
+// Targets returns the active scrape targets
+func (p *Prometheus) Targets(ctx context.Context) ([]Target, error) {
+	var resp promResponse[struct {
+		ActiveTargets []Target `json:"activeTargets"`
+	}]
+	if err := p.get(ctx, "/api/v1/targets", url.Values{"state": {"active"}}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data.ActiveTargets, nil
+}
+
+// Query evaluates an instant query at ts, or now when ts is zero. Only
+// vector and scalar results are supported; a scalar becomes a single sample
+// without labels.
+func (p *Prometheus) Query(ctx context.Context, query string, ts time.Time) ([]Sample, error) {
+	params := url.Values{"query": {query}}
+	if !ts.IsZero() {
+		params.Set("time", strconv.FormatFloat(float64(ts.UnixMilli())/1e3, 'f', 3, 64))
+	}
+
+	var resp promResponse[struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}]
+	if err := p.get(ctx, "/api/v1/query", params, &resp); err != nil {
+		return nil, err
+	}
+
+	switch resp.Data.ResultType {
+	case "vector":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Value  promValue         `json:"value"`
+		}
+		if err := json.Unmarshal(resp.Data.Result, &series); err != nil {
+			return nil, fmt.Errorf("query %q: decoding vector: %w", query, err)
+		}
+		samples := make([]Sample, len(series))
+		for i, s := range series {
+			samples[i] = Sample{Metric: s.Metric, Value: s.Value.value, Timestamp: s.Value.timestamp}
+		}
+		return samples, nil
+	case "scalar":
+		var v promValue
+		if err := json.Unmarshal(resp.Data.Result, &v); err != nil {
+			return nil, fmt.Errorf("query %q: decoding scalar: %w", query, err)
+		}
+		return []Sample{{Metric: map[string]string{}, Value: v.value, Timestamp: v.timestamp}}, nil
+	default:
+		return nil, fmt.Errorf("query %q: unsupported result type %q", query, resp.Data.ResultType)
+	}
+}
+
+func (p *Prometheus) get(ctx context.Context, path string, params url.Values, resp interface{ err() error }) error {
+	if err := p.api.getJSON(ctx, path, params, resp); err != nil {
+		return err
+	}
+	return resp.err()
+}
+
+func (r *promResponse[T]) err() error {
+	if r.Status != "success" {
+		return fmt.Errorf("prometheus %s: %s", r.ErrorType, r.Error)
+	}
+	return nil
+}
+
+// promValue is a [<unix seconds>, "<value>"] pair
+type promValue struct {
+	timestamp time.Time
+	value     float64
+}
+
+func (v *promValue) UnmarshalJSON(data []byte) error {
+	var pair [2]json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+
+	var ts float64
+	if err := json.Unmarshal(pair[0], &ts); err != nil {
+		return fmt.Errorf("sample timestamp: %w", err)
+	}
+	var s string
+	if err := json.Unmarshal(pair[1], &s); err != nil {
+		return fmt.Errorf("sample value: %w", err)
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("sample value: %w", err)
+	}
+
+	sec, frac := math.Modf(ts)
+	v.timestamp = time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond))
+	v.value = value
+	return nil
+}
+
+// FindTargets returns the targets carrying every label in match
+func FindTargets(targets []Target, match map[string]string) []Target {
+	var found []Target
+	for _, t := range targets {
+		matches := true
+		for k, v := range match {
+			if t.Labels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, t)
+		}
+	}
+	return found
+}
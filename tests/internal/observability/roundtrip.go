@@ -0,0 +1,148 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// HelloPath is the demo-app route the round trip calls. Its span is named
+// "GET " + HelloPath.
+const HelloPath = "/api/v1/hello"
+
+// RoundTrip follows one demo-app request into the telemetry backends by
+// its trace ID
+type RoundTrip struct {
+	// AppURL is demo-app's base URL; AppClient defaults to http.DefaultClient
+	AppURL    string
+	AppClient *http.Client
+	Tempo     *Tempo
+	Loki      *Loki
+	// LogSelector is the LogQL stream selector of demo-app's logs, e.g.
+	// {namespace="demo"}
+	LogSelector string
+	// Service, when set, must be the service.name of a span in the trace
+	Service string
+	// Interval between backend polls while the telemetry is ingested
+	Interval time.Duration
+}
+
+// RoundTripResult is what the backends returned for the request
+type RoundTripResult struct {
+	TraceID string
+	Trace   *Trace
+	Logs    []string
+}
+
+// Run calls GET HelloPath on demo-app, takes the trace_id from its
+// MessageResponse, and polls until Tempo returns the trace and Loki a log
+// line containing the ID. If ctx ends first, the error names every backend
+// that had not received it.
+func (r *RoundTrip) Run(ctx context.Context) (*RoundTripResult, error) {
+	sent := time.Now()
+	traceID, err := r.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RoundTripResult{TraceID: traceID}
+	query := fmt.Sprintf("%s |= %q", r.LogSelector, traceID)
+	var pending []error
+
+	poll := func(ctx context.Context) (bool, error) {
+		var reasons []error
+		// Keep the reasons of the last complete poll, not the cancellation
+		// of the one cut short by ctx
+		defer func() {
+			if ctx.Err() == nil {
+				pending = reasons
+			}
+		}()
+
+		if res.Trace == nil {
+			trace, err := r.Tempo.TraceByID(ctx, traceID)
+			if err == nil {
+				err = r.verifyTrace(traceID, trace)
+			}
+			if err != nil {
+				reasons = append(reasons, fmt.Errorf("tempo: %w", err))
+			} else {
+				res.Trace = trace
+			}
+		}
+
+		if len(res.Logs) == 0 {
+			// Allow for clock skew between the test runner and the cluster
+			streams, err := r.Loki.QueryRange(ctx, query, sent.Add(-time.Minute), time.Now().Add(time.Minute), 100)
+			switch {
+			case err != nil:
+				reasons = append(reasons, fmt.Errorf("loki: %w", err))
+			case len(Lines(streams)) == 0:
+				reasons = append(reasons, fmt.Errorf("loki: no line matches %s", query))
+			default:
+				res.Logs = Lines(streams)
+			}
+		}
+
+		return len(reasons) == 0, nil
+	}
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	if err := wait.PollUntilContextCancel(ctx, interval, true, poll); err != nil {
+		return res, fmt.Errorf("trace %s did not round-trip: %w", traceID, errors.Join(append(pending, err)...))
+	}
+	return res, nil
+}
+
+// call makes the request and returns the trace ID demo-app reports for it
+func (r *RoundTrip) call(ctx context.Context) (string, error) {
+	client := r.AppClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.AppURL+HelloPath+"?name=roundtrip", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+	var msg struct {
+		TraceID string `json:"trace_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return "", fmt.Errorf("GET %s: decoding MessageResponse: %w", req.URL, err)
+	}
+	if msg.TraceID == "" {
+		return "", fmt.Errorf("GET %s: no trace_id in response; is tracing enabled?", req.URL)
+	}
+	return msg.TraceID, nil
+}
+
+func (r *RoundTrip) verifyTrace(traceID string, trace *Trace) error {
+	for _, s := range trace.Spans {
+		if s.TraceID != traceID {
+			return fmt.Errorf("span %s belongs to trace %s", s.SpanID, s.TraceID)
+		}
+	}
+	if r.Service != "" && !slices.Contains(trace.Services(), r.Service) {
+		return fmt.Errorf("no span from service %s, got %v", r.Service, trace.Services())
+	}
+	return nil
+}
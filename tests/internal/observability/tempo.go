@@ -0,0 +1,141 @@
+package observability
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrTraceNotFound is returned by TraceByID while Tempo has not ingested
+// the trace, which is normal for a few seconds after the request
+var ErrTraceNotFound = errors.New("trace not found")
+
+// Tempo is a client for the Tempo query API
+type Tempo struct {
+	api apiClient
+}
+
+// NewTempo returns a client for the Tempo query frontend at baseURL. A nil
+// client means http.DefaultClient.
+func NewTempo(baseURL string, client *http.Client) *Tempo {
+	return &Tempo{api: newAPIClient(baseURL, client)}
+}
+
+// Trace is the flattened spans of one trace
+type Trace struct {
+	Spans []Span
+}
+
+// Span is the subset of an OTLP span the tests assert on. IDs are lower
+// case hex, as in W3C traceparent and demo-app's trace_id.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Service      string
+}
+
+// Services returns the distinct service.name values in the trace
+func (t *Trace) Services() []string {
+	seen := map[string]bool{}
+	var services []string
+	for _, s := range t.Spans {
+		if !seen[s.Service] {
+			seen[s.Service] = true
+			services = append(services, s.Service)
+		}
+	}
+	return services
+}
+
+// TraceByID fetches the trace with the hex trace ID id
+func (t *Tempo) TraceByID(ctx context.Context, id string) (*Trace, error) {
+	var resp otlpTrace
+	err := t.api.getJSON(ctx, "/api/traces/"+id, nil, &resp)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, ErrTraceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trace := &Trace{}
+	for _, rs := range append(resp.Batches, resp.ResourceSpans...) {
+		service := rs.Resource.attribute("service.name")
+		for _, ss := range append(rs.ScopeSpans, rs.InstrumentationLibrarySpans...) {
+			for _, s := range ss.Spans {
+				trace.Spans = append(trace.Spans, Span{
+					TraceID:      hexID(s.TraceID),
+					SpanID:       hexID(s.SpanID),
+					ParentSpanID: hexID(s.ParentSpanID),
+					Name:         s.Name,
+					Service:      service,
+				})
+			}
+		}
+	}
+	if len(trace.Spans) == 0 {
+		return nil, ErrTraceNotFound
+	}
+	return trace, nil
+}
+
+// otlpTrace is Tempo's OTLP JSON, which names the resource spans "batches"
+// and, before OTLP 0.15, the scope spans "instrumentationLibrarySpans"
+type otlpTrace struct {
+	Batches       []otlpResourceSpans `json:"batches"`
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource                    otlpResource     `json:"resource"`
+	ScopeSpans                  []otlpScopeSpans `json:"scopeSpans"`
+	InstrumentationLibrarySpans []otlpScopeSpans `json:"instrumentationLibrarySpans"`
+}
+
+type otlpResource struct {
+	Attributes []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+}
+
+func (r otlpResource) attribute(key string) string {
+	for _, a := range r.Attributes {
+		if a.Key == key {
+			return a.Value.StringValue
+		}
+	}
+	return ""
+}
+
+type otlpScopeSpans struct {
+	Spans []struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+	} `json:"spans"`
+}
+
+// hexID normalises an OTLP JSON ID to hex. Tempo encodes IDs as base64
+// protobuf bytes; OTLP/JSON proper uses hex.
+func hexID(id string) string {
+	if id == "" {
+		return ""
+	}
+	if _, err := hex.DecodeString(id); err == nil && (len(id) == 16 || len(id) == 32) {
+		return strings.ToLower(id)
+	}
+	if b, err := base64.StdEncoding.DecodeString(id); err == nil {
+		return hex.EncodeToString(b)
+	}
+	return id
+}
@@ -0,0 +1,241 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// gatekeeperTarget is the only target Gatekeeper evaluates templates for
+const gatekeeperTarget = "admission.k8s.gatekeeper.sh"
+
+// ConstraintTemplate is a Gatekeeper ConstraintTemplate
+type ConstraintTemplate struct {
+	Name string
+	// Kind is the kind of the constraints created from the template
+	Kind string
+	Rego string
+	Libs []string
+	// Package is the Rego package of the template
+	Package string
+}
+
+var regoPackage = regexp.MustCompile(`(?m)^\s*package\s+([A-Za-z0-9_.]+)`)
+
+// ParseConstraintTemplate decodes a ConstraintTemplate manifest
+func ParseConstraintTemplate(obj *unstructured.Unstructured) (*ConstraintTemplate, error) {
+	if obj.GetKind() != "ConstraintTemplate" {
+		return nil, fmt.Errorf("%s %s is not a ConstraintTemplate", obj.GetKind(), obj.GetName())
+	}
+	var spec struct {
+		CRD struct {
+			Spec struct {
+				Names struct {
+					Kind string `json:"kind"`
+				} `json:"names"`
+			} `json:"spec"`
+		} `json:"crd"`
+		Targets []struct {
+			Target string   `json:"target"`
+			Rego   string   `json:"rego"`
+			Libs   []string `json:"libs"`
+		} `json:"targets"`
+	}
+	if err := decode(obj.Object["spec"], &spec); err != nil {
+		return nil, fmt.Errorf("ConstraintTemplate %s: %w", obj.GetName(), err)
+	}
+
+	t := &ConstraintTemplate{Name: obj.GetName(), Kind: spec.CRD.Spec.Names.Kind}
+	for _, target := range spec.Targets {
+		if target.Target == gatekeeperTarget {
+			t.Rego, t.Libs = target.Rego, target.Libs
+		}
+	}
+	m := regoPackage.FindStringSubmatch(t.Rego)
+	if m == nil {
+		return nil, fmt.Errorf("ConstraintTemplate %s has no Rego for %s", obj.GetName(), gatekeeperTarget)
+	}
+	t.Package = m[1]
+	return t, nil
+}
+
+// Query is the Rego query whose results are the template's violations
+func (t *ConstraintTemplate) Query() string {
+	return "data." + t.Package + ".violation"
+}
+
+// CompiledTemplate is a ConstraintTemplate whose Rego is ready to evaluate
+type CompiledTemplate struct {
+	*ConstraintTemplate
+	query rego.PreparedEvalQuery
+}
+
+// Compile compiles the template's Rego and libs. Gatekeeper 3.15 runs
+// templates as Rego v0, without the if and contains keywords.
+func (t *ConstraintTemplate) Compile(ctx context.Context) (*CompiledTemplate, error) {
+	opts := []func(*rego.Rego){
+		rego.Query(t.Query()),
+		rego.Module(t.Name+".rego", t.Rego),
+		rego.SetRegoVersion(ast.RegoV0),
+	}
+	for i, lib := range t.Libs {
+		opts = append(opts, rego.Module(fmt.Sprintf("%s/lib%d.rego", t.Name, i), lib))
+	}
+	query, err := rego.New(opts...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("compiling the Rego of %s: %w", t.Name, err)
+	}
+	return &CompiledTemplate{ConstraintTemplate: t, query: query}, nil
+}
+
+// Review evaluates the template for obj with the parameters of c. It does
+// not check that c matches obj; see Constraint.Matches.
+func (t *CompiledTemplate) Review(ctx context.Context, c *Constraint, obj *unstructured.Unstructured) ([]Violation, error) {
+	if c.Kind != t.Kind {
+		return nil, fmt.Errorf("%s %s is not a constraint of %s", c.Kind, c.Name, t.Name)
+	}
+	rs, err := t.query.Eval(ctx, rego.EvalInput(c.Input(obj)))
+	if err != nil {
+		return nil, fmt.Errorf("evaluating %s for %s %s: %w", t.Name, obj.GetKind(), obj.GetName(), err)
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return nil, nil
+	}
+	return DecodeViolations(rs[0].Expressions[0].Value)
+}
+
+// Constraint is an instance of a ConstraintTemplate
+type Constraint struct {
+	Kind              string
+	Name              string
+	Match             ConstraintMatch
+	Parameters        map[string]any
+	EnforcementAction string
+}
+
+// ConstraintMatch selects the resources a constraint reviews
+type ConstraintMatch struct {
+	Kinds []KindMatch `json:"kinds,omitempty"`
+	// Scope is "*", "Cluster" or "Namespaced"
+	Scope              string                `json:"scope,omitempty"`
+	Name               string                `json:"name,omitempty"`
+	Namespaces         []string              `json:"namespaces,omitempty"`
+	ExcludedNamespaces []string              `json:"excludedNamespaces,omitempty"`
+	LabelSelector      *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+// ParseConstraint decodes a constraint manifest. Its kind is that of its
+// ConstraintTemplate.
+func ParseConstraint(obj *unstructured.Unstructured) (*Constraint, error) {
+	var spec struct {
+		Match             ConstraintMatch `json:"match"`
+		Parameters        map[string]any  `json:"parameters"`
+		EnforcementAction string          `json:"enforcementAction"`
+	}
+	if err := decode(obj.Object["spec"], &spec); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	if spec.EnforcementAction == "" {
+		spec.EnforcementAction = "deny"
+	}
+	if spec.Parameters == nil {
+		spec.Parameters = map[string]any{}
+	}
+	return &Constraint{
+		Kind:              obj.GetKind(),
+		Name:              obj.GetName(),
+		Match:             spec.Match,
+		Parameters:        spec.Parameters,
+		EnforcementAction: spec.EnforcementAction,
+	}, nil
+}
+
+// KindMatch selects kinds by API group and kind; "*" matches any
+type KindMatch struct {
+	APIGroups []string `json:"apiGroups"`
+	Kinds     []string `json:"kinds"`
+}
+
+// Matches reports whether the constraint reviews obj. exempt are the
+// namespaces Gatekeeper skips altogether, as in its exemptNamespaces
+// setting.
+func (c *Constraint) Matches(obj *unstructured.Unstructured, exempt ...string) bool {
+	m := c.Match
+	ns := obj.GetNamespace()
+	if ns != "" && matchesAny(exempt, ns) {
+		return false
+	}
+
+	gvk := obj.GroupVersionKind()
+	if len(m.Kinds) > 0 && !slices.ContainsFunc(m.Kinds, func(k KindMatch) bool {
+		return matchesAny(k.APIGroups, gvk.Group) && matchesAny(k.Kinds, gvk.Kind)
+	}) {
+		return false
+	}
+
+	switch m.Scope {
+	case "Cluster":
+		if ns != "" {
+			return false
+		}
+	case "Namespaced":
+		if ns == "" {
+			return false
+		}
+	}
+	if m.Name != "" && !wildcard(m.Name, obj.GetName()) {
+		return false
+	}
+	if len(m.Namespaces) > 0 && (ns == "" || !matchesAny(m.Namespaces, ns)) {
+		return false
+	}
+	if ns != "" && matchesAny(m.ExcludedNamespaces, ns) {
+		return false
+	}
+	if m.LabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(m.LabelSelector)
+		if err != nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+			return false
+		}
+	}
+	return true
+}
+
+// Input is the document the template's Rego evaluates for obj: the
+// admission review and the constraint's parameters
+func (c *Constraint) Input(obj *unstructured.Unstructured) map[string]any {
+	gvk := obj.GroupVersionKind()
+	return map[string]any{
+		"review": map[string]any{
+			"kind":      map[string]any{"group": gvk.Group, "version": gvk.Version, "kind": gvk.Kind},
+			"name":      obj.GetName(),
+			"namespace": obj.GetNamespace(),
+			"operation": Operation,
+			"object":    obj.Object,
+		},
+		"parameters": c.Parameters,
+	}
+}
+
+// Violation is one result of a template's violation rule
+type Violation struct {
+	Msg     string         `json:"msg"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// DecodeViolations converts the value of the violation query, a set of
+// objects, into Violations
+func DecodeViolations(value any) ([]Violation, error) {
+	var out []Violation
+	if err := decode(value, &out); err != nil {
+		return nil, fmt.Errorf("decoding violations: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,317 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Operation is the admission operation policies are evaluated for; fixtures
+// are reviewed as if they were being created
+const Operation = "CREATE"
+
+// KyvernoPolicy is a Kyverno ClusterPolicy or Policy. Only the fields the
+// evaluator understands are decoded.
+type KyvernoPolicy struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Rules     []Rule
+}
+
+// Rule is one rule of a Kyverno policy
+type Rule struct {
+	Name          string          `json:"name"`
+	Match         MatchResources  `json:"match"`
+	Exclude       MatchResources  `json:"exclude"`
+	Preconditions json.RawMessage `json:"preconditions,omitempty"`
+	Generate      *Generation     `json:"generate,omitempty"`
+}
+
+// MatchResources selects resources by any or all of its filters, or by the
+// legacy resources field
+type MatchResources struct {
+	Any       []ResourceFilter     `json:"any,omitempty"`
+	All       []ResourceFilter     `json:"all,omitempty"`
+	Resources *ResourceDescription `json:"resources,omitempty"`
+}
+
+// ResourceFilter is one entry of match.any or match.all
+type ResourceFilter struct {
+	Resources ResourceDescription `json:"resources"`
+}
+
+// ResourceDescription describes resources by kind, name, namespace, labels
+// and operation. Names and namespaces may use * and ? wildcards.
+type ResourceDescription struct {
+	Kinds      []string              `json:"kinds,omitempty"`
+	Name       string                `json:"name,omitempty"`
+	Names      []string              `json:"names,omitempty"`
+	Namespaces []string              `json:"namespaces,omitempty"`
+	Operations []string              `json:"operations,omitempty"`
+	Selector   *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// Generation is the generate block of a rule
+type Generation struct {
+	APIVersion  string          `json:"apiVersion"`
+	Kind        string          `json:"kind"`
+	Name        string          `json:"name"`
+	Namespace   string          `json:"namespace"`
+	Synchronize bool            `json:"synchronize"`
+	Data        map[string]any  `json:"data,omitempty"`
+	Clone       json.RawMessage `json:"clone,omitempty"`
+	CloneList   json.RawMessage `json:"cloneList,omitempty"`
+}
+
+// ParseKyvernoPolicy decodes a ClusterPolicy or Policy manifest
+func ParseKyvernoPolicy(obj *unstructured.Unstructured) (*KyvernoPolicy, error) {
+	if obj.GetKind() != "ClusterPolicy" && obj.GetKind() != "Policy" {
+		return nil, fmt.Errorf("%s %s is not a Kyverno policy", obj.GetKind(), obj.GetName())
+	}
+	var spec struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := decode(obj.Object["spec"], &spec); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return &KyvernoPolicy{Kind: obj.GetKind(), Name: obj.GetName(), Namespace: obj.GetNamespace(), Rules: spec.Rules}, nil
+}
+
+// decode converts a value of an unstructured object into out
+func decode(in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Generated is a resource created by a generate rule
+type Generated struct {
+	Rule string
+	// Synchronize is whether Kyverno keeps the resource in sync with the
+	// rule and its trigger
+	Synchronize bool
+	Object      *unstructured.Unstructured
+}
+
+// Generate applies the generate rules of p to the creation of resource and
+// returns what they create. Rules with preconditions or clone sources are
+// reported as errors rather than guessed at.
+func (p *KyvernoPolicy) Generate(resource *unstructured.Unstructured) ([]Generated, error) {
+	if p.Kind == "Policy" && resourceNamespace(resource) != p.Namespace {
+		return nil, nil
+	}
+
+	vars := map[string]any{
+		"request": map[string]any{
+			"operation": Operation,
+			"namespace": resource.GetNamespace(),
+			"object":    resource.Object,
+		},
+	}
+
+	var out []Generated
+	for _, rule := range p.Rules {
+		gen := rule.Generate
+		if gen == nil || !rule.Matches(resource) {
+			continue
+		}
+		switch {
+		case len(rule.Preconditions) > 0:
+			return nil, fmt.Errorf("rule %s: preconditions are not supported", rule.Name)
+		case len(gen.Clone) > 0 || len(gen.CloneList) > 0:
+			return nil, fmt.Errorf("rule %s: clone is not supported", rule.Name)
+		}
+
+		obj, err := gen.render(vars)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		out = append(out, Generated{Rule: rule.Name, Synchronize: gen.Synchronize, Object: obj})
+	}
+	return out, nil
+}
+
+// render builds the generated resource from the data, with the variables
+// substituted
+func (g *Generation) render(vars map[string]any) (*unstructured.Unstructured, error) {
+	data, err := substitute(g.Data, vars)
+	if err != nil {
+		return nil, err
+	}
+	name, err := substitute(g.Name, vars)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := substitute(g.Namespace, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	content, _ := data.(map[string]any)
+	if content == nil {
+		content = map[string]any{}
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetAPIVersion(g.APIVersion)
+	obj.SetKind(g.Kind)
+	obj.SetName(fmt.Sprint(name))
+	obj.SetNamespace(fmt.Sprint(namespace))
+	return obj, nil
+}
+
+// Matches reports whether the rule's match selects resource and its
+// exclude does not
+func (r Rule) Matches(resource *unstructured.Unstructured) bool {
+	return r.Match.matches(resource) && !r.Exclude.matches(resource)
+}
+
+func (m MatchResources) matches(resource *unstructured.Unstructured) bool {
+	switch {
+	case len(m.Any) > 0:
+		return slices.ContainsFunc(m.Any, func(f ResourceFilter) bool { return f.Resources.matches(resource) })
+	case len(m.All) > 0:
+		return !slices.ContainsFunc(m.All, func(f ResourceFilter) bool { return !f.Resources.matches(resource) })
+	case m.Resources != nil:
+		return m.Resources.matches(resource)
+	default:
+		return false
+	}
+}
+
+func (d ResourceDescription) matches(resource *unstructured.Unstructured) bool {
+	if len(d.Kinds) > 0 && !slices.ContainsFunc(d.Kinds, func(k string) bool { return kindMatches(k, resource) }) {
+		return false
+	}
+	if d.Name != "" && !wildcard(d.Name, resource.GetName()) {
+		return false
+	}
+	if len(d.Names) > 0 && !matchesAny(d.Names, resource.GetName()) {
+		return false
+	}
+	if len(d.Namespaces) > 0 && !matchesAny(d.Namespaces, resourceNamespace(resource)) {
+		return false
+	}
+	if len(d.Operations) > 0 && !slices.Contains(d.Operations, Operation) {
+		return false
+	}
+	if d.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(d.Selector)
+		if err != nil || !selector.Matches(labels.Set(resource.GetLabels())) {
+			return false
+		}
+	}
+	return true
+}
+
+// resourceNamespace is the namespace Kyverno matches a resource by: a
+// Namespace is matched by its own name
+func resourceNamespace(resource *unstructured.Unstructured) string {
+	if resource.GetKind() == "Namespace" && resource.GetAPIVersion() == "v1" {
+		return resource.GetName()
+	}
+	return resource.GetNamespace()
+}
+
+// kindMatches matches a Kyverno kind, written Kind, version/Kind or
+// group/version/Kind
+func kindMatches(kind string, resource *unstructured.Unstructured) bool {
+	gvk := resource.GroupVersionKind()
+	parts := strings.Split(kind, "/")
+	if !wildcard(parts[len(parts)-1], gvk.Kind) {
+		return false
+	}
+	switch len(parts) {
+	case 2:
+		return wildcard(parts[0], gvk.Version)
+	case 3:
+		return wildcard(parts[0], gvk.Group) && wildcard(parts[1], gvk.Version)
+	default:
+		return true
+	}
+}
+
+func matchesAny(patterns []string, s string) bool {
+	return slices.ContainsFunc(patterns, func(p string) bool { return wildcard(p, s) })
+}
+
+// wildcard matches s against a pattern with * and ? wildcards
+func wildcard(pattern, s string) bool {
+	ok, err := path.Match(pattern, s)
+	return err == nil && ok
+}
+
+var (
+	variable = regexp.MustCompile(`\{\{\s*(.*?)\s*\}\}`)
+	// variablePath is the subset of JMESPath the evaluator supports
+	variablePath = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+)
+
+// substitute replaces the {{ }} variables in the strings of value. A string
+// that is a single variable takes the variable's value, whatever its type.
+func substitute(value any, vars map[string]any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if m := variable.FindStringSubmatch(v); m != nil && m[0] == v {
+			return lookup(m[1], vars)
+		}
+		var err error
+		out := variable.ReplaceAllStringFunc(v, func(s string) string {
+			val, lerr := lookup(variable.FindStringSubmatch(s)[1], vars)
+			if lerr != nil {
+				err = lerr
+			}
+			return fmt.Sprint(val)
+		})
+		return out, err
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			s, err := substitute(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = s
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			s, err := substitute(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = s
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+// lookup resolves a dotted variable path such as request.object.metadata.name
+func lookup(expr string, vars map[string]any) (any, error) {
+	if !variablePath.MatchString(expr) {
+		return nil, fmt.Errorf("variable %q: only dotted paths are supported", expr)
+	}
+	var value any = vars
+	for _, key := range strings.Split(expr, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("variable %q not found", expr)
+		}
+		if value, ok = m[key]; !ok {
+			return nil, fmt.Errorf("variable %q not found", expr)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,448 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+func object(t *testing.T, manifest string) *unstructured.Unstructured {
+	t.Helper()
+	var content map[string]any
+	require.NoError(t, yaml.Unmarshal([]byte(manifest), &content))
+	return &unstructured.Unstructured{Object: content}
+}
+
+func namespace(name string) *unstructured.Unstructured {
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName(name)
+	return ns
+}
+
+const generatePolicy = `
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: add-quota
+spec:
+  rules:
+    - name: quota
+      match:
+        any:
+          - resources:
+              kinds: [Namespace]
+      exclude:
+        any:
+          - resources:
+              namespaces: [kube-*]
+      generate:
+        apiVersion: v1
+        kind: ResourceQuota
+        name: "quota-{{ request.object.metadata.name }}"
+        namespace: "{{request.object.metadata.name}}"
+        synchronize: true
+        data:
+          metadata:
+            labels:
+              team: "{{request.object.metadata.labels}}"
+          spec:
+            hard:
+              pods: "10"
+`
+
+func TestKyvernoGenerate(t *testing.T) {
+	p, err := ParseKyvernoPolicy(object(t, generatePolicy))
+	require.NoError(t, err)
+
+	ns := namespace("shop")
+	ns.SetLabels(map[string]string{"team": "web"})
+	generated, err := p.Generate(ns)
+	require.NoError(t, err)
+	require.Len(t, generated, 1)
+
+	g := generated[0]
+	assert.Equal(t, "quota", g.Rule)
+	assert.True(t, g.Synchronize)
+	assert.Equal(t, "ResourceQuota", g.Object.GetKind())
+	assert.Equal(t, "quota-shop", g.Object.GetName(), "variables are substituted inside strings")
+	assert.Equal(t, "shop", g.Object.GetNamespace())
+	team, _, _ := unstructured.NestedMap(g.Object.Object, "metadata", "labels", "team")
+	assert.Equal(t, map[string]any{"team": "web"}, team, "a lone variable keeps its type")
+	pods, _, _ := unstructured.NestedString(g.Object.Object, "spec", "hard", "pods")
+	assert.Equal(t, "10", pods)
+
+	generated, err = p.Generate(namespace("kube-system"))
+	require.NoError(t, err)
+	assert.Empty(t, generated, "a Namespace is excluded by its own name")
+
+	deployment := object(t, "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: shop\n")
+	generated, err = p.Generate(deployment)
+	require.NoError(t, err)
+	assert.Empty(t, generated, "other kinds do not match")
+}
+
+func TestKyvernoGenerateErrors(t *testing.T) {
+	tests := map[string]string{
+		"MissingVariable":   `{{request.object.metadata.uid}}`,
+		"UnsupportedSyntax": `{{ to_upper(request.object.metadata.name) }}`,
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			obj := object(t, generatePolicy)
+			rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+			require.NoError(t, unstructured.SetNestedField(rules[0].(map[string]any), value, "generate", "namespace"))
+			require.NoError(t, unstructured.SetNestedSlice(obj.Object, rules, "spec", "rules"))
+
+			p, err := ParseKyvernoPolicy(obj)
+			require.NoError(t, err)
+			_, err = p.Generate(namespace("shop"))
+			assert.ErrorContains(t, err, "rule quota")
+		})
+	}
+
+	t.Run("Preconditions", func(t *testing.T) {
+		obj := object(t, generatePolicy)
+		rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		rules[0].(map[string]any)["preconditions"] = map[string]any{"all": []any{}}
+		require.NoError(t, unstructured.SetNestedSlice(obj.Object, rules, "spec", "rules"))
+
+		p, err := ParseKyvernoPolicy(obj)
+		require.NoError(t, err)
+		_, err = p.Generate(namespace("shop"))
+		assert.ErrorContains(t, err, "preconditions are not supported")
+	})
+
+	_, err := ParseKyvernoPolicy(namespace("shop"))
+	assert.Error(t, err)
+}
+
+func TestRuleMatches(t *testing.T) {
+	deployment := object(t, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web-frontend
+  namespace: shop
+  labels:
+    tier: frontend
+`)
+
+	tests := []struct {
+		name  string
+		match string
+		want  bool
+	}{
+		{"Kind", "any: [{resources: {kinds: [Deployment]}}]", true},
+		{"GroupVersionKind", "any: [{resources: {kinds: [apps/v1/Deployment]}}]", true},
+		{"WrongVersion", "any: [{resources: {kinds: [v2/Deployment]}}]", false},
+		{"AnyOf", "any: [{resources: {kinds: [Pod]}}, {resources: {names: [web-*]}}]", true},
+		{"AllOf", "all: [{resources: {kinds: [Deployment]}}, {resources: {namespaces: [prod]}}]", false},
+		{"Legacy", "resources: {kinds: [Deployment], name: 'web-?rontend'}", true},
+		{"Selector", "any: [{resources: {kinds: [Deployment], selector: {matchLabels: {tier: backend}}}}]", false},
+		{"Operations", "any: [{resources: {kinds: [Deployment], operations: [DELETE]}}]", false},
+		{"Empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rule Rule
+			require.NoError(t, yaml.Unmarshal([]byte("name: r\nmatch: {"+tt.match+"}"), &rule))
+			assert.Equal(t, tt.want, rule.Matches(deployment))
+		})
+	}
+}
+
+func TestNamespacedPolicy(t *testing.T) {
+	p, err := ParseKyvernoPolicy(object(t, `
+apiVersion: kyverno.io/v1
+kind: Policy
+metadata:
+  name: copy-settings
+  namespace: shop
+spec:
+  rules:
+    - name: copy
+      match:
+        any:
+          - resources:
+              kinds: [ConfigMap]
+      generate:
+        apiVersion: v1
+        kind: ConfigMap
+        name: "{{request.object.metadata.name}}-copy"
+        namespace: "{{request.namespace}}"
+`))
+	require.NoError(t, err)
+	configMap := func(ns string) *unstructured.Unstructured {
+		return object(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: "+ns+"\n")
+	}
+
+	generated, err := p.Generate(configMap("shop"))
+	require.NoError(t, err)
+	require.Len(t, generated, 1)
+	assert.Equal(t, "settings-copy", generated[0].Object.GetName())
+	assert.Equal(t, "shop", generated[0].Object.GetNamespace())
+
+	generated, err = p.Generate(configMap("other"))
+	require.NoError(t, err)
+	assert.Empty(t, generated, "a Policy only sees its own namespace")
+}
+
+const requiredLabels = `
+apiVersion: templates.gatekeeper.sh/v1
+kind: ConstraintTemplate
+metadata:
+  name: k8srequiredlabels
+spec:
+  crd:
+    spec:
+      names:
+        kind: K8sRequiredLabels
+  targets:
+    - target: admission.k8s.gatekeeper.sh
+      rego: |
+        package k8srequiredlabels
+
+        violation[{"msg": "missing"}] { false }
+---
+apiVersion: constraints.gatekeeper.sh/v1beta1
+kind: K8sRequiredLabels
+metadata:
+  name: require-team
+spec:
+  match:
+    kinds:
+      - apiGroups: ["apps"]
+        kinds: ["Deployment"]
+      - apiGroups: [""]
+        kinds: ["*"]
+    excludedNamespaces: ["legacy-*"]
+  parameters:
+    labels: ["team"]
+`
+
+func loadRequiredLabels(t *testing.T) (*ConstraintTemplate, *Constraint) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "require-labels.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(requiredLabels), 0o644))
+	objs, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, objs, 2)
+
+	template, err := ParseConstraintTemplate(Find(objs, "ConstraintTemplate", "k8srequiredlabels"))
+	require.NoError(t, err)
+	constraint, err := ParseConstraint(Find(objs, template.Kind, "require-team"))
+	require.NoError(t, err)
+	return template, constraint
+}
+
+func TestConstraintTemplate(t *testing.T) {
+	template, constraint := loadRequiredLabels(t)
+	assert.Equal(t, "K8sRequiredLabels", template.Kind)
+	assert.Equal(t, "data.k8srequiredlabels.violation", template.Query())
+	assert.Equal(t, "deny", constraint.EnforcementAction)
+
+	_, err := ParseConstraintTemplate(object(t, "apiVersion: templates.gatekeeper.sh/v1\nkind: ConstraintTemplate\nmetadata:\n  name: empty\nspec: {}\n"))
+	assert.ErrorContains(t, err, "has no Rego")
+}
+
+func TestConstraintMatches(t *testing.T) {
+	_, constraint := loadRequiredLabels(t)
+	workload := func(apiVersion, kind, ns string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetName("web")
+		obj.SetNamespace(ns)
+		return obj
+	}
+
+	assert.True(t, constraint.Matches(workload("apps/v1", "Deployment", "shop")))
+	assert.True(t, constraint.Matches(workload("v1", "Service", "shop")), "* matches any kind of the group")
+	assert.False(t, constraint.Matches(workload("apps/v1", "StatefulSet", "shop")))
+	assert.False(t, constraint.Matches(workload("batch/v1", "Job", "shop")))
+	assert.False(t, constraint.Matches(workload("apps/v1", "Deployment", "legacy-shop")), "excludedNamespaces")
+	assert.False(t, constraint.Matches(workload("apps/v1", "Deployment", "kube-system"), "kube-system"), "exempt namespaces")
+
+	constraint.Match.Scope = "Cluster"
+	assert.False(t, constraint.Matches(workload("apps/v1", "Deployment", "shop")))
+	assert.True(t, constraint.Matches(workload("v1", "Namespace", "")))
+}
+
+func TestConstraintInput(t *testing.T) {
+	_, constraint := loadRequiredLabels(t)
+	obj := object(t, "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: shop\n")
+
+	input := constraint.Input(obj)
+	review := input["review"].(map[string]any)
+	assert.Equal(t, map[string]any{"group": "apps", "version": "v1", "kind": "Deployment"}, review["kind"])
+	assert.Equal(t, "shop", review["namespace"])
+	assert.Equal(t, "CREATE", review["operation"])
+	assert.Equal(t, obj.Object, review["object"])
+	assert.Equal(t, map[string]any{"labels": []any{"team"}}, input["parameters"])
+
+	violations, err := DecodeViolations([]any{map[string]any{"msg": "missing", "details": map[string]any{"missing_labels": []any{"team"}}}})
+	require.NoError(t, err)
+	assert.Equal(t, []Violation{{Msg: "missing", Details: map[string]any{"missing_labels": []any{"team"}}}}, violations)
+}
+
+const (
+	kyvernoPolicies    = "../../../platform/security/kyverno/policies/add-network-policy.yaml"
+	gatekeeperPolicies = "../../../platform/security/gatekeeper/templates/require-labels.yaml"
+	gatekeeperValues   = "../../../platform/security/gatekeeper/values.yaml"
+	policyFixtures     = "testdata"
+)
+
+// TestKyvernoDefaultNetworkPolicy applies the add-default-network-policy
+// generate rules to the fixture Namespaces
+func TestKyvernoDefaultNetworkPolicy(t *testing.T) {
+	objs, err := Load(kyvernoPolicies)
+	require.NoError(t, err)
+	clusterPolicy := Find(objs, "ClusterPolicy", "add-default-network-policy")
+	require.NotNil(t, clusterPolicy, "add-default-network-policy not found in %s", kyvernoPolicies)
+	p, err := ParseKyvernoPolicy(clusterPolicy)
+	require.NoError(t, err)
+
+	namespaces, err := Load(filepath.Join(policyFixtures, "namespaces.yaml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, namespaces)
+
+	excluded := map[string]bool{
+		"kube-system":     true,
+		"kube-public":     true,
+		"kube-node-lease": true,
+		"istio-system":    true,
+		"argocd":          true,
+	}
+	policyTypes := map[string]networkingv1.PolicyType{
+		"default-deny-ingress": networkingv1.PolicyTypeIngress,
+		"default-deny-egress":  networkingv1.PolicyTypeEgress,
+	}
+
+	for _, ns := range namespaces {
+		t.Run(ns.GetName(), func(t *testing.T) {
+			generated, err := p.Generate(ns)
+			require.NoError(t, err)
+
+			if excluded[ns.GetName()] {
+				assert.Empty(t, generated, "system namespaces are excluded")
+				return
+			}
+			require.Len(t, generated, len(policyTypes))
+
+			for _, g := range generated {
+				var np networkingv1.NetworkPolicy
+				require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(g.Object.Object, &np))
+
+				assert.Equal(t, "NetworkPolicy", np.Kind)
+				assert.Equal(t, g.Rule, np.Name)
+				assert.Equal(t, ns.GetName(), np.Namespace, "generated into the new namespace")
+				assert.True(t, g.Synchronize, "Kyverno keeps %s in sync", np.Name)
+
+				// An empty pod selector and no rules deny all traffic of the type
+				assert.Empty(t, np.Spec.PodSelector.MatchLabels)
+				assert.Empty(t, np.Spec.PodSelector.MatchExpressions)
+				assert.Equal(t, []networkingv1.PolicyType{policyTypes[g.Rule]}, np.Spec.PolicyTypes)
+				assert.Empty(t, np.Spec.Ingress)
+				assert.Empty(t, np.Spec.Egress)
+			}
+		})
+	}
+}
+
+// TestGatekeeperRequiredLabels evaluates the k8srequiredlabels Rego for the
+// fixture workloads that the require-team-env-labels constraint matches
+func TestGatekeeperRequiredLabels(t *testing.T) {
+	objs, err := Load(gatekeeperPolicies)
+	require.NoError(t, err)
+	template, err := ParseConstraintTemplate(Find(objs, "ConstraintTemplate", "k8srequiredlabels"))
+	require.NoError(t, err)
+	constraintObj := Find(objs, template.Kind, "require-team-env-labels")
+	require.NotNil(t, constraintObj, "require-team-env-labels not found in %s", gatekeeperPolicies)
+	constraint, err := ParseConstraint(constraintObj)
+	require.NoError(t, err)
+
+	compiled, err := template.Compile(context.Background())
+	require.NoError(t, err)
+	exempt := gatekeeperExemptNamespaces(t)
+
+	workloads, err := Load(filepath.Join(policyFixtures, "workloads.yaml"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		kind, name string
+		reviewed   bool
+		// missing are the labels reported as missing, nil if none
+		missing []string
+	}{
+		{kind: "Deployment", name: "demo-app", reviewed: true},
+		{kind: "Deployment", name: "unlabeled", reviewed: true, missing: []string{"app", "environment", "team"}},
+		{kind: "StatefulSet", name: "redis-cart", reviewed: true, missing: []string{"environment"}},
+		{kind: "Service", name: "frontend", reviewed: true, missing: []string{"environment", "team"}},
+		{kind: "ConfigMap", name: "settings"},
+		{kind: "Deployment", name: "coredns"},
+	}
+	require.Len(t, workloads, len(tests), "every fixture has a case")
+
+	for _, tt := range tests {
+		t.Run(tt.kind+"/"+tt.name, func(t *testing.T) {
+			obj := Find(workloads, tt.kind, tt.name)
+			require.NotNil(t, obj, "fixture not found")
+
+			if !tt.reviewed {
+				assert.False(t, constraint.Matches(obj, exempt...), "the constraint should not review %s", tt.name)
+				return
+			}
+			require.True(t, constraint.Matches(obj, exempt...), "the constraint should review %s", tt.name)
+
+			violations, err := compiled.Review(context.Background(), constraint, obj)
+			require.NoError(t, err)
+			if tt.missing == nil {
+				assert.Empty(t, violations)
+				return
+			}
+			require.Len(t, violations, 1)
+			assert.Contains(t, violations[0].Msg, "You must provide labels")
+			assert.Equal(t, tt.missing, missingLabels(violations[0]))
+		})
+	}
+}
+
+func missingLabels(v Violation) []string {
+	var labels []string
+	items, _ := v.Details["missing_labels"].([]any)
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			labels = append(labels, s)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// gatekeeperExemptNamespaces reads the namespaces the chart values exempt
+// from Gatekeeper
+func gatekeeperExemptNamespaces(t *testing.T) []string {
+	t.Helper()
+	data, err := os.ReadFile(gatekeeperValues)
+	require.NoError(t, err)
+
+	var values struct {
+		Gatekeeper struct {
+			ExemptNamespaces []string `json:"exemptNamespaces"`
+		} `json:"gatekeeper"`
+	}
+	require.NoError(t, yaml.Unmarshal(data, &values))
+	require.NotEmpty(t, values.Gatekeeper.ExemptNamespaces)
+	return values.Gatekeeper.ExemptNamespaces
+}
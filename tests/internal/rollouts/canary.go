@@ -0,0 +1,254 @@
+package rollouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/istio"
+)
+
+// Canary drives one Rollout through a canary release and checks the
+// traffic split at every pause step
+type Canary struct {
+	Rollouts *Client
+	// Istio reads the VirtualServices named in the Rollout's traffic
+	// routing. When nil, or when the Rollout does not route through Istio,
+	// only status.canary.weights is checked.
+	Istio     *istio.Client
+	Namespace string
+	Name      string
+	// Logf, when set, receives one line per verified step, e.g. t.Logf
+	Logf func(format string, args ...any)
+}
+
+// StepResult is what the driver observed when the rollout reached a step
+type StepResult struct {
+	Index int32
+	Phase string
+	// Weight is the share of traffic the new revision should receive
+	Weight int32
+	// Routed reports whether a traffic router's weights were checked, as
+	// opposed to a Rollout that splits traffic by replica count only
+	Routed bool
+}
+
+func (s StepResult) String() string {
+	routing := "replica-based split"
+	if s.Routed {
+		routing = "traffic routed"
+	}
+	return fmt.Sprintf("step %d: %s, %d%% to new revision (%s)", s.Index, s.Phase, s.Weight, routing)
+}
+
+// Run starts a canary of image in container and drives it to completion:
+// at every pause step it verifies the traffic split and promotes. It returns
+// a result per pause step plus one for the completed rollout.
+func (c *Canary) Run(ctx context.Context, container, image string) ([]StepResult, error) {
+	ro, err := c.Start(ctx, container, image)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []StepResult
+	for i, step := range ro.Steps() {
+		if step.Pause == nil {
+			continue
+		}
+
+		ro, err = c.WaitForStep(ctx, int32(i))
+		if err != nil {
+			return results, err
+		}
+		res, err := c.Verify(ctx, ro)
+		results = append(results, res)
+		if err != nil {
+			return results, err
+		}
+
+		if ro.Paused() {
+			if err := c.Rollouts.Promote(ctx, c.Namespace, c.Name); err != nil {
+				return results, err
+			}
+		}
+	}
+
+	ro, err = c.WaitForStep(ctx, int32(len(ro.Steps())))
+	if err != nil {
+		return results, err
+	}
+	res, err := c.Verify(ctx, ro)
+	return append(results, res), err
+}
+
+// Start points container at image and waits until the controller has
+// picked up the new revision
+func (c *Canary) Start(ctx context.Context, container, image string) (*Rollout, error) {
+	before, err := c.Rollouts.Get(ctx, c.Namespace, c.Name)
+	if err != nil {
+		return nil, err
+	}
+	if before.ContainerImage(container) == image {
+		return nil, fmt.Errorf("rollout %s/%s already runs %s", c.Namespace, c.Name, image)
+	}
+
+	if err := c.Rollouts.SetImage(ctx, c.Namespace, c.Name, container, image); err != nil {
+		return nil, err
+	}
+
+	return c.until(ctx, "start the new revision", func(ro *Rollout) (bool, error) {
+		return ro.Observed() && ro.Status.CurrentPodHash != "" && ro.Status.CurrentPodHash != before.Status.CurrentPodHash, nil
+	})
+}
+
+// WaitForStep waits until the rollout is paused at step index, or has moved
+// past it. An index of len(steps) waits for the rollout to complete.
+// Aborted and degraded rollouts fail the wait.
+func (c *Canary) WaitForStep(ctx context.Context, index int32) (*Rollout, error) {
+	return c.until(ctx, fmt.Sprintf("reach step %d", index), func(ro *Rollout) (bool, error) {
+		if !ro.Observed() {
+			return false, nil
+		}
+		if ro.Status.Abort || ro.Status.Phase == PhaseDegraded {
+			return false, fmt.Errorf("rollout %s/%s %s at step %d: %s", c.Namespace, c.Name,
+				strings.ToLower(ro.Status.Phase), ro.StepIndex(), ro.Status.Message)
+		}
+
+		steps := ro.Steps()
+		switch current := ro.StepIndex(); {
+		case int(index) >= len(steps):
+			return ro.Completed(), nil
+		case current > index:
+			return true, nil
+		case current == index:
+			return steps[index].Pause == nil || ro.Paused(), nil
+		default:
+			return false, nil
+		}
+	})
+}
+
+// Abort aborts the canary, waits for the controller to shift all traffic
+// back to stable, and verifies the split
+func (c *Canary) Abort(ctx context.Context) (StepResult, error) {
+	if err := c.Rollouts.Abort(ctx, c.Namespace, c.Name); err != nil {
+		return StepResult{}, err
+	}
+
+	ro, err := c.until(ctx, "abort", func(ro *Rollout) (bool, error) {
+		return ro.Status.Abort && ro.Status.Phase == PhaseDegraded, nil
+	})
+	if err != nil {
+		return StepResult{}, err
+	}
+	return c.Verify(ctx, ro)
+}
+
+// Verify checks that status.canary.weights, and the VirtualServices of a
+// Rollout routed through Istio, send the new revision the share of traffic
+// its current step calls for
+func (c *Canary) Verify(ctx context.Context, ro *Rollout) (StepResult, error) {
+	canary := CanaryWeight(ro)
+	res := StepResult{Index: ro.StepIndex(), Phase: ro.Status.Phase, Weight: canary}
+	if ro.Completed() {
+		res.Weight = 100
+	}
+
+	var errs []error
+	if w := ro.Status.Canary.Weights; w != nil {
+		res.Routed = true
+		if w.Canary.Weight != canary {
+			errs = append(errs, fmt.Errorf("rollout %s/%s step %d: status canary weight %d, want %d",
+				ro.Namespace, ro.Name, res.Index, w.Canary.Weight, canary))
+		}
+	}
+
+	if c.Istio != nil {
+		for _, ref := range ro.VirtualServices() {
+			res.Routed = true
+			vs, err := c.Istio.GetVirtualService(ctx, ro.Namespace, ref.Name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			errs = append(errs, VerifyVirtualService(ro, ref, vs, canary))
+		}
+	}
+
+	err := errors.Join(errs...)
+	if c.Logf != nil {
+		c.Logf("rollout %s/%s %s", ro.Namespace, ro.Name, res)
+	}
+	return res, err
+}
+
+// CanaryWeight is the weight the controller should have given the canary
+// service: the step's weight while progressing or paused, and zero once the
+// rollout is aborted or completed, when the stable service takes all
+// traffic
+func CanaryWeight(ro *Rollout) int32 {
+	if ro.Status.Abort || ro.Completed() {
+		return 0
+	}
+	return ro.WeightAt(ro.StepIndex())
+}
+
+// VerifyVirtualService checks that each route ref names in vs sends canary
+// percent of traffic to the Rollout's canary service and the rest to its
+// stable service
+func VerifyVirtualService(ro *Rollout, ref IstioVirtualService, vs *istio.VirtualService, canary int32) error {
+	strategy := ro.Spec.Strategy.Canary
+	if strategy == nil || strategy.CanaryService == "" || strategy.StableService == "" {
+		return fmt.Errorf("rollout %s/%s: Istio traffic routing needs canaryService and stableService", ro.Namespace, ro.Name)
+	}
+
+	routes := map[string]bool{}
+	for _, name := range ref.Routes {
+		routes[name] = true
+	}
+
+	var errs []error
+	checked := 0
+	for i, route := range vs.Spec.HTTP {
+		if len(routes) > 0 && !routes[route.Name] {
+			continue
+		}
+		checked++
+
+		var gotCanary, gotStable int32
+		for host, weight := range istio.Weights(route) {
+			switch {
+			case serviceHost(host, strategy.CanaryService, ro.Namespace):
+				gotCanary += weight
+			case serviceHost(host, strategy.StableService, ro.Namespace):
+				gotStable += weight
+			}
+		}
+		if gotCanary != canary || gotStable != 100-canary {
+			errs = append(errs, fmt.Errorf("VirtualService %s/%s route %s: canary %d stable %d, want %d/%d",
+				vs.Namespace, vs.Name, istio.RouteName(i, route), gotCanary, gotStable, canary, 100-canary))
+		}
+	}
+	if checked == 0 {
+		errs = append(errs, fmt.Errorf("VirtualService %s/%s: no routes named %v", vs.Namespace, vs.Name, ref.Routes))
+	}
+	return errors.Join(errs...)
+}
+
+// serviceHost reports whether a destination host refers to service in
+// namespace, by short name or any qualified form
+func serviceHost(host, service, namespace string) bool {
+	return host == service || host == service+"."+namespace || strings.HasPrefix(host, service+"."+namespace+".")
+}
+
+// until is Client.Until for this canary that names what it was waiting for
+// and the last observed status on timeout
+func (c *Canary) until(ctx context.Context, what string, cond func(*Rollout) (bool, error)) (*Rollout, error) {
+	ro, err := c.Rollouts.Until(ctx, c.Namespace, c.Name, cond)
+	if err != nil && ro != nil && ctx.Err() != nil {
+		return ro, fmt.Errorf("rollout %s/%s did not %s: phase=%s step=%d paused=%t message=%q: %w",
+			c.Namespace, c.Name, what, ro.Status.Phase, ro.StepIndex(), ro.Paused(), ro.Status.Message, err)
+	}
+	return ro, err
+}
@@ -0,0 +1,237 @@
+package rollouts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	watchtools "k8s.io/client-go/tools/watch"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/harness"
+)
+
+// Client drives Rollouts the way the kubectl plugin does, by patching
+// spec and status, and lists the AnalysisRuns they start
+type Client struct {
+	dynamic dynamic.Interface
+}
+
+// NewClient wraps an existing dynamic client
+func NewClient(dyn dynamic.Interface) *Client {
+	return &Client{dynamic: dyn}
+}
+
+// NewForConfig creates a Client for the cluster described by config
+func NewForConfig(config *rest.Config) (*Client, error) {
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+	return NewClient(dyn), nil
+}
+
+// ListKinds maps each resource to its list kind, as required by
+// k8s.io/client-go/dynamic/fake.NewSimpleDynamicClientWithCustomListKinds
+var ListKinds = map[schema.GroupVersionResource]string{
+	RolloutResource:     "RolloutList",
+	AnalysisRunResource: "AnalysisRunList",
+}
+
+// Get fetches one Rollout. API errors are returned unwrapped so callers can
+// use apierrors.IsNotFound.
+func (c *Client) Get(ctx context.Context, namespace, name string) (*Rollout, error) {
+	obj, err := c.dynamic.Resource(RolloutResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return harness.Decode[Rollout](obj)
+}
+
+// SetImage points the named container of the Rollout at image, which
+// starts a new canary. The patch fails if the container moved in between.
+func (c *Client) SetImage(ctx context.Context, namespace, name, container, image string) error {
+	ro, err := c.Get(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	index, err := containerIndex(ro, container)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/spec/template/spec/containers/%d", index)
+	patch, err := json.Marshal([]map[string]any{
+		{"op": "test", "path": path + "/name", "value": container},
+		{"op": "replace", "path": path + "/image", "value": image},
+	})
+	if err != nil {
+		return err
+	}
+	return c.patch(ctx, namespace, name, types.JSONPatchType, patch)
+}
+
+// SetEnv sets the environment variable env of the named container to
+// value, or removes it when value is nil, which starts a new revision like
+// SetImage. It returns the value env had before, nil if it was unset, so
+// the caller can put it back.
+func (c *Client) SetEnv(ctx context.Context, namespace, name, container, env string, value *string) (*string, error) {
+	ro, err := c.Get(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	index, err := containerIndex(ro, container)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/spec/template/spec/containers/%d", index)
+	ops := []map[string]any{{"op": "test", "path": path + "/name", "value": container}}
+	vars := ro.Spec.Template.Spec.Containers[index].Env
+	i := slices.IndexFunc(vars, func(v corev1.EnvVar) bool { return v.Name == env })
+
+	var previous *string
+	switch {
+	case i >= 0 && vars[i].ValueFrom != nil:
+		return nil, fmt.Errorf("rollout %s/%s: %s of container %q is set from a source, not a value", namespace, name, env, container)
+	case i >= 0:
+		previous = &vars[i].Value
+		entry := fmt.Sprintf("%s/env/%d", path, i)
+		ops = append(ops, map[string]any{"op": "test", "path": entry + "/name", "value": env})
+		if value == nil {
+			ops = append(ops, map[string]any{"op": "remove", "path": entry})
+		} else {
+			ops = append(ops, map[string]any{"op": "replace", "path": entry, "value": corev1.EnvVar{Name: env, Value: *value}})
+		}
+	case value == nil:
+		return nil, nil
+	case len(vars) == 0:
+		ops = append(ops, map[string]any{"op": "add", "path": path + "/env", "value": []corev1.EnvVar{{Name: env, Value: *value}}})
+	default:
+		ops = append(ops, map[string]any{"op": "add", "path": path + "/env/-", "value": corev1.EnvVar{Name: env, Value: *value}})
+	}
+
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.patch(ctx, namespace, name, types.JSONPatchType, patch); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+func containerIndex(ro *Rollout, container string) (int, error) {
+	for i, ctr := range ro.Spec.Template.Spec.Containers {
+		if ctr.Name == container {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("rollout %s/%s has no container %q", ro.Namespace, ro.Name, container)
+}
+
+// Promote resumes a Rollout waiting at a pause step, as kubectl argo
+// rollouts promote does
+func (c *Client) Promote(ctx context.Context, namespace, name string) error {
+	if err := c.patch(ctx, namespace, name, types.MergePatchType, []byte(`{"status":{"pauseConditions":null}}`), "status"); err != nil {
+		return err
+	}
+	return c.patch(ctx, namespace, name, types.MergePatchType, []byte(`{"spec":{"paused":false}}`))
+}
+
+// PromoteFull skips the remaining steps and analysis and makes the current
+// revision stable
+func (c *Client) PromoteFull(ctx context.Context, namespace, name string) error {
+	return c.patch(ctx, namespace, name, types.MergePatchType, []byte(`{"status":{"promoteFull":true}}`), "status")
+}
+
+// Abort sends all traffic back to the stable revision and scales the
+// canary down
+func (c *Client) Abort(ctx context.Context, namespace, name string) error {
+	return c.patch(ctx, namespace, name, types.MergePatchType, []byte(`{"status":{"abort":true}}`), "status")
+}
+
+// Retry restarts an aborted canary from the first step
+func (c *Client) Retry(ctx context.Context, namespace, name string) error {
+	return c.patch(ctx, namespace, name, types.MergePatchType, []byte(`{"status":{"abort":false}}`), "status")
+}
+
+func (c *Client) patch(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, subresources ...string) error {
+	_, err := c.dynamic.Resource(RolloutResource).Namespace(namespace).Patch(ctx, name, pt, data, metav1.PatchOptions{}, subresources...)
+	if err != nil {
+		return fmt.Errorf("patching rollout %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// Until watches the Rollout until cond returns true or an error, and
+// returns the last Rollout observed. When ctx ends first,
+// wait.Interrupted reports true for the error.
+func (c *Client) Until(ctx context.Context, namespace, name string, cond func(*Rollout) (bool, error)) (*Rollout, error) {
+	resource := c.dynamic.Resource(RolloutResource).Namespace(namespace)
+	lw := harness.ListWatchFor(resource.List, resource.Watch, harness.ByName(name))
+
+	var last *Rollout
+	_, err := watchtools.UntilWithSync(ctx, lw, &unstructured.Unstructured{}, nil, func(event watch.Event) (bool, error) {
+		obj, ok := event.Object.(*unstructured.Unstructured)
+		if !ok || obj.GetName() != name {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("rollout %s/%s was deleted", namespace, name)
+		}
+
+		ro, err := harness.Decode[Rollout](obj)
+		if err != nil {
+			return false, err
+		}
+		last = ro
+		return cond(ro)
+	})
+	if err != nil && wait.Interrupted(err) && last == nil {
+		return nil, fmt.Errorf("rollout %s/%s not found: %w", namespace, name, err)
+	}
+	return last, err
+}
+
+// AnalysisRuns returns the AnalysisRuns the Rollout started for revision
+// podHash
+func (c *Client) AnalysisRuns(ctx context.Context, namespace string, ro *Rollout, podHash string) ([]AnalysisRun, error) {
+	objs, err := c.dynamic.Resource(AnalysisRunResource).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: PodTemplateHashLabel + "=" + podHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []AnalysisRun
+	for i := range objs.Items {
+		if !ownedBy(&objs.Items[i], ro) {
+			continue
+		}
+		run, err := harness.Decode[AnalysisRun](&objs.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, nil
+}
+
+func ownedBy(obj *unstructured.Unstructured, ro *Rollout) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind == "Rollout" && ref.Name == ro.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,425 @@
+package rollouts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tests/internal/istio"
+)
+
+// The demo-app Rollout with Istio host-level traffic splitting
+const rolloutYAML = `
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: demo-app
+  namespace: demo
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: demo-app
+          image: ghcr.io/example/demo-app:1.0.0
+  strategy:
+    canary:
+      canaryService: demo-app-canary
+      stableService: demo-app-stable
+      trafficRouting:
+        istio:
+          virtualService:
+            name: demo-app
+            routes:
+              - primary
+      steps:
+        - setWeight: 20
+        - pause: {}
+        - setWeight: 40
+        - pause: {duration: 60s}
+`
+
+const virtualServiceYAML = `
+apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: demo-app
+  namespace: demo
+spec:
+  hosts:
+    - demo-app.lab.local
+  http:
+    - name: primary
+      route:
+        - destination:
+            host: demo-app-stable.demo.svc.cluster.local
+          weight: 100
+        - destination:
+            host: demo-app-canary.demo.svc.cluster.local
+          weight: 0
+`
+
+const (
+	oldImage = "ghcr.io/example/demo-app:1.0.0"
+	newImage = "ghcr.io/example/demo-app:1.1.0"
+)
+
+func decodeYAML(t *testing.T, doc string) *unstructured.Unstructured {
+	t.Helper()
+	obj := &unstructured.Unstructured{}
+	require.NoError(t, yaml.Unmarshal([]byte(doc), &obj.Object))
+	return obj
+}
+
+// newFakeCluster returns a dynamic client holding the Rollout, already
+// stable on oldImage, and its VirtualService, with a fakeController
+// reconciling them until the test ends
+func newFakeCluster(t *testing.T, mutate func(*unstructured.Unstructured)) dynamic.Interface {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	listKinds := map[schema.GroupVersionResource]string{istio.VirtualServiceResource: "VirtualServiceList"}
+	for gvr, kind := range ListKinds {
+		listKinds[gvr] = kind
+	}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds)
+
+	// The fake ignores resourceVersion, so a change landing between an
+	// informer's list and its watch would be lost. Replay the current
+	// Rollout to every new watch, as a real API server's watch from the
+	// listed version would deliver it.
+	dyn.PrependWatchReactor("rollouts", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		w, err := dyn.Tracker().Watch(RolloutResource, action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		if obj, err := dyn.Tracker().Get(RolloutResource, action.GetNamespace(), "demo-app"); err == nil {
+			w.(*watch.RaceFreeFakeWatcher).Modify(obj)
+		}
+		return true, w, nil
+	})
+
+	ro := decodeYAML(t, rolloutYAML)
+	if mutate != nil {
+		mutate(ro)
+	}
+	hash := podHash(oldImage)
+	steps, _, _ := unstructured.NestedSlice(ro.Object, "spec", "strategy", "canary", "steps")
+	require.NoError(t, unstructured.SetNestedField(ro.Object, map[string]any{
+		"phase":              PhaseHealthy,
+		"observedGeneration": "0",
+		"currentPodHash":     hash,
+		"stableRS":           hash,
+		"currentStepIndex":   int64(len(steps)),
+	}, "status"))
+
+	_, err := dyn.Resource(RolloutResource).Namespace("demo").Create(ctx, ro, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = dyn.Resource(istio.VirtualServiceResource).Namespace("demo").Create(ctx, decodeYAML(t, virtualServiceYAML), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// Watch before returning so no change the test makes is missed
+	w, err := dyn.Resource(RolloutResource).Namespace("demo").Watch(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	controller := &fakeController{dyn: dyn, paused: map[int32]bool{}}
+	go controller.run(ctx, t, w)
+	return dyn
+}
+
+func newCanary(t *testing.T, dyn dynamic.Interface) *Canary {
+	return &Canary{
+		Rollouts:  NewClient(dyn),
+		Istio:     istio.NewClient(dyn),
+		Namespace: "demo",
+		Name:      "demo-app",
+		Logf:      t.Logf,
+	}
+}
+
+func TestCanaryRun(t *testing.T) {
+	dyn := newFakeCluster(t, nil)
+	canary := newCanary(t, dyn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	results, err := canary.Run(ctx, "demo-app", newImage)
+	require.NoError(t, err)
+
+	var weights []int32
+	for _, res := range results {
+		assert.True(t, res.Routed, "%s", res)
+		weights = append(weights, res.Weight)
+	}
+	assert.Equal(t, []int32{20, 40, 100}, weights)
+
+	ro, err := canary.Rollouts.Get(ctx, "demo", "demo-app")
+	require.NoError(t, err)
+	assert.Equal(t, newImage, ro.ContainerImage("demo-app"))
+	assert.Equal(t, podHash(newImage), ro.Status.StableRS)
+
+	_, err = canary.Start(ctx, "demo-app", newImage)
+	assert.ErrorContains(t, err, "already runs")
+}
+
+func TestCanaryAbort(t *testing.T) {
+	dyn := newFakeCluster(t, nil)
+	canary := newCanary(t, dyn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := canary.Start(ctx, "demo-app", newImage)
+	require.NoError(t, err)
+
+	ro, err := canary.WaitForStep(ctx, 1)
+	require.NoError(t, err)
+	res, err := canary.Verify(ctx, ro)
+	require.NoError(t, err)
+	assert.Equal(t, int32(20), res.Weight)
+
+	res, err = canary.Abort(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), res.Weight)
+	assert.Equal(t, PhaseDegraded, res.Phase)
+
+	_, err = canary.WaitForStep(ctx, 3)
+	assert.ErrorContains(t, err, "degraded at step 1")
+}
+
+func TestCanaryWithoutTrafficRouting(t *testing.T) {
+	dyn := newFakeCluster(t, func(ro *unstructured.Unstructured) {
+		unstructured.RemoveNestedField(ro.Object, "spec", "strategy", "canary", "trafficRouting")
+	})
+	canary := newCanary(t, dyn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	results, err := canary.Run(ctx, "demo-app", newImage)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, res := range results {
+		assert.False(t, res.Routed, "%s", res)
+	}
+}
+
+func TestCanaryReportsWrongWeights(t *testing.T) {
+	dyn := newFakeCluster(t, nil)
+	canary := newCanary(t, dyn)
+	ctx := context.Background()
+
+	ro, err := canary.Rollouts.Get(ctx, "demo", "demo-app")
+	require.NoError(t, err)
+	vs, err := canary.Istio.GetVirtualService(ctx, "demo", "demo-app")
+	require.NoError(t, err)
+	ref := ro.VirtualServices()[0]
+
+	assert.NoError(t, VerifyVirtualService(ro, ref, vs, 0))
+	assert.ErrorContains(t, VerifyVirtualService(ro, ref, vs, 20), "route primary: canary 0 stable 100, want 20/80")
+
+	ref.Routes = []string{"secondary"}
+	assert.ErrorContains(t, VerifyVirtualService(ro, ref, vs, 0), "no routes named [secondary]")
+}
+
+func TestWeightAt(t *testing.T) {
+	ro := &Rollout{}
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(decodeYAML(t, rolloutYAML).Object, ro))
+
+	want := []int32{20, 20, 40, 40, 100}
+	for i, w := range want {
+		assert.Equal(t, w, ro.WeightAt(int32(i)), "step %d", i)
+	}
+	assert.Equal(t, int32(-1), ro.StepIndex())
+}
+
+func TestSetEnv(t *testing.T) {
+	ctx := context.Background()
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), ListKinds, decodeYAML(t, rolloutYAML))
+	client := NewClient(dyn)
+	set := func(env string, value *string) *string {
+		t.Helper()
+		previous, err := client.SetEnv(ctx, "demo", "demo-app", "demo-app", env, value)
+		require.NoError(t, err)
+		return previous
+	}
+	envOf := func(env string) (string, bool) {
+		t.Helper()
+		ro, err := client.Get(ctx, "demo", "demo-app")
+		require.NoError(t, err)
+		return ro.ContainerEnv("demo-app", env)
+	}
+	on, off := "on", "off"
+
+	assert.Nil(t, set("FAULT_INJECTION", &on), "the container had no env")
+	value, ok := envOf("FAULT_INJECTION")
+	assert.True(t, ok)
+	assert.Equal(t, "on", value)
+
+	assert.Nil(t, set("LOG_LEVEL", &off))
+	assert.Equal(t, &on, set("FAULT_INJECTION", &off))
+	value, _ = envOf("FAULT_INJECTION")
+	assert.Equal(t, "off", value)
+
+	assert.Equal(t, &off, set("FAULT_INJECTION", nil))
+	_, ok = envOf("FAULT_INJECTION")
+	assert.False(t, ok, "nil removes the variable")
+	_, ok = envOf("LOG_LEVEL")
+	assert.True(t, ok)
+	assert.Nil(t, set("FAULT_INJECTION", nil), "removing an unset variable does nothing")
+
+	_, err := client.SetEnv(ctx, "demo", "demo-app", "sidecar", "FAULT_INJECTION", &on)
+	assert.ErrorContains(t, err, `no container "sidecar"`)
+}
+
+// fakeController plays the Argo Rollouts controller: it starts a new
+// revision when the image changes, walks the canary steps, pauses at pause
+// steps until promoted, and writes the weights to the Rollout status and
+// the VirtualService routes
+type fakeController struct {
+	dyn    dynamic.Interface
+	paused map[int32]bool // pause steps already entered for this revision
+}
+
+func (f *fakeController) run(ctx context.Context, t *testing.T, w watch.Interface) {
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+			if err := f.reconcile(ctx); err != nil && ctx.Err() == nil {
+				t.Errorf("reconciling rollout: %v", err)
+			}
+		}
+	}
+}
+
+// reconcile works from the latest object rather than the event, which may
+// predate status the controller already wrote
+func (f *fakeController) reconcile(ctx context.Context) error {
+	ro, err := NewClient(f.dyn).Get(ctx, "demo", "demo-app")
+	if err != nil {
+		return err
+	}
+	status := ro.Status
+	steps := ro.Steps()
+
+	if hash := podHash(ro.ContainerImage("")); status.CurrentPodHash != hash {
+		status = RolloutStatus{CurrentPodHash: hash, StableRS: status.StableRS, CurrentStepIndex: new(int32)}
+		f.paused = map[int32]bool{}
+	}
+
+	var index int32
+	if status.CurrentStepIndex != nil {
+		index = *status.CurrentStepIndex
+	}
+	canary := int32(0)
+	switch {
+	case status.Abort:
+		status.Phase = PhaseDegraded
+		status.Message = "RolloutAborted: Rollout aborted update to revision " + status.CurrentPodHash
+	default:
+		for int(index) < len(steps) {
+			if steps[index].Pause != nil {
+				if !f.paused[index] {
+					f.paused[index] = true
+					status.PauseConditions = []PauseCondition{{Reason: "CanaryPauseStep", StartTime: metav1.Now()}}
+				}
+				if len(status.PauseConditions) > 0 {
+					break
+				}
+			}
+			index++
+		}
+
+		status.Phase = PhaseProgressing
+		if len(status.PauseConditions) > 0 {
+			status.Phase = PhasePaused
+		}
+		if int(index) == len(steps) {
+			status.Phase = PhaseHealthy
+			status.StableRS = status.CurrentPodHash
+		} else {
+			canary = ro.WeightAt(index)
+		}
+	}
+	status.CurrentStepIndex = &index
+	status.ObservedGeneration = strconv.FormatInt(ro.Generation, 10)
+	if strategy := ro.Spec.Strategy.Canary; strategy.TrafficRouting != nil {
+		status.Canary.Weights = &TrafficWeights{
+			Canary: WeightDestination{Weight: canary, ServiceName: strategy.CanaryService, PodTemplateHash: status.CurrentPodHash},
+			Stable: WeightDestination{Weight: 100 - canary, ServiceName: strategy.StableService, PodTemplateHash: status.StableRS},
+		}
+		if err := f.setVirtualServiceWeights(ctx, canary); err != nil {
+			return err
+		}
+	}
+
+	if reflect.DeepEqual(status, ro.Status) {
+		return nil
+	}
+	// Replace only the status, so a concurrent spec patch is not undone
+	patch, err := json.Marshal([]map[string]any{{"op": "replace", "path": "/status", "value": status}})
+	if err != nil {
+		return err
+	}
+	_, err = f.dyn.Resource(RolloutResource).Namespace("demo").Patch(ctx, "demo-app", types.JSONPatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+func (f *fakeController) setVirtualServiceWeights(ctx context.Context, canary int32) error {
+	vs, err := f.dyn.Resource(istio.VirtualServiceResource).Namespace("demo").Get(ctx, "demo-app", metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	routes, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+	for _, r := range routes {
+		dests := r.(map[string]any)["route"].([]any)
+		for _, d := range dests {
+			dest := d.(map[string]any)
+			host := dest["destination"].(map[string]any)["host"].(string)
+			if strings.HasPrefix(host, "demo-app-canary.") {
+				dest["weight"] = int64(canary)
+			} else {
+				dest["weight"] = int64(100 - canary)
+			}
+		}
+	}
+	if err := unstructured.SetNestedSlice(vs.Object, routes, "spec", "http"); err != nil {
+		return err
+	}
+	_, err = f.dyn.Resource(istio.VirtualServiceResource).Namespace("demo").Update(ctx, vs, metav1.UpdateOptions{})
+	return err
+}
+
+func podHash(image string) string {
+	h := fnv.New32a()
+	h.Write([]byte(image))
+	return fmt.Sprintf("%x", h.Sum32())
+}
@@ -0,0 +1,240 @@
+// Package rollouts drives Argo Rollouts canaries through the Kubernetes
+// dynamic client: it patches the Rollout image or environment, follows
+// status.currentStepIndex and the canary traffic weights step by step,
+// promotes or aborts, and checks the Istio VirtualService weights the
+// controller writes at each step.
+//
+// Only the subset of argoproj.io/v1alpha1 the platform tests assert on is
+// modelled; unknown fields are ignored when decoding.
+package rollouts
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Resources installed by the Argo Rollouts controller
+var (
+	RolloutResource     = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+	AnalysisRunResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "analysisruns"}
+)
+
+// PodTemplateHashLabel ties ReplicaSets and AnalysisRuns to a revision
+const PodTemplateHashLabel = "rollouts-pod-template-hash"
+
+// Rollout phases reported in status.phase
+const (
+	PhaseHealthy     = "Healthy"
+	PhaseProgressing = "Progressing"
+	PhasePaused      = "Paused"
+	PhaseDegraded    = "Degraded"
+)
+
+// AnalysisRun phases reported in status.phase
+const (
+	AnalysisPending      = "Pending"
+	AnalysisRunning      = "Running"
+	AnalysisSuccessful   = "Successful"
+	AnalysisFailed       = "Failed"
+	AnalysisError        = "Error"
+	AnalysisInconclusive = "Inconclusive"
+)
+
+// Rollout is argoproj.io/v1alpha1 Rollout
+type Rollout struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              RolloutSpec   `json:"spec"`
+	Status            RolloutStatus `json:"status,omitempty"`
+}
+
+type RolloutSpec struct {
+	Replicas *int32                 `json:"replicas,omitempty"`
+	Paused   bool                   `json:"paused,omitempty"`
+	Template corev1.PodTemplateSpec `json:"template"`
+	Strategy RolloutStrategy        `json:"strategy"`
+}
+
+type RolloutStrategy struct {
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+}
+
+type CanaryStrategy struct {
+	CanaryService  string          `json:"canaryService,omitempty"`
+	StableService  string          `json:"stableService,omitempty"`
+	Steps          []CanaryStep    `json:"steps,omitempty"`
+	TrafficRouting *TrafficRouting `json:"trafficRouting,omitempty"`
+}
+
+// CanaryStep is one entry of spec.strategy.canary.steps. Only one field is
+// set per step.
+type CanaryStep struct {
+	SetWeight *int32        `json:"setWeight,omitempty"`
+	Pause     *RolloutPause `json:"pause,omitempty"`
+}
+
+// RolloutPause without a duration waits for a manual promotion
+type RolloutPause struct {
+	Duration *intstr.IntOrString `json:"duration,omitempty"`
+}
+
+type TrafficRouting struct {
+	Istio *IstioTrafficRouting `json:"istio,omitempty"`
+}
+
+type IstioTrafficRouting struct {
+	VirtualService  *IstioVirtualService  `json:"virtualService,omitempty"`
+	VirtualServices []IstioVirtualService `json:"virtualServices,omitempty"`
+}
+
+// IstioVirtualService names a VirtualService in the Rollout's namespace and
+// the HTTP routes in it the controller rewrites; no routes means the only one
+type IstioVirtualService struct {
+	Name   string   `json:"name"`
+	Routes []string `json:"routes,omitempty"`
+}
+
+type RolloutStatus struct {
+	Phase              string           `json:"phase,omitempty"`
+	Message            string           `json:"message,omitempty"`
+	ObservedGeneration string           `json:"observedGeneration,omitempty"`
+	CurrentStepIndex   *int32           `json:"currentStepIndex,omitempty"`
+	CurrentPodHash     string           `json:"currentPodHash,omitempty"`
+	StableRS           string           `json:"stableRS,omitempty"`
+	Abort              bool             `json:"abort,omitempty"`
+	PauseConditions    []PauseCondition `json:"pauseConditions,omitempty"`
+	Canary             CanaryStatus     `json:"canary,omitempty"`
+}
+
+type PauseCondition struct {
+	Reason    string      `json:"reason"`
+	StartTime metav1.Time `json:"startTime"`
+}
+
+type CanaryStatus struct {
+	Weights *TrafficWeights `json:"weights,omitempty"`
+}
+
+// TrafficWeights is what the controller last wrote to the traffic router
+type TrafficWeights struct {
+	Canary WeightDestination `json:"canary"`
+	Stable WeightDestination `json:"stable"`
+}
+
+type WeightDestination struct {
+	Weight          int32  `json:"weight"`
+	ServiceName     string `json:"serviceName,omitempty"`
+	PodTemplateHash string `json:"podTemplateHash,omitempty"`
+}
+
+// AnalysisRun is argoproj.io/v1alpha1 AnalysisRun
+type AnalysisRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Status            AnalysisRunStatus `json:"status,omitempty"`
+}
+
+type AnalysisRunStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Steps returns the canary steps, or nil for other strategies
+func (r *Rollout) Steps() []CanaryStep {
+	if r.Spec.Strategy.Canary == nil {
+		return nil
+	}
+	return r.Spec.Strategy.Canary.Steps
+}
+
+// StepIndex returns status.currentStepIndex, or -1 before the controller
+// has set it
+func (r *Rollout) StepIndex() int32 {
+	if r.Status.CurrentStepIndex == nil {
+		return -1
+	}
+	return *r.Status.CurrentStepIndex
+}
+
+// WeightAt returns the share of traffic the new revision should receive at
+// step index, following the controller: the last setWeight at or before
+// index, and 100 once every step has completed
+func (r *Rollout) WeightAt(index int32) int32 {
+	steps := r.Steps()
+	if int(index) >= len(steps) {
+		return 100
+	}
+	for i := index; i >= 0; i-- {
+		if w := steps[i].SetWeight; w != nil {
+			return *w
+		}
+	}
+	return 0
+}
+
+// Observed reports whether the status describes the current spec
+func (r *Rollout) Observed() bool {
+	return r.Status.ObservedGeneration == strconv.FormatInt(r.Generation, 10)
+}
+
+// Paused reports whether the rollout is waiting at a pause step
+func (r *Rollout) Paused() bool {
+	return r.Spec.Paused || len(r.Status.PauseConditions) > 0
+}
+
+// Completed reports whether the current revision has been fully promoted
+// and is healthy
+func (r *Rollout) Completed() bool {
+	return r.Observed() &&
+		r.Status.Phase == PhaseHealthy &&
+		r.Status.CurrentPodHash != "" &&
+		r.Status.StableRS == r.Status.CurrentPodHash &&
+		int(r.StepIndex()) >= len(r.Steps())
+}
+
+// ContainerImage returns the image of the named container, or of the first
+// container when name is empty
+func (r *Rollout) ContainerImage(name string) string {
+	for _, c := range r.Spec.Template.Spec.Containers {
+		if name == "" || c.Name == name {
+			return c.Image
+		}
+	}
+	return ""
+}
+
+// ContainerEnv returns the value of the environment variable env of the
+// named container, and whether it is set
+func (r *Rollout) ContainerEnv(container, env string) (string, bool) {
+	for _, c := range r.Spec.Template.Spec.Containers {
+		if c.Name != container {
+			continue
+		}
+		for _, v := range c.Env {
+			if v.Name == env {
+				return v.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// VirtualServices returns the VirtualServices whose weights the controller
+// manages for this Rollout
+func (r *Rollout) VirtualServices() []IstioVirtualService {
+	canary := r.Spec.Strategy.Canary
+	if canary == nil || canary.TrafficRouting == nil || canary.TrafficRouting.Istio == nil {
+		return nil
+	}
+
+	istio := canary.TrafficRouting.Istio
+	refs := append([]IstioVirtualService{}, istio.VirtualServices...)
+	if istio.VirtualService != nil {
+		refs = append(refs, *istio.VirtualService)
+	}
+	return refs
+}
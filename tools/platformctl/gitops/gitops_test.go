@@ -0,0 +1,443 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const repoURL = "git@github.com:fsongt-ext/kubernetes-extreme-lab.git"
+
+// application renders an Application manifest; extra is appended to spec
+func application(name, project, wave, path, namespace, extra string) string {
+	return `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: ` + name + `
+  namespace: argocd
+  annotations:
+    argocd.argoproj.io/sync-wave: "` + wave + `"
+spec:
+  project: ` + project + `
+  source:
+    repoURL: ` + repoURL + `
+    targetRevision: main
+    path: ` + path + `
+` + extra + `  destination:
+    server: https://kubernetes.default.svc
+    namespace: ` + namespace + `
+`
+}
+
+const platformProject = `apiVersion: argoproj.io/v1alpha1
+kind: AppProject
+metadata:
+  name: platform
+  namespace: argocd
+spec:
+  sourceRepos:
+    - 'git@github.com:fsongt-ext/kubernetes-extreme-lab.git'
+    - 'https://charts.jetstack.io'
+  destinations:
+    - namespace: 'argocd'
+      server: https://kubernetes.default.svc
+    - namespace: 'istio-*'
+      server: https://kubernetes.default.svc
+`
+
+const helmValues = "    helm:\n      valueFiles:\n        - values.yaml\n"
+
+// labRepo is a small copy of the repository layout that lints clean
+func labRepo() map[string]string {
+	return map[string]string{
+		"gitops/bootstrap/repository.yaml": `apiVersion: v1
+kind: Secret
+metadata:
+  name: github-repo-ssh
+  namespace: argocd
+  labels:
+    argocd.argoproj.io/secret-type: repository
+stringData:
+  url: ` + repoURL + "\n",
+		"gitops/bootstrap/root-application.yaml": application("root", "default", "-1", "gitops/bootstrap", "argocd",
+			"    directory:\n      include: '{projects.yaml,platform-apps.yaml}'\n"),
+		"gitops/bootstrap/projects.yaml":                     application("argocd-projects", "default", "-2", "gitops/projects", "argocd", ""),
+		"gitops/bootstrap/platform-apps.yaml":                application("platform-apps", "platform", "0", "gitops/environments/lab/platform", "argocd", "    directory:\n      recurse: true\n      include: '*.yaml'\n"),
+		"gitops/projects/platform-project.yaml":              "---\n" + platformProject,
+		"gitops/environments/lab/platform/istio-base.yaml":   application("istio-base", "platform", "2", "platform/networking/istio/base", "istio-system", ""),
+		"gitops/environments/lab/platform/istio/istiod.yaml": application("istiod", "platform", "3", "platform/networking/istio/istiod", "istio-system", helmValues),
+		"platform/networking/istio/base/Chart.yaml":          "apiVersion: v2\nname: base\n",
+		"platform/networking/istio/istiod/Chart.yaml":        "apiVersion: v2\nname: istiod\n",
+		"platform/networking/istio/istiod/values.yaml":       "{}\n",
+	}
+}
+
+func writeRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	return root
+}
+
+func lint(t *testing.T, files map[string]string) []string {
+	t.Helper()
+	tree, err := Load(writeRepo(t, files))
+	require.NoError(t, err)
+
+	var out []string
+	for _, d := range Lint(tree, DefaultDependencies) {
+		out = append(out, d.String())
+	}
+	return out
+}
+
+func TestLoadLinksApplications(t *testing.T) {
+	tree, err := Load(writeRepo(t, labRepo()))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{repoURL}, tree.RepoURLs)
+	require.Len(t, tree.Roots(), 1)
+	root := tree.Roots()[0]
+	assert.Equal(t, "root", root.Name())
+
+	var children []string
+	for _, c := range root.Children {
+		children = append(children, c.Name())
+	}
+	assert.Equal(t, []string{"argocd-projects", "platform-apps"}, children, "children sorted by wave, filtered by include")
+
+	istiod := tree.Application("istiod")
+	require.NotNil(t, istiod)
+	assert.Equal(t, "platform-apps", istiod.Parent.Name(), "recurse: true reaches subdirectories")
+	assert.Equal(t, 3, istiod.SyncWave())
+	assert.Equal(t, Pos{File: "gitops/environments/lab/platform/istio/istiod.yaml", Line: 13}, istiod.Pos("spec", "source", "path"))
+
+	assert.Equal(t, "argocd-projects", tree.Project("platform").DeployedBy.Name())
+}
+
+func TestLintClean(t *testing.T) {
+	assert.Empty(t, lint(t, labRepo()))
+}
+
+func TestLintFindings(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(files map[string]string)
+		want   []string
+	}{
+		{
+			name: "MissingSourcePath",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/grafana.yaml"] = application("grafana", "platform", "5", "helm/grafana", "argocd", helmValues)
+			},
+			want: []string{"gitops/environments/lab/platform/grafana.yaml:13: source path helm/grafana does not exist (source-path)"},
+		},
+		{
+			name: "MissingValueFile",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/istio/istiod.yaml"] = application("istiod", "platform", "3", "platform/networking/istio/istiod", "istio-system",
+					"    helm:\n      valueFiles:\n        - values.yaml\n        - values-lab.yaml\n")
+			},
+			want: []string{"gitops/environments/lab/platform/istio/istiod.yaml:17: value file platform/networking/istio/istiod/values-lab.yaml does not exist (value-file)"},
+		},
+		{
+			name: "IgnoredMissingValueFile",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/istio/istiod.yaml"] = application("istiod", "platform", "3", "platform/networking/istio/istiod", "istio-system",
+					"    helm:\n      ignoreMissingValueFiles: true\n      valueFiles:\n        - values-lab.yaml\n")
+			},
+		},
+		{
+			name: "EmptyDirectorySource",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/policies.yaml"] = application("policies", "platform", "4", "platform/networking", "argocd", "")
+			},
+			want: []string{"gitops/environments/lab/platform/policies.yaml:13: source path platform/networking has no manifests to sync (source-path)"},
+		},
+		{
+			name: "DestinationNotAllowed",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/kong.yaml"] = application("kong", "platform", "3", "platform/networking/istio/istiod", "kong", helmValues)
+			},
+			want: []string{`gitops/environments/lab/platform/kong.yaml:19: destination namespace "kong" is not allowed by AppProject platform at gitops/projects/platform-project.yaml:12 (destination)`},
+		},
+		{
+			name: "SourceRepoNotAllowed",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/kyverno.yaml"] = strings.Replace(
+					application("kyverno", "platform", "4", "", "argocd", ""),
+					"repoURL: "+repoURL, "repoURL: https://kyverno.github.io/kyverno\n    chart: kyverno", 1)
+			},
+			want: []string{"gitops/environments/lab/platform/kyverno.yaml:11: repository https://kyverno.github.io/kyverno is not in the sourceRepos of AppProject platform (source-repo)"},
+		},
+		{
+			name: "UnknownProject",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/istio-base.yaml"] = application("istio-base", "networking", "2", "platform/networking/istio/base", "istio-system", "")
+			},
+			want: []string{"gitops/environments/lab/platform/istio-base.yaml:9: AppProject networking is not defined (project)"},
+		},
+		{
+			name: "DuplicateNames",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/istio/istio-base.yaml"] = application("istio-base", "platform", "2", "platform/networking/istio/base", "istio-system", "")
+				f["gitops/projects/platform-project-copy.yaml"] = platformProject
+			},
+			want: []string{
+				"gitops/environments/lab/platform/istio-base.yaml:4: Application istio-base is already defined at gitops/environments/lab/platform/istio/istio-base.yaml:4 (duplicate-name)",
+				"gitops/projects/platform-project.yaml:5: AppProject platform is already defined at gitops/projects/platform-project-copy.yaml:4 (duplicate-name)",
+			},
+		},
+		{
+			name: "DependencyInSameWave",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/istio/istiod.yaml"] = application("istiod", "platform", "2", "platform/networking/istio/istiod", "istio-system", helmValues)
+			},
+			want: []string{"gitops/environments/lab/platform/istio/istiod.yaml:7: istiod (wave 2) must sync after istio-base (wave 2) (sync-wave)"},
+		},
+		{
+			name: "DependencyUnderEarlierParent",
+			change: func(f map[string]string) {
+				// istiod moves to an app of apps that syncs before platform-apps
+				delete(f, "gitops/environments/lab/platform/istio/istiod.yaml")
+				f["gitops/bootstrap/root-application.yaml"] = application("root", "default", "-1", "gitops/bootstrap", "argocd",
+					"    directory:\n      include: '{projects.yaml,platform-apps.yaml,mesh-apps.yaml}'\n")
+				f["gitops/bootstrap/mesh-apps.yaml"] = application("mesh-apps", "platform", "-1", "gitops/environments/lab/mesh", "argocd", "")
+				f["gitops/environments/lab/mesh/istiod.yaml"] = application("istiod", "platform", "3", "platform/networking/istio/istiod", "istio-system", helmValues)
+			},
+			want: []string{"gitops/bootstrap/mesh-apps.yaml:7: istiod must sync after istio-base, but mesh-apps (wave -1) does not sync after platform-apps (wave 0) (sync-wave)"},
+		},
+		{
+			name: "ProjectDeployedTooLate",
+			change: func(f map[string]string) {
+				f["gitops/bootstrap/projects.yaml"] = application("argocd-projects", "default", "1", "gitops/projects", "argocd", "")
+			},
+			// Reported once, not again for every Application under platform-apps
+			want: []string{"gitops/bootstrap/platform-apps.yaml:7: platform-apps (wave 0) must sync after argocd-projects (wave 1) (it deploys AppProject platform) (sync-wave)"},
+		},
+		{
+			name: "MissingDependency",
+			change: func(f map[string]string) {
+				delete(f, "gitops/environments/lab/platform/istio-base.yaml")
+			},
+			want: []string{"gitops/environments/lab/platform/istio/istiod.yaml:4: istiod depends on istio-base, which no Application deploys (sync-wave)"},
+		},
+		{
+			name: "InvalidSyncWave",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/istio-base.yaml"] = application("istio-base", "platform", "early", "platform/networking/istio/base", "istio-system", "")
+			},
+			want: []string{`gitops/environments/lab/platform/istio-base.yaml:7: sync wave "early" is not an integer (sync-wave)`},
+		},
+		{
+			name: "InvalidYAML",
+			change: func(f map[string]string) {
+				f["gitops/environments/lab/platform/broken.yaml"] = "apiVersion: argoproj.io/v1alpha1\nkind: Application\nmetadata:\n  name: [broken\n"
+			},
+			want: []string{"gitops/environments/lab/platform/broken.yaml:3: yaml: line 3: did not find expected ',' or ']' (parse)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := labRepo()
+			tt.change(files)
+			assert.Equal(t, tt.want, lint(t, files))
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tree, err := Load(writeRepo(t, labRepo()))
+	require.NoError(t, err)
+	app := tree.Application
+
+	assert.Equal(t, Before, Order(app("istio-base"), app("istiod")))
+	assert.Equal(t, After, Order(app("istiod"), app("argocd-projects")), "ordered by their ancestors' waves")
+	assert.Equal(t, Before, Order(app("root"), app("istiod")), "a parent syncs before what it creates")
+	assert.Equal(t, Unordered, Order(app("istiod"), app("istiod")))
+}
+
+func TestSimulate(t *testing.T) {
+	tree, err := Load(writeRepo(t, labRepo()))
+	require.NoError(t, err)
+
+	steps, unscheduled := Simulate(tree)
+	var got []string
+	for _, step := range steps {
+		parent := ""
+		if step.Parent != nil {
+			parent = step.Parent.Name()
+		}
+		got = append(got, fmt.Sprintf("%s/%d: %s", parent, step.Wave, strings.Join(names(step.Apps), ",")))
+	}
+	assert.Equal(t, []string{
+		"/-1: root",
+		"root/-2: argocd-projects",
+		"root/0: platform-apps",
+		"platform-apps/2: istio-base",
+		"platform-apps/3: istiod",
+	}, got)
+	assert.Empty(t, unscheduled)
+}
+
+func TestGraphProblems(t *testing.T) {
+	t.Run("Clean", func(t *testing.T) {
+		tree, err := Load(writeRepo(t, labRepo()))
+		require.NoError(t, err)
+		g := NewGraph(tree, DefaultDependencies)
+		assert.True(t, g.OK())
+		assert.Len(t, g.Dependencies, 4, "istiod on istio-base, and the three Applications of project platform on argocd-projects")
+	})
+
+	t.Run("Inversion", func(t *testing.T) {
+		// The CRD consumer syncs in an earlier wave than the CRD provider
+		files := labRepo()
+		files["gitops/environments/lab/platform/istio/istiod.yaml"] = application("istiod", "platform", "1", "platform/networking/istio/istiod", "istio-system", helmValues)
+		tree, err := Load(writeRepo(t, files))
+		require.NoError(t, err)
+
+		g := NewGraph(tree, DefaultDependencies)
+		assert.False(t, g.OK())
+		require.Len(t, g.Inversions(), 1)
+		assert.Equal(t, "istiod (wave 1) must sync after istio-base (wave 2), but syncs before it", g.Inversions()[0].describe())
+		assert.Empty(t, g.Cycles)
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		// argocd-projects deploys the platform project from under platform-apps,
+		// which needs that project
+		files := labRepo()
+		delete(files, "gitops/bootstrap/projects.yaml")
+		files["gitops/environments/lab/platform/projects.yaml"] = application("argocd-projects", "platform", "-1", "gitops/projects", "argocd", "")
+		tree, err := Load(writeRepo(t, files))
+		require.NoError(t, err)
+
+		g := NewGraph(tree, DefaultDependencies)
+		require.Len(t, g.Cycles, 1)
+		assert.Equal(t, []string{"platform-apps", "argocd-projects"}, names(g.Cycles[0]))
+	})
+
+	t.Run("ParentCycle", func(t *testing.T) {
+		files := labRepo()
+		files["gitops/environments/lab/platform/istio/istio-apps.yaml"] = application("istio-apps", "platform", "1", "gitops/environments/lab/loop", "argocd", "")
+		files["gitops/environments/lab/loop/loop-apps.yaml"] = application("loop-apps", "platform", "1", "gitops/environments/lab/platform/istio", "argocd", "")
+		tree, err := Load(writeRepo(t, files))
+		require.NoError(t, err)
+
+		g := NewGraph(tree, DefaultDependencies)
+		assert.Equal(t, []string{"loop-apps", "istio-apps", "istiod"}, names(g.Unscheduled))
+		require.Len(t, g.Cycles, 1)
+		assert.ElementsMatch(t, []string{"istio-apps", "loop-apps"}, names(g.Cycles[0]))
+	})
+}
+
+func TestWriteGraph(t *testing.T) {
+	files := labRepo()
+	files["gitops/environments/lab/platform/istio/istiod.yaml"] = application("istiod", "platform", "1", "platform/networking/istio/istiod", "istio-system", helmValues)
+	tree, err := Load(writeRepo(t, files))
+	require.NoError(t, err)
+	g := NewGraph(tree, DefaultDependencies)
+
+	render := func(format string) string {
+		var b strings.Builder
+		require.NoError(t, WriteGraph(&b, g, format))
+		return b.String()
+	}
+
+	text := render(FormatText)
+	assert.Contains(t, text, " 1. wave -1, applied by hand\n      root ")
+	assert.Contains(t, text, "inversion: istiod (wave 1) must sync after istio-base (wave 2), but syncs before it")
+
+	dot := render(FormatDOT)
+	assert.True(t, strings.HasPrefix(dot, "digraph syncwaves {"))
+	assert.Contains(t, dot, `"platform-apps" -> "istiod";`)
+	assert.Contains(t, dot, `"istio-base" -> "istiod" [style=dashed, color=red, label="dependency"];`)
+	assert.Contains(t, dot, `"argocd-projects" -> "istio-base" [style=dashed, label="project platform"];`)
+
+	mermaid := render(FormatMermaid)
+	assert.Contains(t, mermaid, `app_istio_base["istio-base<br/>wave 2"]`)
+	assert.Contains(t, mermaid, "app_root --> app_argocd_projects")
+	assert.Regexp(t, `linkStyle \d+ stroke:red`, mermaid)
+
+	var doc struct {
+		OK    bool `json:"ok"`
+		Steps []struct {
+			Parent string `json:"parent"`
+			Apps   []struct {
+				Name string `json:"name"`
+				Wave int    `json:"wave"`
+			} `json:"applications"`
+		} `json:"steps"`
+		Dependencies []struct {
+			App       string `json:"application"`
+			On        string `json:"on"`
+			Order     string `json:"order"`
+			Satisfied bool   `json:"satisfied"`
+		} `json:"dependencies"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(render(FormatJSON)), &doc))
+	assert.False(t, doc.OK)
+	require.Len(t, doc.Steps, 5)
+	assert.Equal(t, "platform-apps", doc.Steps[3].Parent)
+	assert.Equal(t, "istiod", doc.Steps[3].Apps[0].Name, "wave 1 before wave 2")
+	assert.Contains(t, doc.Dependencies, struct {
+		App       string `json:"application"`
+		On        string `json:"on"`
+		Order     string `json:"order"`
+		Satisfied bool   `json:"satisfied"`
+	}{"istiod", "istio-base", "before", false})
+
+	assert.Error(t, WriteGraph(&strings.Builder{}, g, "svg"))
+}
+
+func TestGlobMatch(t *testing.T) {
+	assert.True(t, globMatch("*.yaml", "lab/platform/kong.yaml"), "* matches across /")
+	assert.True(t, globMatch("{projects.yaml,platform-apps.yaml}", "platform-apps.yaml"))
+	assert.False(t, globMatch("{projects.yaml,platform-apps.yaml}", "application-apps.yaml"))
+	assert.True(t, globMatch("https://github.com/fsongt-ext/*", "https://github.com/fsongt-ext/boutique"))
+	assert.True(t, globMatch("istio-?ystem", "istio-system"))
+	assert.False(t, globMatch("a.b", "axb"), "regexp metacharacters are literal")
+}
+
+func TestSameRepo(t *testing.T) {
+	assert.True(t, sameRepo(repoURL, "https://github.com/fsongt-ext/kubernetes-extreme-lab"))
+	assert.True(t, sameRepo(repoURL, "ssh://git@github.com/fsongt-ext/kubernetes-extreme-lab.git"))
+	assert.False(t, sameRepo(repoURL, "git@github.com:fsongt-ext/other.git"))
+}
+
+// TestRepositoryManifests lints the repository's own gitops/ tree
+func TestRepositoryManifests(t *testing.T) {
+	tree, err := Load("../../..")
+	require.NoError(t, err)
+	require.NotEmpty(t, tree.Applications)
+
+	// microservices-demo deploys to boutique, which the applications
+	// AppProject does not allow; whether it should is for the project's
+	// owners to decide, see gitops/README.md
+	known := Diagnostic{
+		Pos:  Pos{File: "gitops/environments/lab/applications/microservices-demo.yaml", Line: 27},
+		Rule: "destination",
+	}
+	for _, d := range Lint(tree, DefaultDependencies) {
+		if d.Pos == known.Pos && d.Rule == known.Rule {
+			continue
+		}
+		t.Error(d)
+	}
+
+	g := NewGraph(tree, DefaultDependencies)
+	assert.True(t, g.OK(), "the sync waves satisfy DefaultDependencies")
+	require.Len(t, g.Steps[0].Apps, 1)
+	assert.Equal(t, "gitops/bootstrap/root-application.yaml", g.Steps[0].Apps[0].file, "the only root")
+}
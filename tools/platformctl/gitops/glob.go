@@ -0,0 +1,51 @@
+package gitops
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var globCache sync.Map
+
+// globMatch matches s against an Argo CD glob, as used in AppProject
+// sourceRepos and destinations and in directory include/exclude. Argo CD
+// compiles them without separators, so * also matches "/"; {a,b} matches
+// either alternative.
+func globMatch(pattern, s string) bool {
+	if re, ok := globCache.Load(pattern); ok {
+		return re.(*regexp.Regexp).MatchString(s)
+	}
+	expr, ok := globRegexp(pattern)
+	if !ok {
+		// Unbalanced braces: compare literally
+		return pattern == s
+	}
+	re := regexp.MustCompile("^" + expr + "$")
+	globCache.Store(pattern, re)
+	return re.MatchString(s)
+}
+
+func globRegexp(pattern string) (string, bool) {
+	var b strings.Builder
+	depth := 0
+	for _, r := range pattern {
+		switch {
+		case r == '*':
+			b.WriteString(".*")
+		case r == '?':
+			b.WriteString(".")
+		case r == '{':
+			depth++
+			b.WriteString("(?:")
+		case r == '}' && depth > 0:
+			depth--
+			b.WriteString(")")
+		case r == ',' && depth > 0:
+			b.WriteString("|")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String(), depth == 0
+}
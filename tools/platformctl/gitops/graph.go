@@ -0,0 +1,316 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Graph is the simulated sync order of a tree and the dependencies between
+// its Applications
+type Graph struct {
+	Steps        []Step
+	Dependencies []Dependency
+	Cycles       [][]*Application
+	// Unscheduled are the Applications no root reaches
+	Unscheduled []*Application
+}
+
+// NewGraph simulates the sync order of t and checks it against deps, as in
+// DefaultDependencies
+func NewGraph(t *Tree, deps map[string][]string) *Graph {
+	g := &Graph{Dependencies: Dependencies(t, deps)}
+	g.Steps, g.Unscheduled = Simulate(t)
+	g.Cycles = Cycles(t, g.Dependencies)
+	return g
+}
+
+// Inversions returns the dependencies that sync waves do not satisfy,
+// including those on Applications that no manifest defines
+func (g *Graph) Inversions() []Dependency {
+	var out []Dependency
+	for _, d := range g.Dependencies {
+		if !d.Satisfied() {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// OK reports whether every Application is scheduled, with no cycle or
+// inversion
+func (g *Graph) OK() bool {
+	return len(g.Cycles) == 0 && len(g.Inversions()) == 0 && len(g.Unscheduled) == 0
+}
+
+// apps returns the Applications in simulated order, then the unscheduled
+// ones
+func (g *Graph) apps() []*Application {
+	var apps []*Application
+	for _, step := range g.Steps {
+		apps = append(apps, step.Apps...)
+	}
+	return append(apps, g.Unscheduled...)
+}
+
+// Output formats of the graph
+const (
+	FormatText    = "text"
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+	FormatJSON    = "json"
+)
+
+// Formats lists the supported graph output formats
+var Formats = []string{FormatText, FormatDOT, FormatMermaid, FormatJSON}
+
+// WriteGraph renders g to w in format
+func WriteGraph(w io.Writer, g *Graph, format string) error {
+	switch format {
+	case FormatText:
+		return WriteText(w, g)
+	case FormatDOT:
+		return WriteDOT(w, g)
+	case FormatMermaid:
+		return WriteMermaid(w, g)
+	case FormatJSON:
+		return WriteJSON(w, g)
+	default:
+		return fmt.Errorf("unknown output format %q, want one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// WriteText renders the simulated order as numbered steps, followed by the
+// cycles and inversions
+func WriteText(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	for i, step := range g.Steps {
+		parent := "applied by hand"
+		if step.Parent != nil {
+			parent = "created by " + step.Parent.Name()
+		}
+		fmt.Fprintf(&b, "%2d. wave %d, %s\n", i+1, step.Wave, parent)
+		for _, app := range step.Apps {
+			fmt.Fprintf(&b, "      %-20s %s\n", app.Name(), app.Pos("metadata", "name"))
+		}
+	}
+
+	for _, app := range g.Unscheduled {
+		fmt.Fprintf(&b, "\nunscheduled: %s is not reached from any root (%s)", app.Name(), app.Pos("metadata", "name"))
+	}
+	for _, cycle := range g.Cycles {
+		fmt.Fprintf(&b, "\ncycle: %s", strings.Join(names(cycle), ", "))
+	}
+	for _, d := range g.Inversions() {
+		fmt.Fprintf(&b, "\ninversion: %s", d.describe())
+	}
+	if !g.OK() {
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// describe explains why d is an inversion
+func (d Dependency) describe() string {
+	if d.On == nil {
+		return fmt.Sprintf("%s depends on %s, which no Application deploys", d.App.Name(), d.Name)
+	}
+	why := ""
+	if d.Project != "" {
+		why = fmt.Sprintf(" (it deploys AppProject %s)", d.Project)
+	}
+	order := "syncs " + Order(d.App, d.On).String() + " it"
+	if Order(d.App, d.On) == Unordered {
+		order = "is not ordered with it"
+	}
+	return fmt.Sprintf("%s (wave %d) must sync after %s (wave %d)%s, but %s",
+		d.App.Name(), d.App.SyncWave(), d.On.Name(), d.On.SyncWave(), why, order)
+}
+
+func names(apps []*Application) []string {
+	out := make([]string, len(apps))
+	for i, app := range apps {
+		out[i] = app.Name()
+	}
+	return out
+}
+
+// WriteDOT renders g for Graphviz: solid edges from each Application to
+// those it creates, dashed edges from each dependency to its dependent,
+// red when sync waves do not satisfy it
+func WriteDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph syncwaves {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=rounded];\n")
+
+	inCycle := cycleMembers(g)
+	for _, app := range g.apps() {
+		attrs := ""
+		if inCycle[app] {
+			attrs = ", color=red"
+		}
+		fmt.Fprintf(&b, "  %q [label=%q%s];\n", app.Name(), fmt.Sprintf("%s\nwave %d", app.Name(), app.SyncWave()), attrs)
+	}
+	for _, app := range g.apps() {
+		for _, child := range app.Children {
+			fmt.Fprintf(&b, "  %q -> %q;\n", app.Name(), child.Name())
+		}
+	}
+	for _, d := range g.Dependencies {
+		attrs := "style=dashed"
+		if !d.Satisfied() {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(&b, "  %q -> %q [%s, label=%q];\n", d.Name, d.App.Name(), attrs, d.label())
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// label is the edge label of a dependency
+func (d Dependency) label() string {
+	if d.Project != "" {
+		return "project " + d.Project
+	}
+	return "dependency"
+}
+
+func cycleMembers(g *Graph) map[*Application]bool {
+	members := map[*Application]bool{}
+	for _, cycle := range g.Cycles {
+		for _, app := range cycle {
+			members[app] = true
+		}
+	}
+	return members
+}
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// mermaidID turns an Application name into a Mermaid node ID; the prefix
+// keeps names such as "end" from clashing with keywords
+func mermaidID(name string) string {
+	return "app_" + mermaidUnsafe.ReplaceAllString(name, "_")
+}
+
+// WriteMermaid renders g as a Mermaid flowchart, with the same edges as
+// WriteDOT
+func WriteMermaid(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+
+	inCycle := cycleMembers(g)
+	for _, app := range g.apps() {
+		fmt.Fprintf(&b, "  %s[\"%s<br/>wave %d\"]\n", mermaidID(app.Name()), app.Name(), app.SyncWave())
+	}
+
+	edge := 0
+	var failed []string
+	for _, app := range g.apps() {
+		for _, child := range app.Children {
+			fmt.Fprintf(&b, "  %s --> %s\n", mermaidID(app.Name()), mermaidID(child.Name()))
+			edge++
+		}
+	}
+	for _, d := range g.Dependencies {
+		fmt.Fprintf(&b, "  %s -. %s .-> %s\n", mermaidID(d.Name), d.label(), mermaidID(d.App.Name()))
+		if !d.Satisfied() {
+			failed = append(failed, fmt.Sprint(edge))
+		}
+		edge++
+	}
+
+	if len(failed) > 0 {
+		fmt.Fprintf(&b, "  linkStyle %s stroke:red\n", strings.Join(failed, ","))
+	}
+	var cyclic []string
+	for _, app := range g.apps() {
+		if inCycle[app] {
+			cyclic = append(cyclic, mermaidID(app.Name()))
+		}
+	}
+	if len(cyclic) > 0 {
+		b.WriteString("  classDef cycle stroke:red\n")
+		fmt.Fprintf(&b, "  class %s cycle\n", strings.Join(cyclic, ","))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON renders g as a JSON document: the steps of the simulated order,
+// the dependencies with whether sync waves satisfy them, and the problems
+func WriteJSON(w io.Writer, g *Graph) error {
+	type jsonApp struct {
+		Name     string   `json:"name"`
+		Wave     int      `json:"wave"`
+		File     string   `json:"file"`
+		Parent   string   `json:"parent,omitempty"`
+		Children []string `json:"children,omitempty"`
+	}
+	type jsonStep struct {
+		Step   int       `json:"step"`
+		Parent string    `json:"parent,omitempty"`
+		Wave   int       `json:"wave"`
+		Apps   []jsonApp `json:"applications"`
+	}
+	type jsonDependency struct {
+		App       string `json:"application"`
+		On        string `json:"on"`
+		Project   string `json:"project,omitempty"`
+		Order     string `json:"order"`
+		Satisfied bool   `json:"satisfied"`
+	}
+	doc := struct {
+		OK           bool             `json:"ok"`
+		Steps        []jsonStep       `json:"steps"`
+		Dependencies []jsonDependency `json:"dependencies"`
+		Cycles       [][]string       `json:"cycles"`
+		Unscheduled  []string         `json:"unscheduled"`
+	}{
+		OK:           g.OK(),
+		Steps:        []jsonStep{},
+		Dependencies: []jsonDependency{},
+		Cycles:       [][]string{},
+		Unscheduled:  names(g.Unscheduled),
+	}
+
+	app := func(a *Application) jsonApp {
+		out := jsonApp{Name: a.Name(), Wave: a.SyncWave(), File: a.file, Children: names(a.Children)}
+		if a.Parent != nil {
+			out.Parent = a.Parent.Name()
+		}
+		return out
+	}
+	for i, step := range g.Steps {
+		s := jsonStep{Step: i + 1, Wave: step.Wave}
+		if step.Parent != nil {
+			s.Parent = step.Parent.Name()
+		}
+		for _, a := range step.Apps {
+			s.Apps = append(s.Apps, app(a))
+		}
+		doc.Steps = append(doc.Steps, s)
+	}
+	for _, d := range g.Dependencies {
+		order := "missing"
+		if d.On != nil {
+			order = Order(d.App, d.On).String()
+		}
+		doc.Dependencies = append(doc.Dependencies, jsonDependency{App: d.App.Name(), On: d.Name, Project: d.Project, Order: order, Satisfied: d.Satisfied()})
+	}
+	for _, cycle := range g.Cycles {
+		doc.Cycles = append(doc.Cycles, names(cycle))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
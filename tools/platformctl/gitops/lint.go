@@ -0,0 +1,296 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Lint rules, shown after each diagnostic
+const (
+	RuleParse       = "parse"
+	RuleDuplicate   = "duplicate-name"
+	RuleSourcePath  = "source-path"
+	RuleValueFile   = "value-file"
+	RuleProject     = "project"
+	RuleSourceRepo  = "source-repo"
+	RuleDestination = "destination"
+	RuleSyncWave    = "sync-wave"
+)
+
+// DefaultDependencies lists, per Application, the Applications it needs to
+// be synced first: istio-base installs the Istio CRDs that istiod and the
+// VirtualServices of the workloads use, and argo-rollouts the Rollout CRD.
+// Every Application also depends on the one that deploys its AppProject.
+var DefaultDependencies = map[string][]string{
+	"istiod":             {"istio-base"},
+	"demo-app":           {"argo-rollouts", "istio-base"},
+	"microservices-demo": {"istio-base"},
+}
+
+// Diagnostic is one problem found in the manifests
+type Diagnostic struct {
+	Pos     Pos
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+// Lint checks the tree and returns its diagnostics sorted by position.
+// deps lists the dependencies between Applications, as in
+// DefaultDependencies.
+func Lint(t *Tree, deps map[string][]string) []Diagnostic {
+	l := &linter{
+		tree:     t,
+		diags:    append([]Diagnostic(nil), t.parseErrors...),
+		inverted: map[[2]*Application]bool{},
+	}
+
+	l.duplicates()
+	for _, app := range t.Applications {
+		l.sources(app)
+		l.project(app)
+		l.syncWave(app)
+	}
+	l.dependencies(deps)
+
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		a, b := l.diags[i].Pos, l.diags[j].Pos
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return l.diags
+}
+
+type linter struct {
+	tree  *Tree
+	diags []Diagnostic
+	// inverted are the sibling pairs already reported as out of order
+	inverted map[[2]*Application]bool
+}
+
+func (l *linter) report(pos Pos, rule, format string, args ...any) {
+	l.diags = append(l.diags, Diagnostic{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// duplicates reports Applications and AppProjects defined more than once;
+// Argo CD would keep only one of them
+func (l *linter) duplicates() {
+	apps := map[string]*Application{}
+	for _, app := range l.tree.Applications {
+		key := app.Metadata.Namespace + "/" + app.Name()
+		if first, ok := apps[key]; ok {
+			l.report(app.Pos("metadata", "name"), RuleDuplicate, "Application %s is already defined at %s", app.Name(), first.Pos("metadata", "name"))
+			continue
+		}
+		apps[key] = app
+	}
+
+	projects := map[string]*AppProject{}
+	for _, project := range l.tree.Projects {
+		if first, ok := projects[project.Name()]; ok {
+			l.report(project.Pos("metadata", "name"), RuleDuplicate, "AppProject %s is already defined at %s", project.Name(), first.Pos("metadata", "name"))
+			continue
+		}
+		projects[project.Name()] = project
+	}
+}
+
+// sources resolves each local source against the working tree
+func (l *linter) sources(app *Application) {
+	sources := app.SourceList()
+	if len(sources) == 0 {
+		l.report(app.Pos("spec"), RuleSourcePath, "Application %s has no source", app.Name())
+	}
+
+	for i, src := range sources {
+		keys := app.sourceKeys(i)
+		if !l.tree.IsLocal(src) {
+			continue
+		}
+		if src.Path == "" {
+			l.report(app.Pos(keys...), RuleSourcePath, "source has no path")
+			continue
+		}
+
+		dir := filepath.Join(l.tree.Root, filepath.FromSlash(src.Path))
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			l.report(app.Pos(append(keys, "path")...), RuleSourcePath, "source path %s does not exist", src.Path)
+			continue
+		}
+
+		if !l.tree.isHelm(src) {
+			if !l.hasManifests(src) {
+				l.report(app.Pos(append(keys, "path")...), RuleSourcePath, "source path %s has no manifests to sync", src.Path)
+			}
+			continue
+		}
+		if !exists(filepath.Join(dir, "Chart.yaml")) {
+			l.report(app.Pos(append(keys, "helm")...), RuleSourcePath, "source path %s has helm settings but no Chart.yaml", src.Path)
+			continue
+		}
+		if src.Helm == nil || src.Helm.IgnoreMissingValueFiles {
+			continue
+		}
+		for j, file := range src.Helm.ValueFiles {
+			// Remote files and $ref files of multi-source apps are not local
+			if strings.Contains(file, "://") || strings.HasPrefix(file, "$") {
+				continue
+			}
+			if !exists(filepath.Join(dir, filepath.FromSlash(file))) {
+				l.report(app.Pos(append(keys, "helm", "valueFiles", strconv.Itoa(j))...), RuleValueFile,
+					"value file %s does not exist", path.Join(src.Path, file))
+			}
+		}
+	}
+}
+
+// hasManifests reports whether a directory source matches any YAML file
+func (l *linter) hasManifests(src Source) bool {
+	found := false
+	root := filepath.Join(l.tree.Root, filepath.FromSlash(src.Path))
+	filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || found {
+			return filepath.SkipAll
+		}
+		rel, _ := filepath.Rel(l.tree.Root, p)
+		if !d.IsDir() && isYAML(p) && src.contains(filepath.ToSlash(rel)) {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// project checks the Application's sources and destination against the
+// allow-lists of its AppProject
+func (l *linter) project(app *Application) {
+	name := app.Spec.Project
+	if name == "" {
+		l.report(app.Pos("spec"), RuleProject, "Application %s has no project", app.Name())
+		return
+	}
+	// The default project allows everything unless it is redefined
+	project := l.tree.Project(name)
+	if project == nil {
+		if name != "default" {
+			l.report(app.Pos("spec", "project"), RuleProject, "AppProject %s is not defined", name)
+		}
+		return
+	}
+
+	for i, src := range app.SourceList() {
+		if !matchesAny(project.Spec.SourceRepos, src.RepoURL) {
+			l.report(app.Pos(append(app.sourceKeys(i), "repoURL")...), RuleSourceRepo,
+				"repository %s is not in the sourceRepos of AppProject %s", src.RepoURL, name)
+		}
+	}
+
+	dest := app.Spec.Destination
+	for _, allowed := range project.Spec.Destinations {
+		if destinationAllowed(allowed, dest) {
+			return
+		}
+	}
+	l.report(app.Pos("spec", "destination", "namespace"), RuleDestination,
+		"destination namespace %q is not allowed by AppProject %s at %s", dest.Namespace, name, project.Pos("spec", "destinations"))
+}
+
+func matchesAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if p == s || globMatch(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationAllowed matches a destination against one AppProject entry:
+// the cluster by server URL or name, and the namespace
+func destinationAllowed(allowed, dest Destination) bool {
+	cluster := false
+	switch {
+	case dest.Server != "" && allowed.Server != "":
+		cluster = globMatch(allowed.Server, dest.Server)
+	case dest.Name != "" && allowed.Name != "":
+		cluster = globMatch(allowed.Name, dest.Name)
+	}
+	return cluster && globMatch(allowed.Namespace, dest.Namespace)
+}
+
+// syncWave checks that the sync-wave annotation is an integer
+func (l *linter) syncWave(app *Application) {
+	wave, ok := app.Metadata.Annotations[SyncWaveAnnotation]
+	if !ok {
+		return
+	}
+	if _, err := strconv.Atoi(strings.TrimSpace(wave)); err != nil {
+		l.report(app.Pos("metadata", "annotations", SyncWaveAnnotation), RuleSyncWave, "sync wave %q is not an integer", wave)
+	}
+}
+
+// dependencies checks that every Application syncs after those it depends
+// on: the ones listed in deps and the one deploying its AppProject
+func (l *linter) dependencies(deps map[string][]string) {
+	cyclic := map[*Application]bool{}
+	for _, app := range l.tree.Applications {
+		if path, ok := app.Path(); ok {
+			cyclic[app] = true
+			l.report(app.Pos("metadata", "name"), RuleSyncWave, "Application %s is its own ancestor via %s", app.Name(), path[0].Name())
+		}
+	}
+
+	for _, d := range Dependencies(l.tree, deps) {
+		switch {
+		case cyclic[d.App]:
+		case d.On == nil:
+			l.report(d.App.Pos("metadata", "name"), RuleSyncWave, "%s depends on %s, which no Application deploys", d.App.Name(), d.Name)
+		case d.Project != "":
+			l.after(d.App, d.On, fmt.Sprintf(" (it deploys AppProject %s)", d.Project))
+		default:
+			l.after(d.App, d.On, "")
+		}
+	}
+}
+
+// after reports app unless it syncs after dep
+func (l *linter) after(app, dep *Application, why string) {
+	if Order(app, dep) == After {
+		return
+	}
+
+	pos := app.Pos("metadata", "annotations", SyncWaveAnnotation)
+	x, y := orderedVia(app, dep)
+	// Applications under the same parent share its inversion
+	if x != nil {
+		if l.inverted[[2]*Application{x, y}] {
+			return
+		}
+		l.inverted[[2]*Application{x, y}] = true
+	}
+	switch {
+	case x == nil:
+		l.report(pos, RuleSyncWave, "%s must sync after %s%s, but sync waves do not order them", app.Name(), dep.Name(), why)
+	case x == app && y == dep:
+		l.report(pos, RuleSyncWave, "%s (wave %d) must sync after %s (wave %d)%s",
+			app.Name(), app.SyncWave(), dep.Name(), dep.SyncWave(), why)
+	default:
+		l.report(x.Pos("metadata", "annotations", SyncWaveAnnotation), RuleSyncWave,
+			"%s must sync after %s%s, but %s (wave %d) does not sync after %s (wave %d)",
+			app.Name(), dep.Name(), why, x.Name(), x.SyncWave(), y.Name(), y.SyncWave())
+	}
+}
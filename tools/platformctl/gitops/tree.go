@@ -0,0 +1,423 @@
+// Package gitops reads the Argo CD manifests under gitops/ into a tree of
+// Applications, resolving each local source path against the working copy,
+// and lints it without a cluster.
+package gitops
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SyncWaveAnnotation orders the Applications created by the same parent
+const SyncWaveAnnotation = "argocd.argoproj.io/sync-wave"
+
+// repositorySecretLabel marks the Secrets that register a repository with
+// Argo CD
+const repositorySecretLabel = "argocd.argoproj.io/secret-type"
+
+// DefaultDirs are the directories, relative to the repository root, that
+// hold the Argo CD manifests
+var DefaultDirs = []string{"gitops/bootstrap", "gitops/projects", "gitops/environments"}
+
+// Pos is a position in a manifest, relative to the repository root
+type Pos struct {
+	File string
+	Line int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// object is one YAML document
+type object struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace"`
+		Labels      map[string]string `yaml:"labels"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+
+	file string
+	node *yaml.Node
+}
+
+// Pos returns the position of the value at the key path, or of the
+// deepest key on it that exists
+func (o *object) Pos(keys ...string) Pos {
+	node := o.node
+	line := node.Line
+	for _, key := range keys {
+		next := child(node, key)
+		if next == nil {
+			break
+		}
+		node, line = next, next.Line
+	}
+	return Pos{File: o.file, Line: line}
+}
+
+// child returns the value of key in a mapping, or the item at index key
+// in a sequence
+func child(node *yaml.Node, key string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// Application is an Argo CD Application manifest
+type Application struct {
+	object `yaml:"-"`
+	Spec   struct {
+		Project     string      `yaml:"project"`
+		Source      *Source     `yaml:"source"`
+		Sources     []Source    `yaml:"sources"`
+		Destination Destination `yaml:"destination"`
+	} `yaml:"spec"`
+
+	// Parent is the Application whose source contains this manifest, nil
+	// for one applied by hand, like the root of an app of apps
+	Parent   *Application
+	Children []*Application
+}
+
+// Name is the Application's name
+func (a *Application) Name() string { return a.Metadata.Name }
+
+// Source is one source of an Application
+type Source struct {
+	RepoURL        string `yaml:"repoURL"`
+	Path           string `yaml:"path"`
+	Chart          string `yaml:"chart"`
+	TargetRevision string `yaml:"targetRevision"`
+	Helm           *struct {
+		ValueFiles              []string `yaml:"valueFiles"`
+		IgnoreMissingValueFiles bool     `yaml:"ignoreMissingValueFiles"`
+	} `yaml:"helm"`
+	Directory *struct {
+		Recurse bool   `yaml:"recurse"`
+		Include string `yaml:"include"`
+		Exclude string `yaml:"exclude"`
+	} `yaml:"directory"`
+}
+
+// Destination is where an Application deploys to
+type Destination struct {
+	Server    string `yaml:"server"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+// AppProject is an Argo CD AppProject manifest
+type AppProject struct {
+	object `yaml:"-"`
+	Spec   struct {
+		SourceRepos  []string      `yaml:"sourceRepos"`
+		Destinations []Destination `yaml:"destinations"`
+	} `yaml:"spec"`
+
+	// DeployedBy is the Application whose source contains this manifest
+	DeployedBy *Application
+}
+
+// Name is the AppProject's name
+func (p *AppProject) Name() string { return p.Metadata.Name }
+
+// SourceList returns the Application's sources, whether set as source or
+// sources
+func (a *Application) SourceList() []Source {
+	if a.Spec.Source != nil {
+		return []Source{*a.Spec.Source}
+	}
+	return a.Spec.Sources
+}
+
+// sourceKeys returns the manifest key path of source i
+func (a *Application) sourceKeys(i int) []string {
+	if a.Spec.Source != nil {
+		return []string{"spec", "source"}
+	}
+	return []string{"spec", "sources", strconv.Itoa(i)}
+}
+
+// SyncWave is the value of the sync-wave annotation, 0 when unset or not
+// an integer
+func (a *Application) SyncWave() int {
+	wave, _ := strconv.Atoi(strings.TrimSpace(a.Metadata.Annotations[SyncWaveAnnotation]))
+	return wave
+}
+
+// Tree is the Argo CD manifests of a repository
+type Tree struct {
+	// Root is the repository root, which local source paths are relative to
+	Root         string
+	Applications []*Application
+	Projects     []*AppProject
+	// RepoURLs are the URLs of this repository, from the repository
+	// Secrets in the manifests
+	RepoURLs []string
+	// parseErrors are manifests that could not be read, reported by Lint
+	parseErrors []Diagnostic
+}
+
+// Load reads the manifests under dirs, relative to root, and links each
+// Application to the one whose source contains it
+func Load(root string, dirs ...string) (*Tree, error) {
+	if len(dirs) == 0 {
+		dirs = DefaultDirs
+	}
+
+	t := &Tree{Root: root}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(filepath.Join(root, dir), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !isYAML(p) {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			return t.readFile(filepath.ToSlash(rel))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.link()
+	return t, nil
+}
+
+func isYAML(p string) bool {
+	return strings.HasSuffix(p, ".yaml") || strings.HasSuffix(p, ".yml")
+}
+
+func (t *Tree) readFile(rel string) error {
+	f, err := os.Open(filepath.Join(t.Root, filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			t.parseErrors = append(t.parseErrors, Diagnostic{Pos: Pos{File: rel, Line: yamlErrorLine(err)}, Rule: RuleParse, Message: err.Error()})
+			return nil
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		if err := t.add(rel, doc.Content[0]); err != nil {
+			t.parseErrors = append(t.parseErrors, Diagnostic{Pos: Pos{File: rel, Line: doc.Content[0].Line}, Rule: RuleParse, Message: err.Error()})
+		}
+	}
+}
+
+func (t *Tree) add(file string, node *yaml.Node) error {
+	var obj object
+	if err := node.Decode(&obj); err != nil {
+		return err
+	}
+	obj.file, obj.node = file, node
+
+	argo := strings.HasPrefix(obj.APIVersion, "argoproj.io/")
+	switch {
+	case argo && obj.Kind == "Application":
+		app := &Application{object: obj}
+		if err := node.Decode(app); err != nil {
+			return err
+		}
+		t.Applications = append(t.Applications, app)
+	case argo && obj.Kind == "AppProject":
+		project := &AppProject{object: obj}
+		if err := node.Decode(project); err != nil {
+			return err
+		}
+		t.Projects = append(t.Projects, project)
+	case obj.APIVersion == "v1" && obj.Kind == "Secret" && obj.Metadata.Labels[repositorySecretLabel] == "repository":
+		var secret struct {
+			StringData struct {
+				URL string `yaml:"url"`
+			} `yaml:"stringData"`
+		}
+		if err := node.Decode(&secret); err != nil {
+			return err
+		}
+		if secret.StringData.URL != "" {
+			t.RepoURLs = append(t.RepoURLs, secret.StringData.URL)
+		}
+	}
+	return nil
+}
+
+// yamlErrorLine extracts the line from a yaml.v3 error such as "yaml: line
+// 12: did not find expected key", or returns 1
+func yamlErrorLine(err error) int {
+	msg := err.Error()
+	if _, rest, ok := strings.Cut(msg, "line "); ok {
+		if n, err := strconv.Atoi(strings.SplitN(rest, ":", 2)[0]); err == nil {
+			return n
+		}
+	}
+	return 1
+}
+
+// IsLocal reports whether src points into this repository
+func (t *Tree) IsLocal(src Source) bool {
+	if src.Chart != "" {
+		return false
+	}
+	for _, url := range t.RepoURLs {
+		if sameRepo(url, src.RepoURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameRepo compares repository URLs regardless of scheme, so that
+// git@github.com:org/repo.git and https://github.com/org/repo match
+func sameRepo(a, b string) bool {
+	return normalizeRepo(a) == normalizeRepo(b)
+}
+
+func normalizeRepo(url string) string {
+	url = strings.ToLower(strings.TrimSpace(url))
+	if _, rest, ok := strings.Cut(url, "://"); ok {
+		url = rest
+	} else if _, rest, ok := strings.Cut(url, "@"); ok {
+		// scp-like syntax: git@host:path
+		url = strings.Replace(rest, ":", "/", 1)
+	}
+	if _, rest, ok := strings.Cut(url, "@"); ok {
+		url = rest
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+}
+
+// link sets Parent, Children and DeployedBy from the Applications' local
+// directory sources
+func (t *Tree) link() {
+	for _, app := range t.Applications {
+		for _, src := range app.SourceList() {
+			if !t.IsLocal(src) || t.isHelm(src) {
+				continue
+			}
+			for _, child := range t.Applications {
+				if child != app && src.contains(child.file) {
+					child.Parent = app
+				}
+			}
+			for _, project := range t.Projects {
+				if src.contains(project.file) {
+					project.DeployedBy = app
+				}
+			}
+		}
+	}
+
+	// An Application synced by two parents is created by the last one
+	for _, app := range t.Applications {
+		if app.Parent != nil {
+			app.Parent.Children = append(app.Parent.Children, app)
+		}
+	}
+	for _, app := range t.Applications {
+		sort.SliceStable(app.Children, func(i, j int) bool {
+			return app.Children[i].SyncWave() < app.Children[j].SyncWave()
+		})
+	}
+}
+
+// isHelm reports whether a local source renders a Helm chart rather than a
+// directory of manifests
+func (t *Tree) isHelm(src Source) bool {
+	if src.Helm != nil {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(t.Root, filepath.FromSlash(src.Path), "Chart.yaml"))
+	return err == nil
+}
+
+// contains reports whether a directory source syncs the manifest at file
+func (src Source) contains(file string) bool {
+	dir := path.Clean(src.Path)
+	rel, ok := strings.CutPrefix(file, dir+"/")
+	if !ok {
+		return false
+	}
+
+	recurse, include, exclude := false, "", ""
+	if src.Directory != nil {
+		recurse, include, exclude = src.Directory.Recurse, src.Directory.Include, src.Directory.Exclude
+	}
+	if !recurse && strings.Contains(rel, "/") {
+		return false
+	}
+	if include != "" && !globMatch(include, rel) {
+		return false
+	}
+	return exclude == "" || !globMatch(exclude, rel)
+}
+
+// Project returns the AppProject named name, or nil
+func (t *Tree) Project(name string) *AppProject {
+	for _, p := range t.Projects {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Application returns the Application named name, or nil
+func (t *Tree) Application(name string) *Application {
+	for _, a := range t.Applications {
+		if a.Name() == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Roots returns the Applications applied by hand
+func (t *Tree) Roots() []*Application {
+	var roots []*Application
+	for _, a := range t.Applications {
+		if a.Parent == nil {
+			roots = append(roots, a)
+		}
+	}
+	return roots
+}
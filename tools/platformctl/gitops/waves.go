@@ -0,0 +1,253 @@
+package gitops
+
+import "sort"
+
+// Path returns the chain of Applications from the root applied by hand
+// down to a. If the parent links form a cycle, the chain stops before the
+// first repeated Application and cyclic is true.
+func (a *Application) Path() (path []*Application, cyclic bool) {
+	seen := map[*Application]bool{}
+	for app := a; app != nil; app = app.Parent {
+		if seen[app] {
+			cyclic = true
+			break
+		}
+		seen[app] = true
+		path = append([]*Application{app}, path...)
+	}
+	return path, cyclic
+}
+
+// Ordering is how two Applications are ordered by their sync waves
+type Ordering int
+
+const (
+	// Unordered Applications may sync in either order or concurrently:
+	// they are siblings in the same wave, or have no common root
+	Unordered Ordering = iota
+	Before
+	After
+)
+
+func (o Ordering) String() string {
+	switch o {
+	case Before:
+		return "before"
+	case After:
+		return "after"
+	default:
+		return "unordered"
+	}
+}
+
+// Order reports whether a syncs before or after b. Sync waves only order
+// siblings, so Applications under different parents are ordered by the
+// waves of their ancestors below the nearest common one. An Application
+// syncs before everything it creates.
+func Order(a, b *Application) Ordering {
+	pa, pb, i, ok := diverge(a, b)
+	switch {
+	case !ok, i == len(pa) && i == len(pb):
+		return Unordered
+	case i == len(pa):
+		// a is an ancestor of b
+		return Before
+	case i == len(pb):
+		return After
+	}
+
+	wa, wb := pa[i].SyncWave(), pb[i].SyncWave()
+	switch {
+	case wa < wb:
+		return Before
+	case wa > wb:
+		return After
+	default:
+		return Unordered
+	}
+}
+
+// orderedVia returns the Applications whose sync waves decide Order(a, b):
+// a and b themselves if they are siblings, else their ancestors below the
+// nearest common one. It returns nils when waves do not decide the order.
+func orderedVia(a, b *Application) (*Application, *Application) {
+	pa, pb, i, ok := diverge(a, b)
+	if !ok || i == len(pa) || i == len(pb) {
+		return nil, nil
+	}
+	return pa[i], pb[i]
+}
+
+// diverge returns the paths of a and b and the index where they part. ok
+// is false when they have different roots.
+func diverge(a, b *Application) (pa, pb []*Application, i int, ok bool) {
+	pa, _ = a.Path()
+	pb, _ = b.Path()
+	if len(pa) == 0 || len(pb) == 0 || pa[0] != pb[0] {
+		return pa, pb, 0, false
+	}
+	for i < len(pa) && i < len(pb) && pa[i] == pb[i] {
+		i++
+	}
+	return pa, pb, i, true
+}
+
+// Dependency is an Application that must sync after another one
+type Dependency struct {
+	App *Application
+	// On is the Application that App depends on, nil when none is named
+	// Name
+	On   *Application
+	Name string
+	// Project is set when On deploys the AppProject of App
+	Project string
+}
+
+// Satisfied reports whether sync waves order App after On
+func (d Dependency) Satisfied() bool {
+	return d.On != nil && Order(d.App, d.On) == After
+}
+
+// Dependencies lists the dependencies of each Application: those named in
+// deps, as in DefaultDependencies, and the Application that deploys its
+// AppProject
+func Dependencies(t *Tree, deps map[string][]string) []Dependency {
+	var out []Dependency
+	for _, app := range t.Applications {
+		for _, name := range deps[app.Name()] {
+			out = append(out, Dependency{App: app, On: t.Application(name), Name: name})
+		}
+		if project := t.Project(app.Spec.Project); project != nil && project.DeployedBy != nil && project.DeployedBy != app {
+			out = append(out, Dependency{App: app, On: project.DeployedBy, Name: project.DeployedBy.Name(), Project: project.Name()})
+		}
+	}
+	return out
+}
+
+// Cycles returns the groups of Applications that no order can sync: each
+// has to sync before itself, through the Applications it creates and the
+// dependencies. Groups and their members are in manifest order.
+func Cycles(t *Tree, deps []Dependency) [][]*Application {
+	// next lists what must sync after each Application
+	next := map[*Application][]*Application{}
+	for _, app := range t.Applications {
+		next[app] = append(next[app], app.Children...)
+	}
+	for _, d := range deps {
+		if d.On != nil {
+			next[d.On] = append(next[d.On], d.App)
+		}
+	}
+
+	// Tarjan's strongly connected components
+	index := map[*Application]int{}
+	low := map[*Application]int{}
+	onStack := map[*Application]bool{}
+	var stack []*Application
+	var cycles [][]*Application
+	var visit func(app *Application)
+	visit = func(app *Application) {
+		index[app] = len(index)
+		low[app] = index[app]
+		stack = append(stack, app)
+		onStack[app] = true
+
+		self := false
+		for _, n := range next[app] {
+			if n == app {
+				self = true
+			}
+			if _, seen := index[n]; !seen {
+				visit(n)
+				low[app] = min(low[app], low[n])
+			} else if onStack[n] {
+				low[app] = min(low[app], index[n])
+			}
+		}
+		if low[app] != index[app] {
+			return
+		}
+
+		var group []*Application
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			group = append(group, n)
+			if n == app {
+				break
+			}
+		}
+		if len(group) > 1 || self {
+			cycles = append(cycles, group)
+		}
+	}
+	for _, app := range t.Applications {
+		if _, seen := index[app]; !seen {
+			visit(app)
+		}
+	}
+
+	position := map[*Application]int{}
+	for i, app := range t.Applications {
+		position[app] = i
+	}
+	for _, group := range cycles {
+		sort.Slice(group, func(i, j int) bool { return position[group[i]] < position[group[j]] })
+	}
+	sort.Slice(cycles, func(i, j int) bool { return position[cycles[i][0]] < position[cycles[j][0]] })
+	return cycles
+}
+
+// Step is a group of Applications that sync together: the roots, or the
+// children of one parent in the same wave
+type Step struct {
+	// Parent is nil for the roots
+	Parent *Application
+	Wave   int
+	Apps   []*Application
+}
+
+// Simulate returns the order Argo CD syncs the tree in, starting from the
+// roots. The children of an Application sync after it, wave by wave, and
+// each child's own children sync before the next wave of its siblings.
+// Applications within a step are unordered, and so are the steps below
+// them. Applications in a parent cycle are not reached from any root and
+// are returned as unscheduled.
+func Simulate(t *Tree) (steps []Step, unscheduled []*Application) {
+	scheduled := map[*Application]bool{}
+	var visit func(parent *Application, apps []*Application)
+	visit = func(parent *Application, apps []*Application) {
+		for start := 0; start < len(apps); {
+			end := start + 1
+			for end < len(apps) && apps[end].SyncWave() == apps[start].SyncWave() {
+				end++
+			}
+			step := Step{Parent: parent, Wave: apps[start].SyncWave()}
+			for _, app := range apps[start:end] {
+				if !scheduled[app] {
+					scheduled[app] = true
+					step.Apps = append(step.Apps, app)
+				}
+			}
+			if len(step.Apps) > 0 {
+				steps = append(steps, step)
+			}
+			for _, app := range step.Apps {
+				visit(app, app.Children)
+			}
+			start = end
+		}
+	}
+
+	roots := t.Roots()
+	sort.SliceStable(roots, func(i, j int) bool { return roots[i].SyncWave() < roots[j].SyncWave() })
+	visit(nil, roots)
+
+	for _, app := range t.Applications {
+		if !scheduled[app] {
+			unscheduled = append(unscheduled, app)
+		}
+	}
+	return steps, unscheduled
+}
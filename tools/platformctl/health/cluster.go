@@ -0,0 +1,251 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultCriticalServices are the Services the platform cannot work
+// without, as namespace/name
+var DefaultCriticalServices = []string{
+	"kube-system/kube-dns",
+	"argocd/argocd-server",
+	"istio-system/istiod",
+	"cert-manager/cert-manager-webhook",
+	"kyverno/kyverno-svc",
+}
+
+// Default-class annotations on StorageClasses
+var defaultClassAnnotations = []string{
+	"storageclass.kubernetes.io/is-default-class",
+	"storageclass.beta.kubernetes.io/is-default-class",
+}
+
+// Connectivity checks that the API server answers. It is required: nothing
+// else can run without it.
+func Connectivity() Check {
+	return Check{
+		Name:        "connectivity",
+		Description: "API server is reachable",
+		Required:    true,
+		Run: func(ctx context.Context, c Clients) Result {
+			// ServerVersion takes no context; the REST client's timeout bounds it
+			version, err := c.Kube.Discovery().ServerVersion()
+			if err != nil {
+				return Result{Status: StatusCritical, Message: "cannot connect to the cluster: " + err.Error()}
+			}
+			return ok("API server %s is reachable", version.GitVersion)
+		},
+	}
+}
+
+// Nodes checks that every node is Ready. Cordoned nodes and nodes under
+// memory, disk or PID pressure are warnings.
+func Nodes() Check {
+	return Check{
+		Name:        "nodes",
+		Description: "all nodes are Ready and schedulable",
+		Run: func(ctx context.Context, c Clients) Result {
+			nodes, err := c.Kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return unknown(err, "listing nodes")
+			}
+			if len(nodes.Items) == 0 {
+				return Result{Status: StatusCritical, Message: "the cluster has no nodes"}
+			}
+
+			var f findings
+			ready := 0
+			for _, node := range nodes.Items {
+				cond := nodeCondition(&node, corev1.NodeReady)
+				switch {
+				case cond == nil:
+					f.add(StatusCritical, "%s: no Ready condition", node.Name)
+				case cond.Status != corev1.ConditionTrue:
+					f.add(StatusCritical, "%s: Ready=%s (%s)", node.Name, cond.Status, cond.Reason)
+				default:
+					ready++
+				}
+
+				if node.Spec.Unschedulable {
+					f.add(StatusWarning, "%s: cordoned", node.Name)
+				}
+				for _, pressure := range []corev1.NodeConditionType{corev1.NodeMemoryPressure, corev1.NodeDiskPressure, corev1.NodePIDPressure} {
+					if cond := nodeCondition(&node, pressure); cond != nil && cond.Status == corev1.ConditionTrue {
+						f.add(StatusWarning, "%s: %s", node.Name, pressure)
+					}
+				}
+			}
+
+			summary := fmt.Sprintf("%d/%d nodes Ready", ready, len(nodes.Items))
+			return f.result(summary, summary)
+		},
+	}
+}
+
+func nodeCondition(node *corev1.Node, t corev1.NodeConditionType) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == t {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SystemPods checks that the pods in namespaces, kube-system by default,
+// are running with every container ready or have completed. Unhealthy
+// system pods are warnings, as the script reported them.
+func SystemPods(namespaces ...string) Check {
+	if len(namespaces) == 0 {
+		namespaces = []string{"kube-system"}
+	}
+	return Check{
+		Name:        "system-pods",
+		Description: "pods in " + strings.Join(namespaces, ", ") + " are running or completed",
+		Run: func(ctx context.Context, c Clients) Result {
+			var f findings
+			total := 0
+			for _, ns := range namespaces {
+				pods, err := c.Kube.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+				if err != nil {
+					return unknown(err, "listing pods in %s", ns)
+				}
+				total += len(pods.Items)
+				for _, pod := range pods.Items {
+					if problem := podProblem(&pod); problem != "" {
+						f.add(StatusWarning, "%s/%s: %s", pod.Namespace, pod.Name, problem)
+					}
+				}
+			}
+			return f.result(
+				fmt.Sprintf("all %d system pods are healthy", total),
+				fmt.Sprintf("%d/%d system pods are not healthy", len(f.details), total),
+			)
+		},
+	}
+}
+
+// podProblem describes why pod is unhealthy, or returns "" if it is not
+func podProblem(pod *corev1.Pod) string {
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return ""
+	case corev1.PodRunning:
+	default:
+		if pod.Status.Reason != "" {
+			return fmt.Sprintf("%s (%s)", pod.Status.Phase, pod.Status.Reason)
+		}
+		return string(pod.Status.Phase)
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Ready {
+			continue
+		}
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return fmt.Sprintf("container %s %s", cs.Name, cs.State.Waiting.Reason)
+		}
+		return fmt.Sprintf("container %s not ready", cs.Name)
+	}
+	return ""
+}
+
+// CriticalServices checks that each namespace/name Service exists and has
+// a ready endpoint
+func CriticalServices(services ...string) Check {
+	return Check{
+		Name:        "services",
+		Description: "critical Services exist and have ready endpoints",
+		Run: func(ctx context.Context, c Clients) Result {
+			var f findings
+			for _, ref := range services {
+				ns, name, found := strings.Cut(ref, "/")
+				if !found {
+					return Result{Status: StatusUnknown, Message: fmt.Sprintf("service %q: want namespace/name", ref)}
+				}
+
+				svc, err := c.Kube.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
+				if apierrors.IsNotFound(err) {
+					f.add(StatusCritical, "%s: not found", ref)
+					continue
+				}
+				if err != nil {
+					return unknown(err, "getting service %s", ref)
+				}
+				if svc.Spec.Type == corev1.ServiceTypeExternalName || len(svc.Spec.Selector) == 0 {
+					continue
+				}
+
+				ready, err := readyEndpoints(ctx, c, ns, name)
+				if err != nil {
+					return unknown(err, "listing endpoints of %s", ref)
+				}
+				if ready == 0 {
+					f.add(StatusCritical, "%s: no ready endpoints", ref)
+				}
+			}
+			return f.result(
+				fmt.Sprintf("all %d critical services are available", len(services)),
+				fmt.Sprintf("%d/%d critical services are unavailable", len(f.details), len(services)),
+			)
+		},
+	}
+}
+
+func readyEndpoints(ctx context.Context, c Clients, ns, service string) (int, error) {
+	slices, err := c.Kube.DiscoveryV1().EndpointSlices(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: "kubernetes.io/service-name=" + service,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ready := 0
+	for _, slice := range slices.Items {
+		for _, ep := range slice.Endpoints {
+			// A nil Ready means unknown, which consumers treat as ready
+			if ep.Conditions.Ready == nil || *ep.Conditions.Ready {
+				ready++
+			}
+		}
+	}
+	return ready, nil
+}
+
+// DefaultStorageClass checks that exactly one StorageClass is the default
+func DefaultStorageClass() Check {
+	return Check{
+		Name:        "storage",
+		Description: "a default StorageClass is configured",
+		Run: func(ctx context.Context, c Clients) Result {
+			classes, err := c.Kube.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return unknown(err, "listing storage classes")
+			}
+
+			var defaults []string
+			for _, sc := range classes.Items {
+				for _, key := range defaultClassAnnotations {
+					if sc.Annotations[key] == "true" {
+						defaults = append(defaults, sc.Name)
+						break
+					}
+				}
+			}
+
+			switch len(defaults) {
+			case 0:
+				return Result{Status: StatusWarning, Message: "no default storage class configured"}
+			case 1:
+				return ok("default storage class: %s", defaults[0])
+			default:
+				return Result{Status: StatusWarning, Message: "more than one default storage class", Details: defaults}
+			}
+		},
+	}
+}
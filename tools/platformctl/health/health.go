@@ -0,0 +1,200 @@
+// Package health runs the platform health checks behind `platformctl
+// health`: the cluster basics that infrastructure/scripts/health-check.sh
+// covered, plus the state of Argo CD Applications, cert-manager
+// Certificates and Kyverno policies. The e2e tests run the same checks.
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Status is the outcome of one check
+type Status string
+
+// Check outcomes, from least to most severe. A skipped check did not apply,
+// e.g. because the component it inspects is not installed.
+const (
+	StatusOK       Status = "ok"
+	StatusSkipped  Status = "skipped"
+	StatusWarning  Status = "warning"
+	StatusUnknown  Status = "unknown"
+	StatusCritical Status = "critical"
+)
+
+var severity = map[Status]int{
+	StatusOK:       0,
+	StatusSkipped:  0,
+	StatusWarning:  1,
+	StatusUnknown:  2,
+	StatusCritical: 3,
+}
+
+// ExitCode maps a status to the Nagios plugin convention: 0 OK, 1 warning,
+// 2 critical, 3 unknown
+func (s Status) ExitCode() int {
+	switch s {
+	case StatusWarning:
+		return 1
+	case StatusCritical:
+		return 2
+	case StatusUnknown:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Worse reports whether s is more severe than other
+func (s Status) Worse(other Status) bool {
+	return severity[s] > severity[other]
+}
+
+// Result is the outcome of one check. Details lists the offending objects,
+// one per line.
+type Result struct {
+	Check    string        `json:"check"`
+	Status   Status        `json:"status"`
+	Message  string        `json:"message"`
+	Details  []string      `json:"details,omitempty"`
+	Duration time.Duration `json:"-"`
+}
+
+// Clients are the API clients checks read the cluster with
+type Clients struct {
+	Kube    kubernetes.Interface
+	Dynamic dynamic.Interface
+}
+
+// Check is one named health check
+type Check struct {
+	Name        string
+	Description string
+	// Required checks gate the rest: if one does not pass, the checks after
+	// it are skipped
+	Required bool
+	Run      func(ctx context.Context, c Clients) Result
+}
+
+// Report is the result of a run
+type Report struct {
+	Context  string        `json:"context,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"-"`
+	Results  []Result      `json:"results"`
+}
+
+// Status is the most severe status in the report
+func (r *Report) Status() Status {
+	worst := StatusOK
+	for _, res := range r.Results {
+		if res.Status.Worse(worst) {
+			worst = res.Status
+		}
+	}
+	return worst
+}
+
+// Counts returns the number of results per status
+func (r *Report) Counts() map[Status]int {
+	counts := map[Status]int{}
+	for _, res := range r.Results {
+		counts[res.Status]++
+	}
+	return counts
+}
+
+// Run runs checks in order, each bounded by timeout
+func Run(ctx context.Context, c Clients, checks []Check, timeout time.Duration) *Report {
+	report := &Report{Started: time.Now()}
+	var gate string
+
+	for _, check := range checks {
+		if gate != "" {
+			report.Results = append(report.Results, Result{
+				Check:   check.Name,
+				Status:  StatusSkipped,
+				Message: fmt.Sprintf("%s check did not pass", gate),
+			})
+			continue
+		}
+
+		res := runOne(ctx, c, check, timeout)
+		report.Results = append(report.Results, res)
+		if check.Required && res.Status != StatusOK {
+			gate = check.Name
+		}
+	}
+
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+func runOne(ctx context.Context, c Clients, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	res := check.Run(ctx, c)
+	res.Check = check.Name
+	res.Duration = time.Since(start)
+	return res
+}
+
+// Select returns the checks named in names, in the order of checks
+func Select(checks []Check, names []string) ([]Check, error) {
+	want := map[string]bool{}
+	for _, name := range names {
+		want[name] = true
+	}
+
+	var selected []Check
+	for _, check := range checks {
+		if want[check.Name] {
+			selected = append(selected, check)
+			delete(want, check.Name)
+		}
+	}
+	for name := range want {
+		return nil, fmt.Errorf("unknown check %q", name)
+	}
+	return selected, nil
+}
+
+func ok(format string, args ...any) Result {
+	return Result{Status: StatusOK, Message: fmt.Sprintf(format, args...)}
+}
+
+func skipped(format string, args ...any) Result {
+	return Result{Status: StatusSkipped, Message: fmt.Sprintf(format, args...)}
+}
+
+// unknown reports a check that could not read the cluster
+func unknown(err error, format string, args ...any) Result {
+	return Result{Status: StatusUnknown, Message: fmt.Sprintf(format, args...) + ": " + err.Error()}
+}
+
+// findings collects the problems a check found, each with its own severity
+type findings struct {
+	status  Status
+	details []string
+}
+
+func (f *findings) add(status Status, format string, args ...any) {
+	if status.Worse(f.status) {
+		f.status = status
+	}
+	f.details = append(f.details, fmt.Sprintf(format, args...))
+}
+
+// result reports message with the details found, or okMessage if none were
+func (f *findings) result(okMessage, message string) Result {
+	if len(f.details) == 0 {
+		return ok("%s", okMessage)
+	}
+	return Result{Status: f.status, Message: message, Details: f.details}
+}
@@ -0,0 +1,426 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+func node(name string, ready corev1.ConditionStatus, mutate ...func(*corev1.Node)) *corev1.Node {
+	n := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: ready, Reason: "KubeletReady"},
+		}},
+	}
+	for _, m := range mutate {
+		m(n)
+	}
+	return n
+}
+
+func pod(name string, phase corev1.PodPhase, containers ...corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system"},
+		Status:     corev1.PodStatus{Phase: phase, ContainerStatuses: containers},
+	}
+}
+
+func service(ns, name string, readyEndpoints ...bool) []runtime.Object {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": name}},
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-abcde",
+			Namespace: ns,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: name},
+		},
+	}
+	for _, ready := range readyEndpoints {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(ready)}})
+	}
+	return []runtime.Object{svc, slice}
+}
+
+func storageClass(name string, isDefault bool) *storagev1.StorageClass {
+	sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: name}, Provisioner: "rancher.io/local-path"}
+	if isDefault {
+		sc.Annotations = map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}
+	}
+	return sc
+}
+
+func object(apiVersion, kind, ns, name string, fields map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: fields}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(ns)
+	obj.SetName(name)
+	return obj
+}
+
+func application(name, sync, health string) *unstructured.Unstructured {
+	return object("argoproj.io/v1alpha1", "Application", "argocd", name, map[string]any{
+		"status": map[string]any{
+			"sync":   map[string]any{"status": sync},
+			"health": map[string]any{"status": health},
+		},
+	})
+}
+
+func conditions(status, reason, message string) map[string]any {
+	return map[string]any{"conditions": []any{
+		map[string]any{"type": "Ready", "status": status, "reason": reason, "message": message},
+	}}
+}
+
+func certificate(name string, status map[string]any) *unstructured.Unstructured {
+	return object("cert-manager.io/v1", "Certificate", "istio-system", name, map[string]any{"status": status})
+}
+
+func clusterPolicy(name, action string, status map[string]any) *unstructured.Unstructured {
+	return object("kyverno.io/v1", "ClusterPolicy", "", name, map[string]any{
+		"spec":   map[string]any{"validationFailureAction": action},
+		"status": status,
+	})
+}
+
+// healthyPlatform is a cluster every default check passes on
+func healthyPlatform() (kube, dyn []runtime.Object) {
+	kube = []runtime.Object{
+		node("lab-server", corev1.ConditionTrue),
+		node("lab-agent-1", corev1.ConditionTrue),
+		pod("coredns-1", corev1.PodRunning, corev1.ContainerStatus{Name: "coredns", Ready: true}),
+		pod("helm-install-traefik-1", corev1.PodSucceeded),
+		storageClass("local-path", true),
+	}
+	for _, ref := range DefaultCriticalServices {
+		ns, name, _ := strings.Cut(ref, "/")
+		kube = append(kube, service(ns, name, true)...)
+	}
+	dyn = []runtime.Object{
+		application("platform", "Synced", "Healthy"),
+		certificate("ingress-tls", conditions("True", "Ready", "Certificate is up to date")),
+		clusterPolicy("require-pod-requests-limits", "enforce", conditions("True", "Succeeded", "Ready")),
+		// Kyverno before 1.9 only sets status.ready
+		clusterPolicy("add-networkpolicy", "audit", map[string]any{"ready": true}),
+	}
+	return kube, dyn
+}
+
+func newClients(kube, dyn []runtime.Object) Clients {
+	return Clients{
+		Kube:    fake.NewSimpleClientset(kube...),
+		Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), ListKinds, dyn...),
+	}
+}
+
+func TestHealthyPlatform(t *testing.T) {
+	report := Run(context.Background(), newClients(healthyPlatform()), Default(), time.Second)
+
+	for _, res := range report.Results {
+		assert.Equal(t, StatusOK, res.Status, "%s: %s %v", res.Check, res.Message, res.Details)
+	}
+	assert.Len(t, report.Results, len(Default()))
+	assert.Equal(t, StatusOK, report.Status())
+	assert.Equal(t, 0, report.Status().ExitCode())
+}
+
+func TestChecksReportProblems(t *testing.T) {
+	cordoned := func(n *corev1.Node) { n.Spec.Unschedulable = true }
+	expired := conditions("True", "Ready", "Certificate is up to date")
+	expired["notAfter"] = "2020-01-01T00:00:00Z"
+
+	tests := []struct {
+		name    string
+		check   Check
+		kube    []runtime.Object
+		dyn     []runtime.Object
+		status  Status
+		details []string
+	}{
+		{
+			name:    "NodeNotReady",
+			check:   Nodes(),
+			kube:    []runtime.Object{node("lab-server", corev1.ConditionTrue), node("lab-agent-1", corev1.ConditionFalse, cordoned)},
+			status:  StatusCritical,
+			details: []string{"lab-agent-1: Ready=False (KubeletReady)", "lab-agent-1: cordoned"},
+		},
+		{
+			name:    "NodeCordoned",
+			check:   Nodes(),
+			kube:    []runtime.Object{node("lab-server", corev1.ConditionTrue, cordoned)},
+			status:  StatusWarning,
+			details: []string{"lab-server: cordoned"},
+		},
+		{
+			name:   "NoNodes",
+			check:  Nodes(),
+			status: StatusCritical,
+		},
+		{
+			name:  "SystemPodCrashLooping",
+			check: SystemPods(),
+			kube: []runtime.Object{
+				pod("coredns-1", corev1.PodRunning, corev1.ContainerStatus{
+					Name:  "coredns",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				}),
+				pod("metrics-server-1", corev1.PodPending),
+			},
+			status:  StatusWarning,
+			details: []string{"kube-system/coredns-1: container coredns CrashLoopBackOff", "kube-system/metrics-server-1: Pending"},
+		},
+		{
+			name:    "ServiceMissingOrWithoutEndpoints",
+			check:   CriticalServices("kube-system/kube-dns", "argocd/argocd-server"),
+			kube:    service("kube-system", "kube-dns", false),
+			status:  StatusCritical,
+			details: []string{"kube-system/kube-dns: no ready endpoints", "argocd/argocd-server: not found"},
+		},
+		{
+			name:   "NoDefaultStorageClass",
+			check:  DefaultStorageClass(),
+			kube:   []runtime.Object{storageClass("local-path", false)},
+			status: StatusWarning,
+		},
+		{
+			name:    "ApplicationOutOfSync",
+			check:   ArgoCDApplications("argocd"),
+			dyn:     []runtime.Object{application("platform", "Synced", "Healthy"), application("demo-app", "OutOfSync", "Progressing")},
+			status:  StatusWarning,
+			details: []string{"demo-app: sync=OutOfSync health=Progressing"},
+		},
+		{
+			name:    "ApplicationDegraded",
+			check:   ArgoCDApplications("argocd"),
+			dyn:     []runtime.Object{application("demo-app", "OutOfSync", "Progressing"), application("kyverno", "Synced", "Degraded")},
+			status:  StatusCritical,
+			details: []string{"demo-app: sync=OutOfSync health=Progressing", "kyverno: sync=Synced health=Degraded"},
+		},
+		{
+			name:  "CertificateNotReady",
+			check: Certificates(),
+			dyn: []runtime.Object{
+				certificate("ingress-tls", conditions("False", "Issuing", "Issuing certificate as Secret does not exist")),
+				certificate("pending-tls", map[string]any{}),
+			},
+			status: StatusCritical,
+			details: []string{
+				"istio-system/ingress-tls: Ready=False (Issuing): Issuing certificate as Secret does not exist",
+				"istio-system/pending-tls: not issued yet",
+			},
+		},
+		{
+			name:    "CertificateExpired",
+			check:   Certificates(),
+			dyn:     []runtime.Object{certificate("ingress-tls", expired)},
+			status:  StatusCritical,
+			details: []string{"istio-system/ingress-tls: expired at 2020-01-01T00:00:00Z"},
+		},
+		{
+			name:    "EnforcePolicyNotReady",
+			check:   KyvernoPolicies(),
+			dyn:     []runtime.Object{clusterPolicy("require-pod-requests-limits", "Enforce", conditions("False", "Failed", "webhook not configured"))},
+			status:  StatusCritical,
+			details: []string{"ClusterPolicy require-pod-requests-limits: not ready: webhook not configured"},
+		},
+		{
+			name:    "AuditPolicyNotReady",
+			check:   KyvernoPolicies(),
+			dyn:     []runtime.Object{clusterPolicy("add-networkpolicy", "Audit", map[string]any{"ready": false})},
+			status:  StatusWarning,
+			details: []string{"ClusterPolicy add-networkpolicy: not ready"},
+		},
+		{
+			name:   "NoPolicies",
+			check:  KyvernoPolicies(),
+			status: StatusWarning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := tt.check.Run(context.Background(), newClients(tt.kube, tt.dyn))
+			assert.Equal(t, tt.status, res.Status, res.Message)
+			assert.Equal(t, tt.details, res.Details)
+		})
+	}
+}
+
+func TestComponentNotInstalled(t *testing.T) {
+	for _, check := range []Check{ArgoCDApplications("argocd"), Certificates(), KyvernoPolicies()} {
+		t.Run(check.Name, func(t *testing.T) {
+			dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), ListKinds)
+			dyn.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewNotFound(action.GetResource().GroupResource(), "")
+			})
+
+			res := check.Run(context.Background(), Clients{Kube: fake.NewSimpleClientset(), Dynamic: dyn})
+			assert.Equal(t, StatusSkipped, res.Status)
+			assert.Contains(t, res.Message, "not installed")
+		})
+	}
+}
+
+func TestAPIErrorIsUnknown(t *testing.T) {
+	kube := fake.NewSimpleClientset()
+	kube.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection reset by peer")
+	})
+
+	res := Nodes().Run(context.Background(), Clients{Kube: kube})
+	assert.Equal(t, StatusUnknown, res.Status)
+	assert.Equal(t, "listing nodes: connection reset by peer", res.Message)
+}
+
+func TestRequiredCheckGatesTheRest(t *testing.T) {
+	ran := false
+	checks := []Check{
+		{Name: "connectivity", Required: true, Run: func(context.Context, Clients) Result {
+			return Result{Status: StatusCritical, Message: "cannot connect to the cluster"}
+		}},
+		{Name: "nodes", Run: func(context.Context, Clients) Result {
+			ran = true
+			return ok("fine")
+		}},
+	}
+
+	report := Run(context.Background(), Clients{}, checks, time.Second)
+	assert.False(t, ran, "checks after a failed required check must not run")
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, StatusSkipped, report.Results[1].Status)
+	assert.Equal(t, "connectivity check did not pass", report.Results[1].Message)
+	assert.Equal(t, 2, report.Status().ExitCode())
+}
+
+func TestStatusSeverity(t *testing.T) {
+	results := func(statuses ...Status) *Report {
+		r := &Report{}
+		for _, s := range statuses {
+			r.Results = append(r.Results, Result{Status: s})
+		}
+		return r
+	}
+
+	assert.Equal(t, StatusOK, results(StatusOK, StatusSkipped).Status())
+	assert.Equal(t, StatusWarning, results(StatusOK, StatusWarning).Status())
+	assert.Equal(t, StatusUnknown, results(StatusWarning, StatusUnknown).Status())
+	assert.Equal(t, StatusCritical, results(StatusUnknown, StatusCritical, StatusWarning).Status())
+
+	for status, code := range map[Status]int{StatusOK: 0, StatusSkipped: 0, StatusWarning: 1, StatusCritical: 2, StatusUnknown: 3} {
+		assert.Equal(t, code, status.ExitCode(), status)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	selected, err := Select(Default(), []string{"kyverno", "nodes"})
+	require.NoError(t, err)
+	require.Len(t, selected, 2)
+	assert.Equal(t, "nodes", selected[0].Name, "checks keep their default order")
+	assert.Equal(t, "kyverno", selected[1].Name)
+
+	_, err = Select(Default(), []string{"dns"})
+	assert.EqualError(t, err, `unknown check "dns"`)
+}
+
+func sampleReport() *Report {
+	return &Report{
+		Context:  "k3d-lab",
+		Started:  time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Duration: 1500 * time.Millisecond,
+		Results: []Result{
+			{Check: "nodes", Status: StatusOK, Message: "2/2 nodes Ready", Duration: 20 * time.Millisecond},
+			{Check: "services", Status: StatusCritical, Message: "1/5 critical services are unavailable", Details: []string{"istio-system/istiod: not found"}},
+			{Check: "storage", Status: StatusWarning, Message: "no default storage class configured"},
+			{Check: "argocd", Status: StatusUnknown, Message: "listing Applications: forbidden"},
+			{Check: "kyverno", Status: StatusSkipped, Message: "Kyverno is not installed"},
+		},
+	}
+}
+
+func TestWriteHuman(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteHuman(&buf, sampleReport()))
+
+	out := buf.String()
+	assert.Contains(t, out, "Platform health: k3d-lab")
+	assert.Contains(t, out, "✓ nodes         2/2 nodes Ready\n")
+	assert.Contains(t, out, "✗ services      1/5 critical services are unavailable\n    istio-system/istiod: not found\n")
+	assert.Contains(t, out, "1 ok, 1 warning, 1 critical, 1 unknown, 1 skipped in 1.5s: CRITICAL")
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, sampleReport()))
+
+	var doc struct {
+		Context  string  `json:"context"`
+		Status   Status  `json:"status"`
+		ExitCode int     `json:"exitCode"`
+		Seconds  float64 `json:"seconds"`
+		Results  []struct {
+			Check   string   `json:"check"`
+			Status  Status   `json:"status"`
+			Details []string `json:"details"`
+			Seconds float64  `json:"seconds"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "k3d-lab", doc.Context)
+	assert.Equal(t, StatusCritical, doc.Status)
+	assert.Equal(t, 2, doc.ExitCode)
+	assert.Equal(t, 1.5, doc.Seconds)
+	require.Len(t, doc.Results, 5)
+	assert.Equal(t, 0.02, doc.Results[0].Seconds)
+	assert.Equal(t, []string{"istio-system/istiod: not found"}, doc.Results[1].Details)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJUnit(&buf, sampleReport()))
+
+	var suites junitSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &suites))
+	require.Len(t, suites.Suites, 1)
+	suite := suites.Suites[0]
+	assert.Equal(t, 5, suite.Tests)
+	assert.Equal(t, 2, suite.Failures)
+	assert.Equal(t, 1, suite.Errors)
+	assert.Equal(t, 1, suite.Skipped)
+	assert.Equal(t, "2024-05-01T10:00:00Z", suite.Timestamp)
+
+	services := suite.Cases[1]
+	require.NotNil(t, services.Failure)
+	assert.Equal(t, "critical", services.Failure.Type)
+	assert.Equal(t, "istio-system/istiod: not found", services.Failure.Body)
+	assert.Equal(t, "warning", suite.Cases[2].Failure.Type)
+	assert.NotNil(t, suite.Cases[3].Error)
+	assert.NotNil(t, suite.Cases[4].Skipped)
+	assert.Nil(t, suite.Cases[0].Failure)
+}
+
+func TestWriteRejectsUnknownFormat(t *testing.T) {
+	assert.EqualError(t, Write(&bytes.Buffer{}, sampleReport(), "yaml"), "unknown output format \"yaml\", want one of human, json, junit")
+}
@@ -0,0 +1,163 @@
+package health
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Output formats
+const (
+	FormatHuman = "human"
+	FormatJSON  = "json"
+	FormatJUnit = "junit"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatHuman, FormatJSON, FormatJUnit}
+
+// Write renders report to w in format
+func Write(w io.Writer, report *Report, format string) error {
+	switch format {
+	case FormatHuman:
+		return WriteHuman(w, report)
+	case FormatJSON:
+		return WriteJSON(w, report)
+	case FormatJUnit:
+		return WriteJUnit(w, report)
+	default:
+		return fmt.Errorf("unknown output format %q, want one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+var symbols = map[Status]string{
+	StatusOK:       "✓",
+	StatusSkipped:  "-",
+	StatusWarning:  "⚠",
+	StatusUnknown:  "?",
+	StatusCritical: "✗",
+}
+
+// WriteHuman renders report as a checklist in the style of the old
+// health-check.sh
+func WriteHuman(w io.Writer, report *Report) error {
+	var b strings.Builder
+	if report.Context != "" {
+		fmt.Fprintf(&b, "Platform health: %s\n\n", report.Context)
+	}
+	for _, res := range report.Results {
+		fmt.Fprintf(&b, "%s %-13s %s\n", symbols[res.Status], res.Check, res.Message)
+		for _, detail := range res.Details {
+			fmt.Fprintf(&b, "    %s\n", detail)
+		}
+	}
+
+	counts := report.Counts()
+	fmt.Fprintf(&b, "\n%d ok, %d warning, %d critical, %d unknown, %d skipped in %s: %s\n",
+		counts[StatusOK], counts[StatusWarning], counts[StatusCritical], counts[StatusUnknown], counts[StatusSkipped],
+		report.Duration.Round(time.Millisecond), strings.ToUpper(string(report.Status())))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON renders report as a JSON document with the overall status and
+// exit code
+func WriteJSON(w io.Writer, report *Report) error {
+	type jsonResult struct {
+		Result
+		Seconds float64 `json:"seconds"`
+	}
+	doc := struct {
+		*Report
+		Status   Status       `json:"status"`
+		ExitCode int          `json:"exitCode"`
+		Seconds  float64      `json:"seconds"`
+		Results  []jsonResult `json:"results"`
+	}{
+		Report:   report,
+		Status:   report.Status(),
+		ExitCode: report.Status().ExitCode(),
+		Seconds:  report.Duration.Seconds(),
+	}
+	for _, res := range report.Results {
+		doc.Results = append(doc.Results, jsonResult{Result: res, Seconds: res.Duration.Seconds()})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+type junitSuites struct {
+	XMLName xml.Name   `xml:"testsuites"`
+	Suites  []junitRun `xml:"testsuite"`
+}
+
+type junitRun struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit renders report as one JUnit test suite for CI. Critical and
+// warning results are failures, typed by severity; unknown results are
+// errors.
+func WriteJUnit(w io.Writer, report *Report) error {
+	suite := junitRun{
+		Name:      "platform-health",
+		Tests:     len(report.Results),
+		Time:      report.Duration.Seconds(),
+		Timestamp: report.Started.UTC().Format(time.RFC3339),
+	}
+	for _, res := range report.Results {
+		tc := junitCase{Name: res.Check, ClassName: "platform-health", Time: res.Duration.Seconds()}
+		msg := &junitMessage{Message: res.Message, Type: string(res.Status), Body: strings.Join(res.Details, "\n")}
+		switch res.Status {
+		case StatusCritical, StatusWarning:
+			tc.Failure = msg
+			suite.Failures++
+		case StatusUnknown:
+			tc.Error = msg
+			suite.Errors++
+		case StatusSkipped:
+			tc.Skipped = &junitMessage{Message: res.Message}
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitRun{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,223 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Resources of the platform components, read through the dynamic client
+var (
+	ApplicationResource   = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+	CertificateResource   = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+	ClusterPolicyResource = schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}
+	PolicyResource        = schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "policies"}
+)
+
+// ListKinds maps the resources above to their list kinds, as the fake
+// dynamic client needs
+var ListKinds = map[schema.GroupVersionResource]string{
+	ApplicationResource:   "ApplicationList",
+	CertificateResource:   "CertificateList",
+	ClusterPolicyResource: "ClusterPolicyList",
+	PolicyResource:        "PolicyList",
+}
+
+// Default returns the checks `platformctl health` runs, in order
+func Default() []Check {
+	return []Check{
+		Connectivity(),
+		Nodes(),
+		SystemPods(),
+		CriticalServices(DefaultCriticalServices...),
+		DefaultStorageClass(),
+		ArgoCDApplications("argocd"),
+		Certificates(),
+		KyvernoPolicies(),
+	}
+}
+
+// ArgoCDApplications checks that the Applications in namespace are Synced
+// and Healthy. Degraded and Missing apps are critical; apps that are
+// progressing, suspended or out of sync are warnings.
+func ArgoCDApplications(namespace string) Check {
+	return Check{
+		Name:        "argocd",
+		Description: "Argo CD Applications are Synced and Healthy",
+		Run: func(ctx context.Context, c Clients) Result {
+			apps, err := c.Dynamic.Resource(ApplicationResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+			if apierrors.IsNotFound(err) {
+				return skipped("Argo CD is not installed")
+			}
+			if err != nil {
+				return unknown(err, "listing Applications")
+			}
+			if len(apps.Items) == 0 {
+				return Result{Status: StatusWarning, Message: "no Applications in " + namespace}
+			}
+
+			var f findings
+			for _, app := range apps.Items {
+				sync, _, _ := unstructured.NestedString(app.Object, "status", "sync", "status")
+				health, _, _ := unstructured.NestedString(app.Object, "status", "health", "status")
+				if sync == "Synced" && health == "Healthy" {
+					continue
+				}
+
+				status := StatusWarning
+				if health == "Degraded" || health == "Missing" {
+					status = StatusCritical
+				}
+				detail := fmt.Sprintf("%s: sync=%s health=%s", app.GetName(), orUnknown(sync), orUnknown(health))
+				if msg, _, _ := unstructured.NestedString(app.Object, "status", "health", "message"); msg != "" {
+					detail += ": " + msg
+				}
+				f.add(status, "%s", detail)
+			}
+			return f.result(
+				fmt.Sprintf("all %d Applications are Synced and Healthy", len(apps.Items)),
+				fmt.Sprintf("%d/%d Applications are not Synced and Healthy", len(f.details), len(apps.Items)),
+			)
+		},
+	}
+}
+
+// Certificates checks that every cert-manager Certificate is Ready and
+// unexpired. Certificates not issued yet are warnings.
+func Certificates() Check {
+	return Check{
+		Name:        "certificates",
+		Description: "cert-manager Certificates are Ready",
+		Run: func(ctx context.Context, c Clients) Result {
+			certs, err := c.Dynamic.Resource(CertificateResource).List(ctx, metav1.ListOptions{})
+			if apierrors.IsNotFound(err) {
+				return skipped("cert-manager is not installed")
+			}
+			if err != nil {
+				return unknown(err, "listing Certificates")
+			}
+
+			var f findings
+			now := time.Now()
+			for _, cert := range certs.Items {
+				ref := cert.GetNamespace() + "/" + cert.GetName()
+				ready := condition(&cert, "Ready")
+				switch {
+				case ready == nil:
+					f.add(StatusWarning, "%s: not issued yet", ref)
+					continue
+				case ready.status != "True":
+					f.add(StatusCritical, "%s: Ready=%s (%s): %s", ref, ready.status, ready.reason, ready.message)
+					continue
+				}
+
+				notAfter, _, _ := unstructured.NestedString(cert.Object, "status", "notAfter")
+				if expiry, err := time.Parse(time.RFC3339, notAfter); err == nil && expiry.Before(now) {
+					f.add(StatusCritical, "%s: expired at %s", ref, notAfter)
+				}
+			}
+			return f.result(
+				fmt.Sprintf("all %d Certificates are Ready", len(certs.Items)),
+				fmt.Sprintf("%d/%d Certificates are not Ready", len(f.details), len(certs.Items)),
+			)
+		},
+	}
+}
+
+// KyvernoPolicies checks that every ClusterPolicy and Policy is Ready. A
+// policy that is not ready does not run: that is critical for Enforce
+// policies and a warning for Audit ones.
+func KyvernoPolicies() Check {
+	return Check{
+		Name:        "kyverno",
+		Description: "Kyverno policies are Ready",
+		Run: func(ctx context.Context, c Clients) Result {
+			clusterPolicies, err := c.Dynamic.Resource(ClusterPolicyResource).List(ctx, metav1.ListOptions{})
+			if apierrors.IsNotFound(err) {
+				return skipped("Kyverno is not installed")
+			}
+			if err != nil {
+				return unknown(err, "listing ClusterPolicies")
+			}
+			policies, err := c.Dynamic.Resource(PolicyResource).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return unknown(err, "listing Policies")
+			}
+
+			all := append(clusterPolicies.Items, policies.Items...)
+			if len(all) == 0 {
+				return Result{Status: StatusWarning, Message: "no Kyverno policies; admission enforces nothing"}
+			}
+
+			var f findings
+			for _, policy := range all {
+				if policyReady(&policy) {
+					continue
+				}
+				ref := policy.GetName()
+				if ns := policy.GetNamespace(); ns != "" {
+					ref = ns + "/" + ref
+				}
+				action, _, _ := unstructured.NestedString(policy.Object, "spec", "validationFailureAction")
+
+				status := StatusWarning
+				if strings.EqualFold(action, "Enforce") {
+					status = StatusCritical
+				}
+				detail := fmt.Sprintf("%s %s: not ready", policy.GetKind(), ref)
+				if ready := condition(&policy, "Ready"); ready != nil && ready.message != "" {
+					detail += ": " + ready.message
+				}
+				f.add(status, "%s", detail)
+			}
+			return f.result(
+				fmt.Sprintf("all %d Kyverno policies are Ready", len(all)),
+				fmt.Sprintf("%d/%d Kyverno policies are not Ready", len(f.details), len(all)),
+			)
+		},
+	}
+}
+
+// policyReady reads the Ready condition of Kyverno 1.9 and later, falling
+// back to the status.ready flag of older releases
+func policyReady(policy *unstructured.Unstructured) bool {
+	if ready := condition(policy, "Ready"); ready != nil {
+		return ready.status == "True"
+	}
+	ready, _, _ := unstructured.NestedBool(policy.Object, "status", "ready")
+	return ready
+}
+
+type objectCondition struct {
+	status, reason, message string
+}
+
+// condition returns the status.conditions entry of type t, or nil
+func condition(obj *unstructured.Unstructured, t string) *objectCondition {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, raw := range conditions {
+		cond, ok := raw.(map[string]any)
+		if !ok || cond["type"] != t {
+			continue
+		}
+		str := func(key string) string {
+			s, _ := cond[key].(string)
+			return s
+		}
+		return &objectCondition{status: str("status"), reason: str("reason"), message: str("message")}
+	}
+	return nil
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "Unknown"
+	}
+	return s
+}
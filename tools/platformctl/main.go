@@ -0,0 +1,250 @@
+// Command platformctl operates the lab platform. `platformctl health`
+// checks the cluster and the platform components on it and exits with the
+// severity of the worst finding; `platformctl lint` checks the GitOps
+// manifests without a cluster and `platformctl waves` renders the order
+// Argo CD syncs them in.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/yourusername/kubernetes-extreme-lab/tools/platformctl/gitops"
+	"github.com/yourusername/kubernetes-extreme-lab/tools/platformctl/health"
+)
+
+// command is a platformctl subcommand; it returns the process exit code
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"health", "Check the cluster and platform components", healthCommand},
+	{"lint", "Lint the Argo CD manifests under gitops/ offline", lintCommand},
+	{"waves", "Simulate and render the sync-wave order of gitops/", wavesCommand},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run dispatches args to a subcommand and returns the exit code
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return 2
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "-h", "--help":
+		usage(os.Stdout)
+		return 0
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage(os.Stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: platformctl <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// Exit code of `platformctl health` when it cannot run the checks at all,
+// matching health.StatusUnknown
+const exitUnknown = 3
+
+func healthCommand(args []string) int {
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
+	kubeconfig := fs.String("kubeconfig", "", "path to the kubeconfig file (default $KUBECONFIG or ~/.kube/config)")
+	kubeContext := fs.String("context", "", "kubeconfig context to use (default the current context)")
+	output := fs.String("o", health.FormatHuman, "output format: "+strings.Join(health.Formats, ", "))
+	checks := fs.String("checks", "", "comma-separated checks to run (default all)")
+	services := fs.String("services", strings.Join(health.DefaultCriticalServices, ","), "comma-separated namespace/name of the critical Services")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of each check")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: platformctl health [flags]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Checks:")
+		for _, check := range health.Default() {
+			fmt.Fprintf(fs.Output(), "  %-13s %s\n", check.Name, check.Description)
+		}
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Exit codes: 0 healthy, 1 warning, 2 critical, 3 unknown")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUnknown
+	}
+	if !slices.Contains(health.Formats, *output) {
+		fmt.Fprintf(os.Stderr, "health: unknown output format %q\n", *output)
+		return exitUnknown
+	}
+
+	selected := healthChecks(splitList(*services))
+	if *checks != "" {
+		var err error
+		if selected, err = health.Select(selected, splitList(*checks)); err != nil {
+			fmt.Fprintf(os.Stderr, "health: %v\n", err)
+			return exitUnknown
+		}
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: *kubeContext})
+	clients, err := newClients(loader, *timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "health: %v\n", err)
+		return exitUnknown
+	}
+
+	report := health.Run(context.Background(), clients, selected, *timeout)
+	if raw, err := loader.RawConfig(); err == nil {
+		report.Context = raw.CurrentContext
+		if *kubeContext != "" {
+			report.Context = *kubeContext
+		}
+	}
+
+	if err := health.Write(os.Stdout, report, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "health: %v\n", err)
+		return exitUnknown
+	}
+	return report.Status().ExitCode()
+}
+
+func lintCommand(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	root := fs.String("root", ".", "repository root that source paths are relative to")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: platformctl lint [flags] [dir ...]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintf(fs.Output(), "Lints the Argo CD manifests in the dirs, relative to -root (default %s).\n", strings.Join(gitops.DefaultDirs, " "))
+		fmt.Fprintln(fs.Output(), "Exit codes: 0 clean, 1 problems found, 2 the manifests could not be read")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	tree, err := gitops.Load(*root, fs.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+		return 2
+	}
+
+	diags := gitops.Lint(tree, gitops.DefaultDependencies)
+	for _, d := range diags {
+		fmt.Println(d)
+	}
+	if len(diags) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func wavesCommand(args []string) int {
+	fs := flag.NewFlagSet("waves", flag.ContinueOnError)
+	root := fs.String("root", ".", "repository root that source paths are relative to")
+	output := fs.String("o", gitops.FormatText, "output format: "+strings.Join(gitops.Formats, ", "))
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: platformctl waves [flags] [dir ...]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintf(fs.Output(), "Simulates the sync order of the Argo CD manifests in the dirs, relative to -root (default %s).\n", strings.Join(gitops.DefaultDirs, " "))
+		fmt.Fprintln(fs.Output(), "Exit codes: 0 ordered, 1 cycles or inversions found, 2 the manifests could not be read")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !slices.Contains(gitops.Formats, *output) {
+		fmt.Fprintf(os.Stderr, "waves: unknown output format %q\n", *output)
+		return 2
+	}
+
+	tree, err := gitops.Load(*root, fs.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "waves: %v\n", err)
+		return 2
+	}
+
+	graph := gitops.NewGraph(tree, gitops.DefaultDependencies)
+	if err := gitops.WriteGraph(os.Stdout, graph, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "waves: %v\n", err)
+		return 2
+	}
+	if !graph.OK() {
+		return 1
+	}
+	return 0
+}
+
+// healthChecks is health.Default with the critical Services replaced
+func healthChecks(services []string) []health.Check {
+	checks := health.Default()
+	for i, check := range checks {
+		if check.Name == "services" {
+			checks[i] = health.CriticalServices(services...)
+		}
+	}
+	return checks
+}
+
+func newClients(loader clientcmd.ClientConfig, timeout time.Duration) (health.Clients, error) {
+	cfg, err := loader.ClientConfig()
+	if err != nil {
+		return health.Clients{}, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	cfg.Timeout = timeout
+
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return health.Clients{}, err
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return health.Clients{}, err
+	}
+	return health.Clients{Kube: kube, Dynamic: dyn}, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}